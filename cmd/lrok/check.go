@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/lum-tools/lrok/internal/verify"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkWait    time.Duration
+	checkTimeout time.Duration
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check <url|name>",
+	Short: "Check that a public URL reaches an lrok tunnel",
+	Long: `Send a request carrying a nonce to a tunnel's public URL and report whether
+it reached the lrok proxy, what status the app answered with (any status
+counts, including redirects and 404s) and the latency from the edge.
+
+The request is forwarded to your app and shows up in the inspector as a check.
+
+Examples:
+  lrok check https://my-app.t.lum.tools/api/health
+  lrok check my-app                  # The tunnel named my-app, on the current server
+  lrok check my-app --wait 30s       # Retry until it is reachable`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCheck,
+}
+
+func init() {
+	checkCmd.Flags().DurationVar(&checkWait, "wait", 0, "Keep retrying up to this long until the tunnel is reachable")
+	checkCmd.Flags().DurationVar(&checkTimeout, "timeout", 10*time.Second, "Timeout of each request")
+
+	rootCmd.AddCommand(checkCmd)
+}
+
+// checkURL turns a tunnel name or scheme-less host into a URL
+func checkURL(target string) (string, error) {
+	if strings.Contains(target, "://") {
+		return target, nil
+	}
+	if strings.ContainsAny(target, ".:/") {
+		return "https://" + target, nil
+	}
+	if err := tunnel.ValidateTunnelName(target); err != nil {
+		return "", err
+	}
+	server, err := resolveServer()
+	if err != nil {
+		return "", err
+	}
+	return server.HTTPURL(target), nil
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	target, err := checkURL(args[0])
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: checkTimeout,
+		// Redirects are an answer from the app, not something to follow
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var result verify.Result
+	if checkWait > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), checkWait)
+		defer cancel()
+		result = verify.Wait(ctx, client, target, time.Second)
+	} else {
+		result = verify.Check(context.Background(), client, target)
+	}
+
+	out.Event("check", output.Fields{"result": result})
+	if !result.OK() {
+		out.Printf("❌ %s did not reach lrok\n", target)
+		out.Printf("   %s\n", result.Diagnosis)
+		if result.Error != "" {
+			out.Printf("   Error: %s\n", result.Error)
+		}
+		return fmt.Errorf("tunnel check failed")
+	}
+
+	out.Printf("✅ %s reached lrok\n", target)
+	out.Printf("   %s\n", result.Diagnosis)
+	latency := result.Latency.Round(time.Millisecond).String()
+	if result.UpstreamTime > 0 {
+		latency += fmt.Sprintf(" (edge %s, app %s)", result.EdgeLatency.Round(time.Millisecond), result.UpstreamTime.Round(time.Millisecond))
+	}
+	out.Printf("   Latency: %s\n", latency)
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/control"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+var logsFollow bool
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List running tunnels",
+	Long: `List the lrok tunnels running on this machine.
+
+Every running lrok registers itself in ~/.lrok/run/ with a control socket,
+so tunnels started in other terminals show up here.`,
+	Args: cobra.NoArgs,
+	RunE: runList,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status <name>",
+	Short: "Show state, URL, uptime and traffic of a running tunnel",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runStatus,
+}
+
+var stopCmd = &cobra.Command{
+	Use:   "stop <name>",
+	Short: "Stop a running tunnel",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runStop,
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <name>",
+	Short: "Show output of a running tunnel",
+	Long: `Show the recent output of a running tunnel.
+
+Examples:
+  lrok logs happy-dolphin        # Print buffered output
+  lrok logs happy-dolphin -f     # Keep streaming new output`,
+	Args: cobra.ExactArgs(1),
+	RunE: runLogs,
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Stream new output until interrupted")
+
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(logsCmd)
+}
+
+// registerInstance makes a running tunnel visible to list/status/stop/logs.
+// The returned server must be stopped when the tunnel exits.
+func registerInstance(info control.Info, status control.StatusFunc, mgr *tunnel.Manager, logs *control.LogBuffer) (*control.Server, error) {
+	runDir, err := config.GetRunDir()
+	if err != nil {
+		return nil, err
+	}
+
+	srv := control.NewServer(runDir, info, status, mgr.RequestShutdown, logs)
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	runDir, err := config.GetRunDir()
+	if err != nil {
+		return err
+	}
+
+	tunnels, err := control.List(runDir)
+	if err != nil {
+		return err
+	}
+
+	if out.JSON() {
+		out.Event("list", output.Fields{"tunnels": tunnels})
+		return nil
+	}
+
+	if len(tunnels) == 0 {
+		out.Println("No running tunnels")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out.Human(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tURL\tLOCAL\tSTATE\tUPTIME\tPID")
+	for _, t := range tunnels {
+		url := t.URL
+		if url == "" {
+			url = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", t.Name, t.Type, url, t.Local, t.State, t.Uptime(), t.PID)
+	}
+	return w.Flush()
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	client, err := findInstance(args[0])
+	if err != nil {
+		return err
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		return fmt.Errorf("tunnel '%s' is not responding: %w", args[0], err)
+	}
+
+	out.Event("status", output.Fields{"tunnel": status})
+
+	out.Printf("🏷️  Name:        %s (%s)\n", status.Name, status.Type)
+	out.Printf("📶 State:       %s\n", status.State)
+	if status.URL != "" {
+		out.Printf("🌐 Public URL:  %s\n", status.URL)
+	}
+	out.Printf("📍 Local:       %s\n", status.Local)
+	if status.Dashboard != "" {
+		out.Printf("📊 Dashboard:   %s\n", status.Dashboard)
+	}
+	out.Printf("⏱️  Uptime:      %s\n", status.Uptime())
+	out.Printf("↓  Received:    %d bytes\n", status.BytesIn)
+	out.Printf("↑  Sent:        %d bytes\n", status.BytesOut)
+	out.Printf("🔗 Requests:    %d\n", status.Connections)
+	out.Printf("🆔 PID:         %d\n", status.PID)
+	return nil
+}
+
+func runStop(cmd *cobra.Command, args []string) error {
+	client, err := findInstance(args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := client.Stop(); err != nil {
+		return fmt.Errorf("failed to stop tunnel '%s': %w", args[0], err)
+	}
+
+	out.Event("stopped", output.Fields{"name": args[0]})
+	out.Printf("🛑 Stopping tunnel %s\n", args[0])
+	return nil
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	client, err := findInstance(args[0])
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	return client.Logs(ctx, out.Human(), logsFollow)
+}
+
+func findInstance(name string) (*control.Client, error) {
+	runDir, err := config.GetRunDir()
+	if err != nil {
+		return nil, err
+	}
+	return control.Find(runDir, name)
+}
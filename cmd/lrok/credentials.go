@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lum-tools/lrok/internal/config"
+)
+
+// resolveCredential resolves the API key from --api-key, the environment or
+// the active profile. example is the command shown when none is configured.
+// Self-hosted profiles authenticate to their own frps and need no key.
+func resolveCredential(example string) (*config.Credential, error) {
+	cred, err := config.ResolveAPIKey(apiKey)
+	if config.SelfHostedActive() {
+		return cred, nil
+	}
+	if err != nil {
+		return nil, noAPIKeyError(err, example)
+	}
+
+	if err := config.ValidateAPIKeyFormat(cred.APIKey); err != nil {
+		out.Println("⚠️  Warning: API key should start with 'lum_'")
+		out.Println("   Make sure you're using a valid platform API key from https://platform.lum.tools/keys")
+	}
+	return cred, nil
+}
+
+// noAPIKeyError explains how to configure a key
+func noAPIKeyError(err error, example string) error {
+	detail := ""
+	if err != config.ErrNoAPIKey {
+		detail = fmt.Sprintf("\n\n⚠️  %v", err)
+	}
+
+	return fmt.Errorf(`❌ No API key configured!%s
+
+You need a lum.tools platform API key to use lrok.
+
+📝 Get your API key:
+   1. Visit: https://platform.lum.tools/keys
+   2. Login with your account
+   3. Create a new API key
+   4. Copy your API key (starts with 'lum_')
+
+💡 Save it with login command (recommended):
+   lrok login lum_your_api_key_here
+
+Or use environment variable:
+   export LUM_API_KEY='lum_your_api_key_here'
+
+Or pass it directly:
+   %s
+
+Run 'lrok whoami --verbose' to see where lrok looks for a key.`, detail, example)
+}
+
+// describeSource renders where the winning key came from
+func describeSource(cred *config.Credential) string {
+	for _, src := range cred.Chain {
+		if src.Used && src.Detail != "" {
+			return fmt.Sprintf("%s (%s)", src.Name, src.Detail)
+		}
+	}
+	return cred.Source
+}
+
+// printKeyChain lists every key source in precedence order
+func printKeyChain(cred *config.Credential) {
+	out.Println()
+	out.Println("   Precedence:")
+	for i, src := range cred.Chain {
+		state := "not set"
+		switch {
+		case src.Used:
+			state = "✓ used"
+		case src.Error != "":
+			state = "error: " + src.Error
+		case src.Present:
+			state = "set (overridden)"
+		}
+		line := fmt.Sprintf("   %d. %-18s %s", i+1, src.Name, state)
+		if src.Detail != "" && src.Error == "" {
+			line += " — " + src.Detail
+		}
+		out.Println(line)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/lum-tools/lrok/internal/agent"
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var (
+	agentSocket  string
+	detach       bool
+	servicePrint bool
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the lrok agent that manages tunnels in the background",
+	Long: `Run a long-lived agent that manages many tunnels.
+
+Tunnels are created, updated and removed at runtime through a local
+REST/JSON API on a unix socket (default ~/.lrok/agent.sock):
+
+  GET    /tunnels                list tunnels
+  POST   /tunnels                create {"name","type","local_port","remote_port"}
+  GET    /tunnels/{name}         get one tunnel
+  PUT    /tunnels/{name}         replace a tunnel's settings
+  DELETE /tunnels/{name}         stop a tunnel
+  GET    /tunnels/{name}/logs    tunnel output
+
+Examples:
+  lrok daemon                              # Start the agent
+  lrok 8000 --detach                       # Hand a tunnel to the agent
+  curl --unix-socket ~/.lrok/agent.sock http://lrok/tunnels
+  lrok service install                     # Run the agent via systemd`,
+	Args: cobra.NoArgs,
+	RunE: runDaemon,
+}
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage the lrok agent as a systemd user service",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install a systemd user unit running 'lrok daemon'",
+	Args:  cobra.NoArgs,
+	RunE:  runServiceInstall,
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the systemd user unit",
+	Args:  cobra.NoArgs,
+	RunE:  runServiceUninstall,
+}
+
+func init() {
+	daemonCmd.Flags().StringVar(&agentSocket, "socket", "", "Agent API socket path (default ~/.lrok/agent.sock)")
+	serviceInstallCmd.Flags().BoolVar(&servicePrint, "print", false, "Print the unit instead of writing it")
+
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
+
+// resolveAgentSocket returns the socket from --socket or the default path
+func resolveAgentSocket() (string, error) {
+	if agentSocket != "" {
+		return agentSocket, nil
+	}
+	return agent.GetSocketPath()
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	socketPath, err := resolveAgentSocket()
+	if err != nil {
+		return err
+	}
+	runDir, err := config.GetRunDir()
+	if err != nil {
+		return err
+	}
+
+	a := agent.New(runDir)
+	srv := agent.NewServer(a, socketPath)
+	if err := srv.Start(); err != nil {
+		return err
+	}
+	defer srv.Stop()
+
+	out.Event(output.EventReady, output.Fields{"type": "agent", "socket": socketPath})
+	out.Println("🤖 lrok agent running")
+	out.Printf("   API socket: %s\n", socketPath)
+	out.Println("   Submit tunnels with: lrok <port> --detach")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+
+	out.Println("\n🛑 Stopping all tunnels...")
+	a.Shutdown()
+	out.Event(output.EventShutdown, output.Fields{"type": "agent"})
+	return nil
+}
+
+// submitDetached hands a tunnel to the running agent instead of blocking
+func submitDetached(spec agent.Spec) error {
+	socketPath, err := resolveAgentSocket()
+	if err != nil {
+		return err
+	}
+
+	status, err := agent.Dial(socketPath).Create(spec)
+	if err != nil {
+		return err
+	}
+
+	fields := output.Fields{
+		"type":     status.Type,
+		"name":     status.Name,
+		"url":      status.URL,
+		"detached": true,
+	}
+	if status.Dashboard != "" {
+		fields["dashboard"] = status.Dashboard
+	}
+	out.Event(output.EventReady, fields)
+
+	out.Println("✅ Tunnel handed to the lrok agent")
+	out.Printf("  🌐 Public URL: %s\n", status.URL)
+	out.Printf("  🏷️  Name:       %s\n", status.Name)
+	if status.Dashboard != "" {
+		out.Printf("  📊 Dashboard:  %s\n", status.Dashboard)
+	}
+	out.Printf("\nStop it with: lrok stop %s\n", status.Name)
+	return nil
+}
+
+func runServiceInstall(cmd *cobra.Command, args []string) error {
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate lrok binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(execPath); err == nil {
+		execPath = resolved
+	}
+
+	unit := agent.SystemdUnit(execPath, nil)
+	if servicePrint {
+		fmt.Fprint(out.Human(), unit)
+		return nil
+	}
+
+	unitPath, err := agent.GetUnitPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+		return fmt.Errorf("failed to create unit directory: %w", err)
+	}
+	if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("failed to write unit file: %w", err)
+	}
+
+	out.Event("service_installed", output.Fields{"unit": unitPath})
+	out.Println("✅ Installed systemd user unit")
+	out.Printf("   Unit: %s\n", unitPath)
+	out.Println()
+	out.Println("Enable and start it with:")
+	out.Println("   systemctl --user daemon-reload")
+	out.Println("   systemctl --user enable --now lrok")
+	out.Println()
+	out.Println("Keep it running after logout with:")
+	out.Println("   loginctl enable-linger $USER")
+	return nil
+}
+
+func runServiceUninstall(cmd *cobra.Command, args []string) error {
+	unitPath, err := agent.GetUnitPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove unit file: %w", err)
+	}
+
+	out.Event("service_uninstalled", output.Fields{"unit": unitPath})
+	out.Println("✅ Removed systemd user unit")
+	out.Println("   Run 'systemctl --user disable --now lrok' if it is still active")
+	return nil
+}
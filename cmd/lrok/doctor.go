@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/doctor"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [port]",
+	Short: "Diagnose common environment problems",
+	Long: `Check everything a tunnel needs: the embedded frpc, the temp dir, your API
+key, DNS and TCP reachability of the tunnel server, the egress proxy,
+your local app's port, the dashboard port and the system clock.
+
+Examples:
+  lrok doctor          # Check the environment
+  lrok doctor 3000     # Also check that something listens on port 3000
+  lrok doctor --json   # Machine-readable report`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().StringVarP(&apiKey, "api-key", "k", "", "API key to check instead of the configured one")
+
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorIcons mark each check status in the text report
+var doctorIcons = map[string]string{
+	doctor.StatusOK:   "✅",
+	doctor.StatusWarn: "⚠️ ",
+	doctor.StatusFail: "❌",
+	doctor.StatusSkip: "⏭️ ",
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	opts := doctor.Options{
+		APIKeyFlag:    apiKey,
+		EgressProxy:   egressProxyFlag,
+		DashboardPort: 4242,
+	}
+	if len(args) > 0 {
+		port, err := strconv.Atoi(args[0])
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port: %s", args[0])
+		}
+		opts.LocalPort = port
+	}
+	opts.Server, opts.ServerErr = resolveServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report := doctor.New().Run(ctx, opts)
+
+	out.Event("doctor", output.Fields{"checks": report.Checks})
+	out.Println("🩺 lrok doctor")
+	out.Println()
+	for _, c := range report.Checks {
+		out.Printf("%s %-17s %s\n", doctorIcons[c.Status], c.Name, c.Detail)
+		if c.Hint != "" {
+			out.Printf("   💡 %s\n", c.Hint)
+		}
+	}
+	out.Println()
+
+	failed, warned := report.Count(doctor.StatusFail), report.Count(doctor.StatusWarn)
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed, %d warning(s)", failed, warned)
+	}
+	if warned > 0 {
+		out.Printf("✅ No failures, %d warning(s)\n", warned)
+		return nil
+	}
+	out.Println("✅ All checks passed")
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/domains"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// customDomains are the --domain values of an HTTP tunnel
+var customDomains []string
+
+var domainsCmd = &cobra.Command{
+	Use:   "domains",
+	Short: "Manage custom domains for HTTP tunnels",
+	Long: `Serve HTTP tunnels on your own hostnames instead of <name>.t.lum.tools.
+
+A domain must be added and verified once: lrok checks that it is a CNAME
+to the tunnel server and that a TXT record proves you own it.
+
+Examples:
+  lrok domains add app.example.com      # Prints the DNS records to create
+  lrok domains verify app.example.com   # Checks them
+  lrok 3000 --domain app.example.com    # Tunnel on https://app.example.com`,
+}
+
+var domainsAddCmd = &cobra.Command{
+	Use:   "add <domain>",
+	Short: "Register a custom domain and show its DNS records",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDomainsAdd,
+}
+
+var domainsVerifyCmd = &cobra.Command{
+	Use:   "verify [domain]...",
+	Short: "Check DNS records of custom domains (all if none given)",
+	RunE:  runDomainsVerify,
+}
+
+var domainsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List custom domains",
+	Args:    cobra.NoArgs,
+	RunE:    runDomainsList,
+}
+
+var domainsRemoveCmd = &cobra.Command{
+	Use:     "remove <domain>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a custom domain",
+	Args:    cobra.ExactArgs(1),
+	RunE:    runDomainsRemove,
+}
+
+func init() {
+	rootCmd.Flags().StringArrayVar(&customDomains, "domain", nil, "Serve on a verified custom domain (repeatable, see 'lrok domains')")
+	httpCmd.Flags().StringArrayVar(&customDomains, "domain", nil, "Serve on a verified custom domain (repeatable)")
+
+	domainsCmd.AddCommand(domainsAddCmd)
+	domainsCmd.AddCommand(domainsVerifyCmd)
+	domainsCmd.AddCommand(domainsListCmd)
+	domainsCmd.AddCommand(domainsRemoveCmd)
+
+	rootCmd.AddCommand(domainsCmd)
+}
+
+// normalizeDomains lowercases and validates --domain values
+func normalizeDomains(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		if err := tunnel.ValidateDomain(name); err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, name)
+	}
+	return normalized, nil
+}
+
+func runDomainsAdd(cmd *cobra.Command, args []string) error {
+	names, err := normalizeDomains(args)
+	if err != nil {
+		return err
+	}
+	name := names[0]
+
+	server, err := resolveServer()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	token, err := domains.NewToken()
+	if err != nil {
+		return err
+	}
+	d := cfg.AddDomain(name, token, server.CNAMETarget())
+	if err := config.SaveConfig(cfg); err != nil {
+		return err
+	}
+
+	out.Event("domain_add", output.Fields{
+		"domain":    name,
+		"cname":     d.Target,
+		"txt_name":  domains.TXTName(name),
+		"txt_value": domains.TXTValue(d.Token),
+	})
+	out.Printf("✅ Added %s\n\n", name)
+	out.Println("📝 Create these DNS records at your DNS provider:")
+	out.Printf("   CNAME  %s  →  %s\n", name, d.Target)
+	out.Printf("   TXT    %s  \"%s\"\n", domains.TXTName(name), domains.TXTValue(d.Token))
+	out.Println()
+	out.Println("💡 Apex domains that can't use a CNAME may use A records with the")
+	out.Printf("   addresses of %s instead.\n\n", d.Target)
+	out.Printf("Then run: lrok domains verify %s\n", name)
+	return nil
+}
+
+func runDomainsVerify(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	names, err := normalizeDomains(args)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = cfg.DomainNames()
+	}
+	if len(names) == 0 {
+		out.Println("No custom domains configured")
+		out.Println("   Add one with: lrok domains add app.example.com")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var checks []domains.Check
+	failed := 0
+	for _, name := range names {
+		d, ok := cfg.Domains[name]
+		if !ok {
+			return fmt.Errorf("domain '%s' is not registered (run 'lrok domains add %s')", name, name)
+		}
+
+		check := domains.Verify(ctx, domains.DefaultResolver, name, d.Token, d.Target)
+		checks = append(checks, check)
+		d.Verified = check.Verified
+		d.VerifiedAt = ""
+		if check.Verified {
+			d.VerifiedAt = time.Now().UTC().Format(time.RFC3339)
+			out.Printf("✅ %s verified\n", name)
+			continue
+		}
+
+		failed++
+		out.Printf("❌ %s not verified\n", name)
+		for _, problem := range check.Problems {
+			out.Printf("   • %s\n", problem)
+		}
+	}
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return err
+	}
+	out.Event("domain_verify", output.Fields{"checks": checks})
+
+	if failed > 0 {
+		return fmt.Errorf("%d domain(s) not verified (DNS changes can take a few minutes to propagate)", failed)
+	}
+	return nil
+}
+
+func runDomainsList(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	names := cfg.DomainNames()
+
+	if out.JSON() {
+		out.Event("domains", output.Fields{"domains": cfg.Domains})
+		return nil
+	}
+
+	if len(names) == 0 {
+		out.Println("No custom domains configured")
+		out.Println("   Add one with: lrok domains add app.example.com")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out.Human(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DOMAIN\tSTATUS\tCNAME TARGET\tVERIFIED AT")
+	for _, name := range names {
+		d := cfg.Domains[name]
+		status := "pending"
+		if d.Verified {
+			status = "verified"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, status, d.Target, dash(d.VerifiedAt))
+	}
+	return w.Flush()
+}
+
+func runDomainsRemove(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	name := strings.ToLower(args[0])
+	if _, ok := cfg.Domains[name]; !ok {
+		return fmt.Errorf("domain '%s' not found", name)
+	}
+	delete(cfg.Domains, name)
+	if err := config.SaveConfig(cfg); err != nil {
+		return err
+	}
+
+	out.Event("domain_remove", output.Fields{"domain": name})
+	out.Printf("✅ Removed %s\n", name)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/dashboard"
+	"github.com/lum-tools/lrok/internal/decode"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// inspectConns is how many connections the inspector keeps
+const inspectConns = 100
+
+var (
+	inspectFlag bool
+	decodeFlag  string
+)
+
+// addInspectFlag adds --inspect and --decode to a raw TCP tunnel command
+func addInspectFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&inspectFlag, "inspect", false, "Record each connection (client address, bytes, first bytes) in a local dashboard")
+	cmd.Flags().StringVar(&decodeFlag, "decode", "", "Show protocol messages per connection: auto, postgres, mysql, redis, tls or ssh (implies --inspect)")
+	cmd.Flags().Lookup("decode").NoOptDefVal = decode.Auto
+}
+
+// inspecting reports whether connections are recorded for the dashboard
+func inspecting() bool {
+	return inspectFlag || decodeFlag != ""
+}
+
+// inspectRelay has rel record connections and decode them per --decode
+func inspectRelay(rel *relay.Relay) error {
+	rel.SetRecording(inspectConns)
+	if decodeFlag != "" {
+		if err := decode.Validate(decodeFlag); err != nil {
+			return fmt.Errorf("invalid --decode: %w", err)
+		}
+		rel.SetDecoding(decodeFlag)
+	}
+	return nil
+}
+
+// startInspector serves the relay's connections on the local dashboard,
+// returning nil without --inspect or when the dashboard can't start
+func startInspector(rel *relay.Relay, name, publicURL string, localPort int, mgr *tunnel.Manager) *dashboard.Server {
+	if !inspecting() {
+		return nil
+	}
+	stats := &dashboard.Stats{
+		TunnelName: name,
+		PublicURL:  publicURL,
+		LocalPort:  localPort,
+		Status:     "Connected",
+		StartTime:  time.Now(),
+	}
+	dash := dashboard.New(stats, nil)
+	if err := dash.Start(4242); err != nil {
+		out.Printf("⚠️  Dashboard failed to start: %v\n", err)
+		return nil
+	}
+	dash.SetTunnel(mgr)
+	dash.SetRelay(rel)
+	out.Printf("📊 Dashboard:  http://localhost:%d\n", dash.Port())
+	return dash
+}
+
+// freeLocalPort finds a free port on 127.0.0.1
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/control"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+var (
+	maxBytesFlag string
+	maxConns     int
+	expireAfter  time.Duration
+)
+
+// addLimitFlags adds the local traffic limit flags to a tunnel command
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&maxBytesFlag, "max-bytes", "", "Stop the tunnel after this much traffic in both directions (e.g. 500MB, 2GB)")
+	cmd.Flags().IntVar(&maxConns, "max-conns", 0, "Refuse connections beyond this many open at once")
+	cmd.Flags().DurationVar(&expireAfter, "expire-after", 0, "Stop the tunnel after this long (e.g. 2h)")
+}
+
+// limitsFromFlags parses the traffic limit flags
+func limitsFromFlags() (relay.Limits, error) {
+	limits := relay.Limits{MaxConns: maxConns, ExpireAfter: expireAfter}
+	if maxBytesFlag != "" {
+		n, err := relay.ParseBytes(maxBytesFlag)
+		if err != nil {
+			return limits, fmt.Errorf("invalid --max-bytes: %w", err)
+		}
+		limits.MaxBytes = n
+	}
+	if maxConns < 0 {
+		return limits, fmt.Errorf("invalid --max-conns: must not be negative")
+	}
+	if expireAfter < 0 {
+		return limits, fmt.Errorf("invalid --expire-after: must not be negative")
+	}
+	return limits, nil
+}
+
+// startRelay starts the counting relay in front of target. With inspect
+// it records connections, reading client addresses from frpc's PROXY header.
+func startRelay(target string, limits relay.Limits, inspect bool) (*relay.Relay, int, error) {
+	rel := relay.New(target, limits)
+	if inspect {
+		if err := inspectRelay(rel); err != nil {
+			return nil, 0, err
+		}
+		rel.SetProxyProtocol(true)
+	}
+	relayPort, err := rel.Start()
+	if err != nil {
+		return nil, 0, err
+	}
+	return rel, relayPort, nil
+}
+
+// limitsDescription summarizes the limits for the banner, empty without any
+func limitsDescription(limits relay.Limits) string {
+	desc := ""
+	add := func(part string) {
+		if desc != "" {
+			desc += ", "
+		}
+		desc += part
+	}
+	if limits.MaxBytes > 0 {
+		add(relay.FormatBytes(limits.MaxBytes) + " of traffic")
+	}
+	if limits.MaxConns > 0 {
+		add(fmt.Sprintf("%d connections at once", limits.MaxConns))
+	}
+	if limits.ExpireAfter > 0 {
+		add("expires after " + limits.ExpireAfter.String())
+	}
+	return desc
+}
+
+// watchLimits shuts the tunnel down once the relay hits a limit
+func watchLimits(rel *relay.Relay, mgr *tunnel.Manager, name string) {
+	<-rel.Done()
+	stats := rel.Stats()
+	out.Printf("\n⛔ Stopping: %v\n", rel.Err())
+	out.Event(output.EventLimit, output.Fields{
+		"name":      name,
+		"reason":    rel.Reason(),
+		"bytes_in":  stats.BytesIn,
+		"bytes_out": stats.BytesOut,
+	})
+	mgr.RequestShutdown()
+}
+
+// relayStatus reports a tunnel's state with the relay's traffic counters
+func relayStatus(mgr *tunnel.Manager, rel *relay.Relay) control.StatusFunc {
+	return func() control.Status {
+		if rel == nil {
+			return control.Status{State: mgr.State()}
+		}
+		stats := rel.Stats()
+		return control.Status{
+			State:       mgr.State(),
+			BytesIn:     stats.BytesIn,
+			BytesOut:    stats.BytesOut,
+			Connections: stats.Connections,
+		}
+	}
+}
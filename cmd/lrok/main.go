@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lum-tools/lrok/internal/agent"
 	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/control"
 	"github.com/lum-tools/lrok/internal/dashboard"
 	"github.com/lum-tools/lrok/internal/names"
+	"github.com/lum-tools/lrok/internal/output"
 	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/lum-tools/lrok/internal/tracing"
 	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/lum-tools/lrok/internal/verify"
 	"github.com/lum-tools/lrok/internal/version"
 	"github.com/spf13/cobra"
 )
@@ -29,8 +37,34 @@ var (
 	subdomain string
 	apiKey    string
 	localIP   string
+	routes    []string
+
+	lbStrategy   string
+	lbHealthPath string
+
+	verifyWebhooks []string
+	rejectWebhooks bool
+	holdRequests   time.Duration
+	readyPath      string
+
+	loginStore    string
+	loginVerify   bool
+	whoamiVerbose bool
+
+	otlpEndpoint string
+	otlpProtocol string
+	otlpHeaders  []string
+
+	outputFormat string
+	jsonOutput   bool
 )
 
+// out writes human text and, with --output json, NDJSON events on stdout
+var out, _ = output.New(output.FormatText)
+
+// instanceLogs keeps recent output for 'lrok logs'
+var instanceLogs = control.NewLogBuffer(1000)
+
 var rootCmd = &cobra.Command{
 	Use:   "lrok [port]",
 	Short: "Expose local services with readable tunnel names",
@@ -41,17 +75,43 @@ Expose your local services to the internet with HTTPS and readable URLs.
 Examples:
   lrok 8000                    # Expose port 8000 with random name
   lrok 8000 --name my-app      # Expose with custom name
-  lrok 3000 --subdomain api    # Use subdomain instead`,
-	Args:    cobra.MaximumNArgs(1),
-	Version: versionInfo,
-	RunE:    runTunnel,
+  lrok 3000 --subdomain api    # Use subdomain instead
+  lrok http --route /api=8080 --route /=3000   # Fan out by path
+  lrok 8000 --json | jq -r 'select(.event=="ready").url'`,
+	Args:              cobra.MaximumNArgs(1),
+	Version:           versionInfo,
+	RunE:              runTunnel,
+	PersistentPreRunE: setupOutput,
+	SilenceErrors:     true,
+}
+
+// setupOutput configures the global printer from --output/--json
+func setupOutput(cmd *cobra.Command, args []string) error {
+	format := outputFormat
+	if jsonOutput {
+		format = output.FormatJSON
+	}
+
+	printer, err := output.New(format)
+	if err != nil {
+		return err
+	}
+	printer.Tee(instanceLogs)
+	out = printer
+
+	config.SetProfile(profileName)
+	return nil
 }
 
 var httpCmd = &cobra.Command{
-	Use:   "http [port]",
+	Use:   "http [port[,port...]]",
 	Short: "Create HTTP tunnel (alias for default behavior)",
-	Long:  `Create an HTTP tunnel to expose a local port`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Create an HTTP tunnel to expose a local port.
+
+Several comma-separated ports are load balanced (--lb) with health checks,
+so one can restart while the others keep serving:
+  lrok http 8001,8002,8003 --lb least-conn`,
+	Args:  cobra.MaximumNArgs(1),
 	RunE:  runTunnel,
 }
 
@@ -60,15 +120,21 @@ var versionCmd = &cobra.Command{
 	Aliases: []string{"v"},
 	Short:   "Show version information",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("lrok version %s\n", versionInfo)
-		fmt.Printf("commit: %s\n", commit)
-		fmt.Printf("built: %s\n", date)
+		out.Printf("lrok version %s\n", versionInfo)
+		out.Printf("commit: %s\n", commit)
+		out.Printf("built: %s\n", date)
+		
+		fields := output.Fields{"version": versionInfo, "commit": commit, "built": date}
 		
 		// Check for updates (non-blocking)
+		useEgressProxy()
 		if hasUpdate, latest, method, err := version.CheckForUpdate(versionInfo); err == nil && hasUpdate {
-			fmt.Println()
-			version.ShowUpdateWarning(versionInfo, latest, method)
+			out.Println()
+			version.ShowUpdateWarning(out.Human(), versionInfo, latest, method)
+			fields["latest"] = latest
 		}
+		
+		out.Event("version", fields)
 	},
 }
 
@@ -78,6 +144,15 @@ var loginCmd = &cobra.Command{
 	Long: `Save your lum.tools platform API key to ~/.lrok/config.toml
 
 This allows you to use lrok without setting environment variables.
+Use --profile to keep several keys side by side (see 'lrok profile').
+
+Use --store to keep the key out of the config file:
+  file            AES-GCM encrypted ~/.lrok/secrets.enc (needs LROK_SECRETS_PASSPHRASE)
+  secret-service  GNOME Keyring/KWallet via secret-tool
+  pass            the pass password manager (entry lrok/<profile>)
+  plaintext       config.toml (default)
+
+The choice is remembered for later logins.
 
 Get your API key from: https://platform.lum.tools/keys`,
 	Args: cobra.ExactArgs(1),
@@ -85,21 +160,48 @@ Get your API key from: https://platform.lum.tools/keys`,
 		apiKey := args[0]
 		
 		// Validate API key format
-		if !strings.HasPrefix(apiKey, "lum_") {
-			return fmt.Errorf("invalid API key format (should start with 'lum_')")
+		if err := config.ValidateAPIKeyFormat(apiKey); err != nil {
+			return err
+		}
+		
+		if loginVerify {
+			out.Println("🔍 Verifying API key with the tunnel server...")
+			server, err := resolveServer()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+			var verifier config.KeyVerifier = tunnel.NewLoginVerifier(server)
+			if err := verifier.Verify(ctx, apiKey); err != nil {
+				return fmt.Errorf("API key not saved: %w", err)
+			}
 		}
 		
 		// Save to config
-		if err := config.SaveAPIKey(apiKey); err != nil {
+		if err := config.SaveAPIKeyTo(apiKey, loginStore); err != nil {
 			return fmt.Errorf("failed to save API key: %w", err)
 		}
 		
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		profile := cfg.ActiveProfileName()
+		_, location, _ := cfg.ProfileAPIKey(profile)
 		configPath, _ := config.GetConfigPath()
-		fmt.Println("✅ API key saved successfully!")
-		fmt.Printf("   Config: %s\n", configPath)
-		fmt.Println()
-		fmt.Println("You can now run lrok without setting LUM_API_KEY:")
-		fmt.Println("   lrok 8000")
+		out.Event("login", output.Fields{"config": configPath, "profile": profile, "stored_in": location})
+		out.Println("✅ API key saved successfully!")
+		out.Printf("   Config:  %s\n", configPath)
+		out.Printf("   Profile: %s\n", profile)
+		out.Printf("   Stored:  %s\n", location)
+		out.Println()
+		out.Println("You can now run lrok without setting LUM_API_KEY:")
+		if profile == config.DefaultProfile {
+			out.Println("   lrok 8000")
+		} else {
+			out.Printf("   lrok --profile %s 8000\n", profile)
+		}
 		
 		return nil
 	},
@@ -108,14 +210,15 @@ Get your API key from: https://platform.lum.tools/keys`,
 var logoutCmd = &cobra.Command{
 	Use:   "logout",
 	Short: "Remove saved API key",
-	Long:  `Remove the API key from ~/.lrok/config.toml`,
+	Long:  `Remove the active profile's API key from ~/.lrok/config.toml`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := config.ClearConfig(); err != nil {
+		if err := config.ClearAPIKey(); err != nil {
 			return fmt.Errorf("failed to logout: %w", err)
 		}
 		
-		fmt.Println("✅ Logged out successfully!")
-		fmt.Println("   API key removed from config")
+		out.Event("logout", nil)
+		out.Println("✅ Logged out successfully!")
+		out.Println("   API key removed from config")
 		
 		return nil
 	},
@@ -124,63 +227,95 @@ var logoutCmd = &cobra.Command{
 var whoamiCmd = &cobra.Command{
 	Use:   "whoami",
 	Short: "Show current API key configuration",
-	Long:  `Display information about the currently configured API key`,
+	Long: `Display information about the currently configured API key
+
+The key is taken from the first of:
+  1. --api-key flag
+  2. LUM_API_KEY environment variable
+  3. FRP_API_KEY environment variable (legacy)
+  4. the active profile in ~/.lrok/config.toml
+
+Use --verbose to see every source and which one won.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Try to get API key from different sources
-		var apiKey string
-		var source string
-		
-		// Check flag (if this was called with --api-key)
-		if apiKey == "" {
-			apiKey = os.Getenv("LUM_API_KEY")
-			if apiKey != "" {
-				source = "environment variable (LUM_API_KEY)"
-			}
+		resolveKey := config.ResolveAPIKey
+		if whoamiVerbose {
+			resolveKey = config.InspectAPIKey
 		}
+		cred, err := resolveKey(apiKey)
 		
-		// Check config file
-		if apiKey == "" {
-			if key, err := config.GetAPIKey(); err == nil {
-				apiKey = key
-				configPath, _ := config.GetConfigPath()
-				source = fmt.Sprintf("config file (%s)", configPath)
-			}
+		var profile *config.Profile
+		if cfg, loadErr := config.LoadConfig(); loadErr == nil {
+			profile, _ = cfg.Profile(cred.Profile)
 		}
 		
-		if apiKey == "" {
-			fmt.Println("❌ Not logged in")
-			fmt.Println()
-			fmt.Println("To login:")
-			fmt.Println("   lrok login <your-api-key>")
-			fmt.Println()
-			fmt.Println("Or set environment variable:")
-			fmt.Println("   export LUM_API_KEY='lum_your_key'")
-			fmt.Println()
-			fmt.Println("Get your API key: https://platform.lum.tools/keys")
+		if err != nil {
+			out.Event("whoami", output.Fields{"logged_in": false, "profile": cred.Profile, "chain": cred.Chain})
+			out.Println("❌ Not logged in")
+			if err != config.ErrNoAPIKey {
+				out.Printf("   %v\n", err)
+			}
+			if whoamiVerbose {
+				printKeyChain(cred)
+			}
+			out.Println()
+			out.Println("To login:")
+			out.Println("   lrok login <your-api-key>")
+			out.Println()
+			out.Println("Or set environment variable:")
+			out.Println("   export LUM_API_KEY='lum_your_key'")
+			out.Println()
+			out.Println("Get your API key: https://platform.lum.tools/keys")
 			return nil
 		}
 		
 		// Show prefix only for security
-		prefix := apiKey
-		if len(apiKey) > 16 {
-			prefix = apiKey[:16] + "..." + apiKey[len(apiKey)-4:]
-		}
+		prefix := maskKey(cred.APIKey)
 		
-		fmt.Println("✅ Logged in")
-		fmt.Printf("   API Key: %s\n", prefix)
-		fmt.Printf("   Source:  %s\n", source)
+		fields := output.Fields{"logged_in": true, "api_key": prefix, "source": cred.Source, "profile": cred.Profile}
+		if profile != nil && profile.Organization != "" {
+			fields["organization"] = profile.Organization
+		}
+		if whoamiVerbose {
+			fields["chain"] = cred.Chain
+		}
+		out.Event("whoami", fields)
+		out.Println("✅ Logged in")
+		out.Printf("   API Key: %s\n", prefix)
+		out.Printf("   Source:  %s\n", describeSource(cred))
+		out.Printf("   Profile: %s\n", cred.Profile)
+		if profile != nil && profile.Organization != "" {
+			out.Printf("   Org:     %s\n", profile.Organization)
+		}
+		if whoamiVerbose {
+			printKeyChain(cred)
+		}
 		
 		return nil
 	},
 }
 
 func init() {
+	// Global output flags
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", output.FormatText, "Output format: text or json (NDJSON events on stdout)")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Shorthand for --output json")
+
 	// Flags for root command
 	rootCmd.Flags().IntVarP(&port, "port", "p", 0, "Local port to expose (optional if provided as argument)")
 	rootCmd.Flags().StringVarP(&name, "name", "n", "", "Custom tunnel name (generates random if not provided)")
 	rootCmd.Flags().StringVar(&subdomain, "subdomain", "", "Alias for --name")
 	rootCmd.Flags().StringVarP(&apiKey, "api-key", "k", "", "lum.tools platform API key (or set LUM_API_KEY env var)")
 	rootCmd.Flags().StringVar(&localIP, "ip", "127.0.0.1", "Local IP address to bind to")
+	rootCmd.Flags().StringArrayVar(&routes, "route", nil, "Route [host]/prefix=port to a local service (repeatable)")
+	rootCmd.Flags().StringVar(&lbStrategy, "lb", proxy.LBRoundRobin, "Load balancing across several ports: round-robin or least-conn")
+	rootCmd.Flags().StringVar(&lbHealthPath, "lb-health-path", "", "HTTP path for upstream health checks (default: TCP connect)")
+	rootCmd.Flags().StringArrayVar(&verifyWebhooks, "verify-webhook", nil, "Check webhook signatures as provider:secret (stripe, github, slack, twilio, shopify, hmac; repeatable)")
+	rootCmd.Flags().BoolVar(&rejectWebhooks, "reject-invalid-webhooks", false, "Answer 401 to webhooks failing --verify-webhook instead of forwarding them")
+	rootCmd.Flags().DurationVar(&holdRequests, "hold-requests", 0, "Queue requests up to this long while the local app is down (e.g. 30s)")
+	rootCmd.Flags().StringVar(&readyPath, "ready-path", "", "HTTP path to check the local app is ready at startup (default: TCP connect only)")
+	rootCmd.Flags().BoolVarP(&detach, "detach", "d", false, "Hand the tunnel to the background agent ('lrok daemon') and return")
+	rootCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector URL for request spans (or set OTEL_EXPORTER_OTLP_ENDPOINT)")
+	rootCmd.Flags().StringVar(&otlpProtocol, "otlp-protocol", "", "OTLP protocol: http/json, http/protobuf or grpc")
+	rootCmd.Flags().StringArrayVar(&otlpHeaders, "otlp-header", nil, "Extra collector header as key=value (repeatable)")
 
 	// Flags for http command (same as root)
 	httpCmd.Flags().IntVarP(&port, "port", "p", 0, "Local port to expose (optional if provided as argument)")
@@ -188,6 +323,19 @@ func init() {
 	httpCmd.Flags().StringVar(&subdomain, "subdomain", "", "Alias for --name")
 	httpCmd.Flags().StringVarP(&apiKey, "api-key", "k", "", "API key")
 	httpCmd.Flags().StringVar(&localIP, "ip", "127.0.0.1", "Local IP to bind to")
+	httpCmd.Flags().StringArrayVar(&routes, "route", nil, "Route [host]/prefix=port to a local service (repeatable)")
+	httpCmd.Flags().StringVar(&lbStrategy, "lb", proxy.LBRoundRobin, "Load balancing across several ports: round-robin or least-conn")
+	httpCmd.Flags().StringVar(&lbHealthPath, "lb-health-path", "", "HTTP path for upstream health checks (default: TCP connect)")
+	httpCmd.Flags().StringArrayVar(&verifyWebhooks, "verify-webhook", nil, "Check webhook signatures as provider:secret (repeatable)")
+	httpCmd.Flags().BoolVar(&rejectWebhooks, "reject-invalid-webhooks", false, "Answer 401 to webhooks failing --verify-webhook")
+	httpCmd.Flags().DurationVar(&holdRequests, "hold-requests", 0, "Queue requests up to this long while the local app is down (e.g. 30s)")
+	httpCmd.Flags().StringVar(&readyPath, "ready-path", "", "HTTP path to check the local app is ready at startup (default: TCP connect only)")
+	httpCmd.Flags().BoolVarP(&detach, "detach", "d", false, "Hand the tunnel to the background agent and return")
+	httpCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP/HTTP collector URL for request spans")
+	httpCmd.Flags().StringVar(&otlpProtocol, "otlp-protocol", "", "OTLP protocol: http/json, http/protobuf or grpc")
+	httpCmd.Flags().StringArrayVar(&otlpHeaders, "otlp-header", nil, "Extra collector header as key=value (repeatable)")
+	addLimitFlags(rootCmd)
+	addLimitFlags(httpCmd)
 
 	rootCmd.AddCommand(httpCmd)
 	rootCmd.AddCommand(tcpCmd)
@@ -195,6 +343,11 @@ func init() {
 	rootCmd.AddCommand(xtcpCmd)
 	rootCmd.AddCommand(visitorCmd)
 	rootCmd.AddCommand(versionCmd)
+	loginCmd.Flags().StringVar(&loginStore, "store", "", "Where to keep the key: plaintext, file, secret-service or pass")
+	loginCmd.Flags().BoolVar(&loginVerify, "verify", false, "Open a short test tunnel to check the server accepts the key before saving")
+	whoamiCmd.Flags().StringVarP(&apiKey, "api-key", "k", "", "API key to check instead of the configured one")
+	whoamiCmd.Flags().BoolVarP(&whoamiVerbose, "verbose", "v", false, "Show every key source in precedence order")
+
 	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(logoutCmd)
 	rootCmd.AddCommand(whoamiCmd)
@@ -202,9 +355,10 @@ func init() {
 
 func runTunnel(cmd *cobra.Command, args []string) error {
 	// Check for updates in background (non-blocking)
+	useEgressProxy()
 	go func() {
 		if hasUpdate, latest, method, err := version.CheckForUpdate(versionInfo); err == nil && hasUpdate {
-			version.ShowUpdateWarning(versionInfo, latest, method)
+			version.ShowUpdateWarning(out.Human(), versionInfo, latest, method)
 		}
 	}()
 	
@@ -212,15 +366,41 @@ func runTunnel(cmd *cobra.Command, args []string) error {
 	if len(args) > 0 {
 		// Port provided as argument (e.g., "lrok 8000")
 		portArg := args[0]
+		if strings.Contains(portArg, ",") {
+			// Several ports (e.g., "lrok 8001,8002") share the catch-all route
+			targets, err := proxy.ParseUpstreams(portArg)
+			if err != nil {
+				return fmt.Errorf("invalid ports '%s': %w", portArg, err)
+			}
+			routes = append(routes, "/="+portArg)
+			portArg = targets[0].Port()
+		}
 		var err error
 		port, err = strconv.Atoi(portArg)
 		if err != nil {
 			return fmt.Errorf("invalid port: %s", portArg)
 		}
 	}
+	if err := proxy.ValidateLBStrategy(lbStrategy); err != nil {
+		return err
+	}
+	webhookVerifiers, err := proxy.ParseWebhookVerifiers(verifyWebhooks)
+	if err != nil {
+		return err
+	}
+	if rejectWebhooks && len(webhookVerifiers) == 0 {
+		return fmt.Errorf("--reject-invalid-webhooks requires --verify-webhook")
+	}
+	if holdRequests < 0 || holdRequests > proxy.MaxHold {
+		return fmt.Errorf("--hold-requests must be between 0 and %s", proxy.MaxHold)
+	}
+	limits, err := limitsFromFlags()
+	if err != nil {
+		return err
+	}
 
 	// Validate port
-	if port == 0 {
+	if port == 0 && len(routes) == 0 {
 		return fmt.Errorf(`❌ No port specified!
 
 Usage:
@@ -231,58 +411,20 @@ Usage:
 Run 'lrok --help' for more examples.`)
 	}
 
-	// Get API key with priority: flag > env var > config file
-	var apiKeySource string
-	
-	if apiKey == "" {
-		// Try environment variable
-		apiKey = os.Getenv("LUM_API_KEY")
-		if apiKey == "" {
-			apiKey = os.Getenv("FRP_API_KEY") // Legacy support
-		}
-		if apiKey != "" {
-			apiKeySource = "environment variable"
-		}
-	} else {
-		apiKeySource = "--api-key flag"
-	}
-
-	// Try config file if still not found
-	if apiKey == "" {
-		if key, err := config.GetAPIKey(); err == nil {
-			apiKey = key
-			apiKeySource = "config file (~/.lrok/config.toml)"
+	var tunnelRoutes []proxy.Route
+	if len(routes) > 0 {
+		parsed, err := proxy.ParseRoutes(routes, port)
+		if err != nil {
+			return err
 		}
+		tunnelRoutes = parsed
 	}
 
-	if apiKey == "" {
-		return fmt.Errorf(`❌ No API key configured!
-
-You need a lum.tools platform API key to use lrok.
-
-📝 Get your API key:
-   1. Visit: https://platform.lum.tools/keys
-   2. Login with your account
-   3. Create a new API key
-   4. Copy your API key (starts with 'lum_')
-
-💡 Save it with login command (recommended):
-   lrok login lum_your_api_key_here
-
-Or use environment variable:
-   export LUM_API_KEY='lum_your_api_key_here'
-
-Or pass it directly:
-   lrok 8000 --api-key lum_your_key`)
-	}
-
-	if !strings.HasPrefix(apiKey, "lum_") {
-		fmt.Println("⚠️  Warning: API key should start with 'lum_'")
-		fmt.Println("   Make sure you're using a valid platform API key from https://platform.lum.tools/keys")
+	cred, err := resolveCredential("lrok 8000 --api-key lum_your_key")
+	if err != nil {
+		return err
 	}
-	
-	// Show API key source for transparency (debug mode or verbose)
-	_ = apiKeySource // Used for debugging, currently unused in output
+	apiKey = cred.APIKey
 
 	// Determine subdomain
 	tunnelName := name
@@ -293,27 +435,116 @@ Or pass it directly:
 		tunnelName = names.Generate()
 	}
 
-	tunnelURL := fmt.Sprintf("https://%s.t.lum.tools", tunnelName)
+	// Validate tunnel name
+	if err := tunnel.ValidateTunnelName(tunnelName); err != nil {
+		return fmt.Errorf("invalid tunnel name: %w", err)
+	}
+
+	domainNames, err := normalizeDomains(customDomains)
+	if err != nil {
+		return err
+	}
+
+	if detach {
+		// The agent has its own environment, so OTEL_* is resolved here
+		traceCfg := traceConfig()
+		return submitDetached(agent.Spec{
+			Name:           tunnelName,
+			Type:           "http",
+			LocalPort:      port,
+			LocalIP:        localIP,
+			APIKey:         apiKey,
+			Server:         serverFlag,
+			Region:         regionFlag,
+			SubdomainHost:  subdomainHostFlag,
+			EgressProxy:    egressProxyFlag,
+			Domains:        domainNames,
+			Routes:         routes,
+			LB:             lbStrategy,
+			LBHealthPath:   lbHealthPath,
+			VerifyWebhooks: verifyWebhooks,
+			RejectWebhooks: rejectWebhooks,
+			HoldRequests:   holdRequests,
+			ReadyPath:      readyPath,
+			OTLPEndpoint:   traceCfg.Endpoint,
+			OTLPProtocol:   traceCfg.Protocol,
+			OTLPHeaders:    traceHeaders(traceCfg.Headers),
+			Transport:      transportOptions(),
+			Limits:         limits,
+		})
+	}
+
+	server, err := resolveServer()
+	if err != nil {
+		return err
+	}
+	if err := config.CheckDomains(server, domainNames); err != nil {
+		return err
+	}
+	tunnelURL := server.HTTPURL(tunnelName)
+	if len(domainNames) > 0 {
+		tunnelURL = server.CustomURL(domainNames[0])
+	}
 
 	// Start reverse proxy for request inspection
-	fmt.Println("🔄 Starting request inspector proxy...")
+	out.Println("🔄 Starting request inspector proxy...")
 	prox := proxy.New(port, 100)
+	if len(tunnelRoutes) > 0 {
+		prox = proxy.NewWithRoutes(tunnelRoutes, 100)
+	}
+	prox.SetLoadBalancing(proxy.LBOptions{Strategy: lbStrategy, HealthPath: lbHealthPath})
+	prox.SetWebhookVerifiers(webhookVerifiers, rejectWebhooks)
+	prox.SetHoldRequests(holdRequests)
 	proxyPort, err := prox.Start()
 	if err != nil {
 		return fmt.Errorf("failed to start proxy: %w", err)
 	}
 	defer prox.Stop()
 	
-	fmt.Printf("✅ Proxy ready on port %d (forwarding to %d)\n", proxyPort, port)
+	if len(tunnelRoutes) > 0 {
+		out.Printf("✅ Proxy ready on port %d (routing to %d upstreams)\n", proxyPort, len(tunnelRoutes))
+	} else {
+		out.Printf("✅ Proxy ready on port %d (forwarding to %d)\n", proxyPort, port)
+	}
+
+	traceCfg := traceConfig()
+	// Tracing is optional: a bad setting only disables span export
+	tracer, err := tracing.New(traceCfg)
+	if err != nil {
+		out.Printf("⚠️  Not exporting request spans: %v\n", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tracer.Shutdown(ctx)
+	}()
+	prox.SetTracer(tracer)
+	if tracer.Exporting() {
+		out.Printf("🔭 Exporting request spans to %s\n", traceCfg.Endpoint)
+	}
 
-	// Generate config with proxy port (frpc forwards to proxy, proxy forwards to user app)
+	// Count wire-level traffic and enforce limits in front of the proxy
+	rel, relayPort, err := startRelay(fmt.Sprintf("127.0.0.1:%d", proxyPort), limits, false)
+	if err != nil {
+		return err
+	}
+	defer rel.Close()
+
+	// Generate config with relay port (frpc forwards to relay, relay to proxy, proxy to user app)
 	cfg := &config.TunnelConfig{
 		APIKey:    apiKey,
-		LocalPort: proxyPort,
-		LocalIP:   localIP,
+		LocalPort: relayPort,
+		LocalIP:   "127.0.0.1",
 		Subdomain: tunnelName,
+
+		CustomDomains: domainNames,
+	}
+	server.Apply(cfg)
+	if err := applyProfile(cfg); err != nil {
+		return err
 	}
 
+	cfg.SecretsFromEnv = true
 	configPath, err := config.GenerateTOML(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to generate config: %w", err)
@@ -331,63 +562,231 @@ Or pass it directly:
 	dash := dashboard.New(stats, prox)
 	if err := dash.Start(4242); err != nil {
 		// Dashboard failed to start, continue anyway
-		fmt.Printf("⚠️  Dashboard failed to start: %v\n", err)
+		out.Printf("⚠️  Dashboard failed to start: %v\n", err)
 	} else {
 		defer dash.Stop()
 	}
 
-	fmt.Println("\n🚀 Starting lrok tunnel...")
-	fmt.Println("⏳ Connecting to frp.lum.tools...")
+	out.Println("\n🚀 Starting lrok tunnel...")
+	out.Printf("⏳ Connecting to %s...\n", server.Address())
+	out.Event(output.EventStarting, output.Fields{
+		"type":       "http",
+		"name":       tunnelName,
+		"url":        tunnelURL,
+		"local_port": port,
+	})
 	
 	// Start tunnel
 	mgr := tunnel.New(configPath)
+	mgr.SetEnv(cfg.Env()...)
 	defer mgr.Cleanup()
+	mgr.SetOutput(out.Human(), os.Stderr)
+	dash.SetTunnel(mgr)
+	dash.SetRelay(rel)
+	go watchLimits(rel, mgr, tunnelName)
+	
+	info := control.Info{
+		Name:  tunnelName,
+		Type:  "http",
+		URL:   tunnelURL,
+		Local: localDescription(tunnelRoutes),
+	}
+	if dash.Port() > 0 {
+		info.Dashboard = fmt.Sprintf("http://localhost:%d", dash.Port())
+	}
+	ctl, err := registerInstance(info, relayStatus(mgr, rel), mgr, instanceLogs)
+	if err != nil {
+		return err
+	}
+	defer ctl.Stop()
 	
 	// Start tunnel with graceful shutdown (this is blocking until Ctrl+C)
-	// We'll verify in a separate goroutine
+	// We'll verify in a separate goroutine, without sending traffic to the app
 	go func() {
-		// Wait a bit for tunnel to connect, then verify
-		time.Sleep(3 * time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
 		
-		fmt.Println("🔍 Verifying tunnel...")
-		client := &http.Client{Timeout: 5 * time.Second}
-		verified := false
+		connected := mgr.WaitConnected(ctx) == nil
+		var check verify.Result
+		if connected {
+			out.Println("🔍 Verifying tunnel...")
+			check = verify.Wait(ctx, &http.Client{Timeout: 5 * time.Second}, tunnelURL+proxy.ProbePath, 500*time.Millisecond)
+		}
+		verified := check.OK()
+		appErr := prox.CheckUpstreams(ctx, readyPath)
 		
-		for i := 0; i < 10; i++ {
-			resp, err := client.Get(tunnelURL + "/")
-			if err == nil {
-				resp.Body.Close()
-				if resp.StatusCode == http.StatusOK {
-					verified = true
-					break
-				}
+		out.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		if len(tunnelRoutes) > 0 {
+			for _, route := range prox.Routes() {
+				out.Printf("  📍 Route:      %s%s → %s\n", route.Host, route.Prefix, route.Upstreams())
 			}
-			time.Sleep(500 * time.Millisecond)
+		} else {
+			out.Printf("  📍 Local:      http://%s:%d\n", localIP, port)
+		}
+		if appErr != nil {
+			out.Printf("  ⚠️  App:        not ready (%v)\n", appErr)
+		}
+		out.Printf("  🌐 Public URL: %s\n", tunnelURL)
+		if len(domainNames) > 0 {
+			for _, domain := range domainNames[1:] {
+				out.Printf("  🌐 Also:       %s\n", server.CustomURL(domain))
+			}
+			out.Printf("  🌐 Also:       %s\n", server.HTTPURL(tunnelName))
+		}
+		out.Printf("  🏷️  Name:       %s\n", tunnelName)
+		if server.EgressProxy != "" {
+			out.Printf("  🛡️  Egress:     via %s\n", config.RedactURL(server.EgressProxy))
+		}
+		if server.Transport != (config.TransportConfig{}) {
+			out.Printf("  🔌 Transport:  %s\n", server.Transport)
+		}
+		if len(webhookVerifiers) > 0 {
+			out.Printf("  🔏 Webhooks:   %s\n", webhookDescription(webhookVerifiers, rejectWebhooks))
+		}
+		if holdRequests > 0 {
+			out.Printf("  ⏳ Hold:       requests wait up to %s while the app is down\n", holdRequests)
+		}
+		if desc := limitsDescription(limits); desc != "" {
+			out.Printf("  ⛔ Limits:     %s\n", desc)
 		}
-		
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Printf("  📍 Local:      http://%s:%d\n", localIP, port)
-		fmt.Printf("  🌐 Public URL: %s\n", tunnelURL)
-		fmt.Printf("  🏷️  Name:       %s\n", tunnelName)
 		if dash.Port() > 0 {
-			fmt.Printf("  📊 Dashboard:  http://localhost:%d\n", dash.Port())
+			out.Printf("  📊 Dashboard:  http://localhost:%d\n", dash.Port())
+			out.Printf("  📈 Metrics:    http://localhost:%d/metrics\n", dash.Port())
 		}
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		out.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 		
-	if verified {
-		fmt.Println("\n✅ Tunnel is ready and verified!")
-	} else {
-		fmt.Println("\n⏳ Tunnel is connecting... (may take a few more seconds)")
+	switch {
+	case verified:
+		out.Printf("\n✅ Tunnel is ready and verified! (%s from the edge)\n", check.Latency.Round(time.Millisecond))
+	case connected:
+		out.Printf("\n❌ Tunnel connected, but the public URL failed verification: %s\n", check.Diagnosis)
+		out.Printf("   Re-check any time with: lrok check %s\n", tunnelURL)
+	default:
+		out.Println("\n❌ Tunnel did not connect within 20s; see the frpc output above")
 	}
-	fmt.Println("   Open the dashboard to inspect requests in real-time!")
+	out.Println("   Open the dashboard to inspect requests in real-time!")
+	
+		ready := output.Fields{
+			"type":      "http",
+			"name":      tunnelName,
+			"url":       tunnelURL,
+			"local":     fmt.Sprintf("http://%s:%d", localIP, port),
+			"verified":  verified,
+			"check":     check,
+			"app_ready": appErr == nil,
+		}
+		if len(tunnelRoutes) > 0 {
+			ready["local"] = localDescription(tunnelRoutes)
+			ready["routes"] = routes
+		}
+		if dash.Port() > 0 {
+			ready["dashboard"] = fmt.Sprintf("http://localhost:%d", dash.Port())
+		}
+		if limits != (relay.Limits{}) {
+			ready["limits"] = limits
+		}
+		out.Event(output.EventReady, ready)
+	}()
+
+	err = mgr.StartWithGracefulShutdown()
+	out.Event(output.EventShutdown, output.Fields{"name": tunnelName})
+	return err
+}
+
+// webhookDescription lists the verified webhook providers for the banner
+func webhookDescription(verifiers []proxy.WebhookVerifier, reject bool) string {
+	providers := make([]string, len(verifiers))
+	for i, v := range verifiers {
+		providers[i] = v.Provider
+	}
+	desc := strings.Join(providers, ", ") + " signatures checked"
+	if reject {
+		desc += ", invalid rejected"
+	}
+	return desc
+}
+
+// traceConfig resolves span export settings: flags override the standard
+// OTEL_* environment variables
+func traceConfig() tracing.Config {
+	cfg := tracing.ConfigFromEnv()
+	if otlpEndpoint != "" {
+		cfg.Endpoint = tracing.TracesURL(otlpEndpoint)
+	}
+	if otlpProtocol != "" {
+		cfg.Protocol = otlpProtocol
+	}
+	for k, v := range tracing.ParseHeaders(strings.Join(otlpHeaders, ",")) {
+		cfg.Headers[k] = v
+	}
+	return cfg
+}
+
+// traceHeaders turns collector headers back into sorted key=value pairs
+func traceHeaders(headers map[string]string) []string {
+	pairs := make([]string, 0, len(headers))
+	for k, v := range headers {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// localDescription summarizes where an HTTP tunnel forwards to
+func localDescription(tunnelRoutes []proxy.Route) string {
+	if len(tunnelRoutes) == 0 {
+		return fmt.Sprintf("%s:%d", localIP, port)
+	}
+	parts := make([]string, len(tunnelRoutes))
+	for i, route := range tunnelRoutes {
+		parts[i] = route.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// runManaged runs a tunnel until shutdown, emitting a ready event once frpc
+// reports the proxy as started and a shutdown event when it exits. rel, the
+// tunnel's counting relay, is nil for visitors without --inspect.
+func runManaged(mgr *tunnel.Manager, rel *relay.Relay, info control.Info, fields output.Fields) error {
+	mgr.SetOutput(out.Human(), os.Stderr)
+	if rel != nil {
+		go watchLimits(rel, mgr, info.Name)
+	}
+
+	ctl, err := registerInstance(info, relayStatus(mgr, rel), mgr, instanceLogs)
+	if err != nil {
+		return err
+	}
+	defer ctl.Stop()
+
+	out.Event(output.EventStarting, fields)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if mgr.State() == tunnel.StateConnected {
+					out.Event(output.EventReady, fields)
+					return
+				}
+			}
+		}
 	}()
 
-	return mgr.StartWithGracefulShutdown()
+	err = mgr.StartWithGracefulShutdown()
+	out.Event(output.EventShutdown, output.Fields{"name": info.Name})
+	return err
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		out.Error(err)
 		os.Exit(1)
 	}
 }
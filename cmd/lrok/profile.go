@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+var profileName string
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage API key profiles",
+	Long: `Manage named profiles in ~/.lrok/config.toml.
+
+Each profile has its own API key and optional defaults (server, region,
+organization and tunnel options). The active profile is chosen by
+--profile, then LROK_PROFILE, then 'lrok profile use', then "default".
+
+Examples:
+  lrok login lum_team_key --profile work   # Create the "work" profile
+  lrok --profile work 8000                 # Use it for one tunnel
+  lrok profile use work                    # Make it the default
+  lrok profile set work region=eu compression=true`,
+}
+
+var profileListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List profiles",
+	Args:    cobra.NoArgs,
+	RunE:    runProfileList,
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Make a profile the default",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runProfileUse,
+}
+
+var profileRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a profile",
+	Args:    cobra.ExactArgs(1),
+	RunE:    runProfileRemove,
+}
+
+var profileSetCmd = &cobra.Command{
+	Use:   "set <name> <key=value>...",
+	Short: "Set profile defaults",
+	Long: `Set defaults on a profile, creating it if needed. An empty value clears a setting.
+
+Keys:
+  api_key_command   command printing the API key, e.g. "pass show lum/work"
+  organization      organization context shown in whoami
+  server            tunnel server as host or host:port
+  region            preferred region, or "auto" for the closest defined one
+  subdomain_host    public domain for HTTP tunnels on a custom server
+  bandwidth_limit   e.g. 1MB, 500KB
+  encryption        true/false
+  compression       true/false
+  health_check      tcp or http
+
+Server connection (see also the --transport flags):
+  transport                   tcp, websocket, wss, quic or kcp
+  disable_tls                 true to connect without TLS
+  pool_count                  connections to open in advance
+  heartbeat_interval          seconds between heartbeats, -1 to disable
+  heartbeat_timeout           seconds without a heartbeat reply before reconnecting
+  disable_tcp_mux             true to open a server connection per stream
+  tcp_mux_keepalive_interval  seconds between TCP mux keepalives
+
+Self-hosted frps (lrok profile set corp self_hosted=true server=frps.corp:7000 ...):
+  self_hosted              true to use frps native auth instead of a lum.tools key
+  auth_method              token or oidc
+  auth_token               frps auth token (or set LROK_AUTH_TOKEN)
+  oidc_client_id           OIDC client ID
+  oidc_client_secret       OIDC client secret
+  oidc_audience            OIDC audience
+  oidc_scope               OIDC scope
+  oidc_token_endpoint_url  OIDC token endpoint
+  tls                      true to connect to frps over TLS
+  tls_ca_file              CA certificate trusted for the server
+  tls_cert_file            client certificate for mutual TLS
+  tls_key_file             client certificate key
+  tls_server_name          server name to verify
+  url_template             public URL of HTTP tunnels, e.g. http://{name}.{domain}:8080`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runProfileSet,
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "Config profile to use (or set LROK_PROFILE)")
+
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileUseCmd)
+	profileCmd.AddCommand(profileRemoveCmd)
+	profileCmd.AddCommand(profileSetCmd)
+
+	rootCmd.AddCommand(profileCmd)
+}
+
+// applyProfile fills unset tunnel options from the active profile
+func applyProfile(cfg *config.TunnelConfig) error {
+	profile, _, err := config.GetActiveProfile()
+	if err != nil {
+		return err
+	}
+	return profile.ApplyDefaults(cfg)
+}
+
+func runProfileList(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	active := cfg.ActiveProfileName()
+	names := cfg.ProfileNames()
+
+	if out.JSON() {
+		out.Event("profiles", output.Fields{"active": active, "profiles": names})
+		return nil
+	}
+
+	if len(names) == 0 {
+		out.Println("No profiles configured")
+		out.Println("   Create one with: lrok login <api-key> [--profile name]")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out.Human(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tNAME\tAPI KEY\tORGANIZATION\tSERVER\tREGION")
+	for _, name := range names {
+		p, _ := cfg.Profile(name)
+		marker := ""
+		if name == active {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", marker, name, keyColumn(p), dash(p.Organization), dash(p.Server), dash(p.Region))
+	}
+	return w.Flush()
+}
+
+func runProfileUse(cmd *cobra.Command, args []string) error {
+	if err := config.UseProfile(args[0]); err != nil {
+		return err
+	}
+	out.Event("profile_use", output.Fields{"profile": args[0]})
+	out.Printf("✅ Now using profile '%s'\n", args[0])
+	return nil
+}
+
+func runProfileRemove(cmd *cobra.Command, args []string) error {
+	if err := config.RemoveProfile(args[0]); err != nil {
+		return err
+	}
+	out.Event("profile_remove", output.Fields{"profile": args[0]})
+	out.Printf("✅ Removed profile '%s'\n", args[0])
+	return nil
+}
+
+func runProfileSet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	p := cfg.EnsureProfile(args[0])
+
+	for _, pair := range args[1:] {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid setting '%s' (expected key=value)", pair)
+		}
+		if err := setProfileValue(p, key, value); err != nil {
+			return err
+		}
+	}
+
+	if err := config.SaveConfig(cfg); err != nil {
+		return err
+	}
+	out.Event("profile_set", output.Fields{"profile": args[0]})
+	out.Printf("✅ Updated profile '%s'\n", args[0])
+	return nil
+}
+
+// setProfileValue validates and applies one key=value setting
+func setProfileValue(p *config.Profile, key, value string) error {
+	parseBool := func() (bool, error) {
+		if value == "" {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s value '%s' (expected true/false)", key, value)
+		}
+		return b, nil
+	}
+	parseInt := func() (int, error) {
+		if value == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s value '%s' (expected a number)", key, value)
+		}
+		return n, nil
+	}
+
+	switch key {
+	case "api_key_command":
+		p.APIKeyCommand = value
+	case "organization":
+		p.Organization = value
+	case "server":
+		if value != "" {
+			if _, err := config.ParseServer(value); err != nil {
+				return err
+			}
+		}
+		p.Server = value
+	case "region":
+		p.Region = value
+	case "subdomain_host":
+		p.SubdomainHost = value
+	case "bandwidth_limit":
+		if value != "" {
+			if err := tunnel.ValidateBandwidthLimit(value); err != nil {
+				return fmt.Errorf("invalid bandwidth limit: %w", err)
+			}
+		}
+		p.Defaults.BandwidthLimit = value
+	case "encryption":
+		b, err := parseBool()
+		if err != nil {
+			return err
+		}
+		p.Defaults.UseEncryption = b
+	case "compression":
+		b, err := parseBool()
+		if err != nil {
+			return err
+		}
+		p.Defaults.UseCompression = b
+	case "health_check":
+		if err := tunnel.ValidateHealthCheckType(value); err != nil {
+			return err
+		}
+		p.Defaults.HealthCheck = value
+	case "transport", "disable_tls", "pool_count", "heartbeat_interval", "heartbeat_timeout", "disable_tcp_mux", "tcp_mux_keepalive_interval":
+		t := p.Transport
+		var err error
+		switch key {
+		case "transport":
+			t.Protocol = value
+		case "disable_tls":
+			t.DisableTLS, err = parseBool()
+		case "pool_count":
+			t.PoolCount, err = parseInt()
+		case "heartbeat_interval":
+			t.HeartbeatInterval, err = parseInt()
+		case "heartbeat_timeout":
+			t.HeartbeatTimeout, err = parseInt()
+		case "disable_tcp_mux":
+			t.DisableTCPMux, err = parseBool()
+		case "tcp_mux_keepalive_interval":
+			t.TCPMuxKeepalive, err = parseInt()
+		}
+		if err != nil {
+			return err
+		}
+		if err := tunnel.ValidateTransport(t); err != nil {
+			return err
+		}
+		p.Transport = t
+	case "self_hosted":
+		b, err := parseBool()
+		if err != nil {
+			return err
+		}
+		p.SelfHosted.Enabled = b
+	case "auth_method":
+		if value != "" && value != config.AuthMethodToken && value != config.AuthMethodOIDC {
+			return fmt.Errorf("invalid auth method '%s', must be one of: token, oidc", value)
+		}
+		p.SelfHosted.Auth.Method = value
+	case "auth_token":
+		p.SelfHosted.Auth.Token = value
+	case "oidc_client_id":
+		p.SelfHosted.Auth.OIDCClientID = value
+	case "oidc_client_secret":
+		p.SelfHosted.Auth.OIDCClientSecret = value
+	case "oidc_audience":
+		p.SelfHosted.Auth.OIDCAudience = value
+	case "oidc_scope":
+		p.SelfHosted.Auth.OIDCScope = value
+	case "oidc_token_endpoint_url":
+		p.SelfHosted.Auth.OIDCTokenURL = value
+	case "tls":
+		b, err := parseBool()
+		if err != nil {
+			return err
+		}
+		p.SelfHosted.TLS.Enable = b
+	case "tls_ca_file":
+		p.SelfHosted.TLS.CAFile = value
+	case "tls_cert_file":
+		p.SelfHosted.TLS.CertFile = value
+	case "tls_key_file":
+		p.SelfHosted.TLS.KeyFile = value
+	case "tls_server_name":
+		p.SelfHosted.TLS.ServerName = value
+	case "url_template":
+		if value != "" {
+			if err := config.ValidateURLTemplate(value); err != nil {
+				return err
+			}
+		}
+		p.SelfHosted.URLTemplate = value
+	default:
+		return fmt.Errorf("unknown profile setting '%s'", key)
+	}
+	return nil
+}
+
+// keyColumn describes where a profile's key comes from without revealing it
+func keyColumn(p *config.Profile) string {
+	switch {
+	case p.SelfHosted.Enabled:
+		return "(self-hosted)"
+	case p.APIKey != "":
+		return maskKey(p.APIKey)
+	case p.APIKeyCommand != "":
+		return "(command)"
+	case p.KeyStore != "":
+		return "(" + p.KeyStore + ")"
+	}
+	return "-"
+}
+
+// maskKey shows only the start and end of an API key
+func maskKey(key string) string {
+	if key == "" {
+		return "-"
+	}
+	if len(key) > 16 {
+		return key[:16] + "..." + key[len(key)-4:]
+	}
+	return key
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/lum-tools/lrok/internal/version"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverFlag        string
+	regionFlag        string
+	subdomainHostFlag string
+	urlTemplateFlag   string
+	egressProxyFlag   string
+
+	transportFlag     string
+	transportTLS      bool
+	poolCount         int
+	heartbeatInterval int
+	heartbeatTimeout  int
+	tcpMux            bool
+	tcpMuxKeepalive   int
+
+	// flagChanged tells explicit transport flags from their defaults
+	flagChanged func(name string) bool
+)
+
+var regionsCmd = &cobra.Command{
+	Use:   "regions",
+	Short: "List tunnel server regions and their latency",
+	Long: `List the built-in regions and any defined under [regions.<name>] in
+~/.lrok/config.toml, probing each for connect latency.
+
+Select one with --region <name> (or LROK_REGION). Once config.toml defines
+regions, --region auto picks the closest of them and the built-in one.
+--server host[:port] (or LROK_SERVER) points lrok at any frps.`,
+	Args: cobra.NoArgs,
+	RunE: runRegions,
+}
+
+func init() {
+	flagChanged = rootCmd.PersistentFlags().Changed
+	rootCmd.PersistentFlags().StringVar(&serverFlag, "server", "", "Tunnel server as host[:port] (or set LROK_SERVER)")
+	rootCmd.PersistentFlags().StringVar(&regionFlag, "region", "", "Server region, or 'auto' for the closest of the regions in config.toml (or set LROK_REGION)")
+	rootCmd.PersistentFlags().StringVar(&subdomainHostFlag, "subdomain-host", "", "Public domain of HTTP tunnels on a custom server (or set LROK_SUBDOMAIN_HOST)")
+	rootCmd.PersistentFlags().StringVar(&urlTemplateFlag, "url-template", "", "Public URL of HTTP tunnels, e.g. http://{name}.{domain}:8080 (or set LROK_URL_TEMPLATE)")
+	rootCmd.PersistentFlags().StringVar(&egressProxyFlag, "egress-proxy", "", "Reach the tunnel server through an http://, socks5:// or ntlm:// proxy, or 'none' (default: HTTPS_PROXY/ALL_PROXY)")
+
+	rootCmd.PersistentFlags().StringVar(&transportFlag, "transport", "", "Protocol to reach the tunnel server: tcp, websocket, wss, quic or kcp (or set LROK_TRANSPORT)")
+	rootCmd.PersistentFlags().BoolVar(&transportTLS, "transport-tls", true, "Encrypt the server connection with TLS (--transport-tls=false for servers without it)")
+	rootCmd.PersistentFlags().IntVar(&poolCount, "pool-count", 0, "Server connections to open in advance, for faster first requests")
+	rootCmd.PersistentFlags().IntVar(&heartbeatInterval, "heartbeat-interval", 0, "Seconds between heartbeats to the server, -1 to disable")
+	rootCmd.PersistentFlags().IntVar(&heartbeatTimeout, "heartbeat-timeout", 0, "Seconds without a heartbeat reply before reconnecting")
+	rootCmd.PersistentFlags().BoolVar(&tcpMux, "tcp-mux", true, "Multiplex tunnel traffic over one server connection (--tcp-mux=false to disable)")
+	rootCmd.PersistentFlags().IntVar(&tcpMuxKeepalive, "tcp-mux-keepalive", 0, "Seconds between TCP mux keepalives")
+
+	rootCmd.AddCommand(regionsCmd)
+}
+
+// transportOptions collects the transport flags; unset flags keep the
+// settings from the profile or region
+func transportOptions() config.TransportConfig {
+	return config.TransportConfig{
+		Protocol:          transportFlag,
+		DisableTLS:        !transportTLS,
+		EnableTLS:         transportTLS && flagChanged("transport-tls"),
+		PoolCount:         poolCount,
+		HeartbeatInterval: heartbeatInterval,
+		HeartbeatTimeout:  heartbeatTimeout,
+		DisableTCPMux:     !tcpMux,
+		EnableTCPMux:      tcpMux && flagChanged("tcp-mux"),
+		TCPMuxKeepalive:   tcpMuxKeepalive,
+	}
+}
+
+// resolveServer picks the tunnel server from flags, environment and profile
+func resolveServer() (*config.Server, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server, err := config.ResolveServer(ctx, config.ServerOptions{
+		Server:        serverFlag,
+		Region:        regionFlag,
+		SubdomainHost: subdomainHostFlag,
+
+		URLTemplate: urlTemplateFlag,
+		EgressProxy: egressProxyFlag,
+		Transport:   transportOptions(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select server: %w", err)
+	}
+	if err := tunnel.ValidateTransport(server.Transport); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// useEgressProxy sends update checks through the tunnels' egress proxy
+func useEgressProxy() {
+	if u, _, err := config.ResolveEgressProxy(egressProxyFlag, "api.github.com", os.Getenv); err == nil {
+		version.SetProxy(u)
+	}
+}
+
+func runRegions(cmd *cobra.Command, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results := config.ProbeRegions(ctx, cfg.AllRegions(), 2*time.Second)
+
+	if out.JSON() {
+		out.Event("regions", output.Fields{"regions": results})
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out.Human(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REGION\tSERVER\tDOMAIN\tLATENCY")
+	for _, r := range results {
+		latency := r.Latency.Round(time.Millisecond).String()
+		if r.Error != "" {
+			latency = "unreachable"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Region, r.Server.Address(), r.Server.Domain, latency)
+	}
+	return w.Flush()
+}
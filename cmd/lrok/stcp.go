@@ -2,12 +2,12 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"strconv"
-	"strings"
 
 	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/control"
 	"github.com/lum-tools/lrok/internal/names"
+	"github.com/lum-tools/lrok/internal/output"
 	"github.com/lum-tools/lrok/internal/tunnel"
 	"github.com/spf13/cobra"
 )
@@ -50,6 +50,8 @@ func init() {
 	stcpCmd.Flags().BoolVar(&stcpEncrypt, "encrypt", false, "Enable encryption")
 	stcpCmd.Flags().BoolVar(&stcpCompress, "compress", false, "Enable compression")
 	stcpCmd.Flags().StringVar(&stcpBandwidthLimit, "bandwidth", "", "Bandwidth limit (e.g., 1MB, 500KB)")
+	addLimitFlags(stcpCmd)
+	addInspectFlag(stcpCmd)
 	
 	// Mark secret-key as required
 	stcpCmd.MarkFlagRequired("secret-key")
@@ -79,46 +81,11 @@ func runSTCPTunnel(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Get API key with priority: flag > env var > config file
-	if apiKey == "" {
-		apiKey = os.Getenv("LUM_API_KEY")
-		if apiKey == "" {
-			apiKey = os.Getenv("FRP_API_KEY") // Legacy support
-		}
-	}
-
-	// Try config file if still not found
-	if apiKey == "" {
-		if key, err := config.GetAPIKey(); err == nil {
-			apiKey = key
-		}
-	}
-
-	if apiKey == "" {
-		return fmt.Errorf(`❌ No API key configured!
-
-You need a lum.tools platform API key to use lrok.
-
-📝 Get your API key:
-   1. Visit: https://platform.lum.tools/keys
-   2. Login with your account
-   3. Create a new API key
-   4. Copy your API key (starts with 'lum_')
-
-💡 Save it with login command (recommended):
-   lrok login lum_your_api_key_here
-
-Or use environment variable:
-   export LUM_API_KEY='lum_your_api_key_here'
-
-Or pass it directly:
-   lrok stcp 5432 --secret-key my-secret --api-key lum_your_key`)
-	}
-
-	if !strings.HasPrefix(apiKey, "lum_") {
-		fmt.Println("⚠️  Warning: API key should start with 'lum_'")
-		fmt.Println("   Make sure you're using a valid platform API key from https://platform.lum.tools/keys")
+	cred, err := resolveCredential("lrok stcp 5432 --secret-key my-secret --api-key lum_your_key")
+	if err != nil {
+		return err
 	}
+	apiKey = cred.APIKey
 
 	// Determine tunnel name
 	tunnelName := name
@@ -134,11 +101,21 @@ Or pass it directly:
 		return fmt.Errorf("invalid tunnel name: %w", err)
 	}
 
-	// Generate config
+	limits, err := limitsFromFlags()
+	if err != nil {
+		return err
+	}
+	rel, relayPort, err := startRelay(fmt.Sprintf("%s:%d", localIP, localPort), limits, inspecting())
+	if err != nil {
+		return err
+	}
+	defer rel.Close()
+
+	// Generate config; frpc forwards to the relay, which counts traffic
 	cfg := &config.TunnelConfig{
 		APIKey:         apiKey,
-		LocalPort:      localPort,
-		LocalIP:        localIP,
+		LocalPort:      relayPort,
+		LocalIP:        "127.0.0.1",
 		Subdomain:      tunnelName,
 		ProxyType:      "stcp",
 		SecretKey:      stcpSecretKey,
@@ -147,38 +124,73 @@ Or pass it directly:
 		UseCompression: stcpCompress,
 	}
 
+	if inspecting() {
+		cfg.ProxyProtocol = "v2"
+	}
+
+	server, err := resolveServer()
+	if err != nil {
+		return err
+	}
+	server.Apply(cfg)
+	if err := applyProfile(cfg); err != nil {
+		return err
+	}
+
+	cfg.SecretsFromEnv = true
 	configPath, err := config.GenerateTOML(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to generate config: %w", err)
 	}
 
-	fmt.Println("🚀 Starting Secret TCP tunnel...")
-	fmt.Println("⏳ Connecting to frp.lum.tools...")
-	fmt.Printf("📍 Local:      %s:%d\n", localIP, localPort)
-	fmt.Printf("🏷️  Name:       %s\n", tunnelName)
+	out.Println("🚀 Starting Secret TCP tunnel...")
+	out.Printf("⏳ Connecting to %s...\n", server.Address())
+	out.Printf("📍 Local:      %s:%d\n", localIP, localPort)
+	out.Printf("🏷️  Name:       %s\n", tunnelName)
 	secretDisplay := stcpSecretKey
 	if len(secretDisplay) > 8 {
 		secretDisplay = secretDisplay[:8]
 	}
-	fmt.Printf("🔐 Secret:     %s...\n", secretDisplay)
+	out.Printf("🔐 Secret:     %s...\n", secretDisplay)
 	if stcpEncrypt {
-		fmt.Println("🔒 Encryption: enabled")
+		out.Println("🔒 Encryption: enabled")
 	}
 	if stcpCompress {
-		fmt.Println("🗜️  Compression: enabled")
+		out.Println("🗜️  Compression: enabled")
 	}
 	if stcpBandwidthLimit != "" {
-		fmt.Printf("📊 Bandwidth: %s\n", stcpBandwidthLimit)
+		out.Printf("📊 Bandwidth: %s\n", stcpBandwidthLimit)
 	}
-	fmt.Println()
-	fmt.Println("ℹ️  This tunnel requires a visitor with the secret key to access")
-	fmt.Println("   Use 'lrok visitor' command on the client side")
-	fmt.Println()
+	if desc := limitsDescription(limits); desc != "" {
+		out.Printf("⛔ Limits:     %s\n", desc)
+	}
+	out.Println()
+	out.Println("ℹ️  This tunnel requires a visitor with the secret key to access")
+	out.Println("   Use 'lrok visitor' command on the client side")
+	out.Println()
 
 	// Start tunnel
 	mgr := tunnel.New(configPath)
+	mgr.SetEnv(cfg.Env()...)
 	defer mgr.Cleanup()
 
-	return mgr.StartWithGracefulShutdown()
+	info := control.Info{
+		Name:  tunnelName,
+		Type:  "stcp",
+		Local: fmt.Sprintf("%s:%d", localIP, localPort),
+	}
+	if dash := startInspector(rel, tunnelName, "lrok visitor "+tunnelName+" --type stcp", localPort, mgr); dash != nil {
+		defer dash.Stop()
+		info.Dashboard = fmt.Sprintf("http://localhost:%d", dash.Port())
+	}
+	fields := output.Fields{
+		"type":  "stcp",
+		"name":  tunnelName,
+		"local": fmt.Sprintf("%s:%d", localIP, localPort),
+	}
+	if info.Dashboard != "" {
+		fields["dashboard"] = info.Dashboard
+	}
+	return runManaged(mgr, rel, info, fields)
 }
 
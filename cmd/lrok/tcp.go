@@ -2,12 +2,12 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"strconv"
-	"strings"
 
 	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/control"
 	"github.com/lum-tools/lrok/internal/names"
+	"github.com/lum-tools/lrok/internal/output"
 	"github.com/lum-tools/lrok/internal/tunnel"
 	"github.com/spf13/cobra"
 )
@@ -33,6 +33,11 @@ Examples:
   lrok tcp 22 --remote-port 10002      # Expose SSH on port 10002
   lrok tcp 6379 --remote-port 10003    # Expose Redis on port 10003
   lrok tcp 3000 --remote-port 10004 --encrypt --compress  # With encryption and compression
+  lrok tcp 5432 --remote-port 10001 --decode  # See logins and queries in the dashboard
+
+Inspection:
+  --inspect records every connection on the local dashboard; --decode also
+  recognises Postgres, MySQL, Redis, TLS (SNI/ALPN) and SSH traffic.
 
 Connection:
   Connect to: frp.lum.tools:<remote-port>
@@ -51,6 +56,8 @@ func init() {
 	tcpCmd.Flags().BoolVar(&tcpCompress, "compress", false, "Enable compression")
 	tcpCmd.Flags().BoolVar(&tcpHealthCheck, "health-check", false, "Enable TCP health checks")
 	tcpCmd.Flags().StringVar(&tcpBandwidthLimit, "bandwidth", "", "Bandwidth limit (e.g., 1MB, 500KB)")
+	addLimitFlags(tcpCmd)
+	addInspectFlag(tcpCmd)
 	
 	// Mark remote-port as required
 	tcpCmd.MarkFlagRequired("remote-port")
@@ -80,46 +87,11 @@ func runTCPTunnel(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Get API key with priority: flag > env var > config file
-	if apiKey == "" {
-		apiKey = os.Getenv("LUM_API_KEY")
-		if apiKey == "" {
-			apiKey = os.Getenv("FRP_API_KEY") // Legacy support
-		}
-	}
-
-	// Try config file if still not found
-	if apiKey == "" {
-		if key, err := config.GetAPIKey(); err == nil {
-			apiKey = key
-		}
-	}
-
-	if apiKey == "" {
-		return fmt.Errorf(`❌ No API key configured!
-
-You need a lum.tools platform API key to use lrok.
-
-📝 Get your API key:
-   1. Visit: https://platform.lum.tools/keys
-   2. Login with your account
-   3. Create a new API key
-   4. Copy your API key (starts with 'lum_')
-
-💡 Save it with login command (recommended):
-   lrok login lum_your_api_key_here
-
-Or use environment variable:
-   export LUM_API_KEY='lum_your_api_key_here'
-
-Or pass it directly:
-   lrok tcp 5432 --remote-port 10001 --api-key lum_your_key`)
-	}
-
-	if !strings.HasPrefix(apiKey, "lum_") {
-		fmt.Println("⚠️  Warning: API key should start with 'lum_'")
-		fmt.Println("   Make sure you're using a valid platform API key from https://platform.lum.tools/keys")
+	cred, err := resolveCredential("lrok tcp 5432 --remote-port 10001 --api-key lum_your_key")
+	if err != nil {
+		return err
 	}
+	apiKey = cred.APIKey
 
 	// Determine tunnel name
 	tunnelName := name
@@ -141,11 +113,21 @@ Or pass it directly:
 		healthCheckType = "tcp"
 	}
 
-	// Generate config
+	limits, err := limitsFromFlags()
+	if err != nil {
+		return err
+	}
+	rel, relayPort, err := startRelay(fmt.Sprintf("%s:%d", localIP, localPort), limits, inspecting())
+	if err != nil {
+		return err
+	}
+	defer rel.Close()
+
+	// Generate config; frpc forwards to the relay, which counts traffic
 	cfg := &config.TunnelConfig{
 		APIKey:          apiKey,
-		LocalPort:       localPort,
-		LocalIP:         localIP,
+		LocalPort:       relayPort,
+		LocalIP:         "127.0.0.1",
 		Subdomain:       tunnelName,
 		ProxyType:       "tcp",
 		RemotePort:      tcpRemotePort,
@@ -155,33 +137,71 @@ Or pass it directly:
 		HealthCheckType: healthCheckType,
 	}
 
+	if inspecting() {
+		cfg.ProxyProtocol = "v2"
+	}
+
+	server, err := resolveServer()
+	if err != nil {
+		return err
+	}
+	server.Apply(cfg)
+	if err := applyProfile(cfg); err != nil {
+		return err
+	}
+
+	cfg.SecretsFromEnv = true
 	configPath, err := config.GenerateTOML(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to generate config: %w", err)
 	}
 
-	fmt.Println("🚀 Starting TCP tunnel...")
-	fmt.Println("⏳ Connecting to frp.lum.tools...")
-	fmt.Printf("📍 Local:      %s:%d\n", localIP, localPort)
-	fmt.Printf("🌐 Remote:     frp.lum.tools:%d\n", tcpRemotePort)
-	fmt.Printf("🏷️  Name:       %s\n", tunnelName)
+	out.Println("🚀 Starting TCP tunnel...")
+	out.Printf("⏳ Connecting to %s...\n", server.Address())
+	out.Printf("📍 Local:      %s:%d\n", localIP, localPort)
+	out.Printf("🌐 Remote:     %s\n", server.TCPAddress(tcpRemotePort))
+	out.Printf("🏷️  Name:       %s\n", tunnelName)
 	if tcpEncrypt {
-		fmt.Println("🔒 Encryption: enabled")
+		out.Println("🔒 Encryption: enabled")
 	}
 	if tcpCompress {
-		fmt.Println("🗜️  Compression: enabled")
+		out.Println("🗜️  Compression: enabled")
 	}
 	if tcpHealthCheck {
-		fmt.Println("💓 Health check: enabled")
+		out.Println("💓 Health check: enabled")
 	}
 	if tcpBandwidthLimit != "" {
-		fmt.Printf("📊 Bandwidth: %s\n", tcpBandwidthLimit)
+		out.Printf("📊 Bandwidth: %s\n", tcpBandwidthLimit)
 	}
-	fmt.Println()
+	if desc := limitsDescription(limits); desc != "" {
+		out.Printf("⛔ Limits:     %s\n", desc)
+	}
+	out.Println()
 
 	// Start tunnel
 	mgr := tunnel.New(configPath)
+	mgr.SetEnv(cfg.Env()...)
 	defer mgr.Cleanup()
 
-	return mgr.StartWithGracefulShutdown()
+	info := control.Info{
+		Name:  tunnelName,
+		Type:  "tcp",
+		URL:   "tcp://" + server.TCPAddress(tcpRemotePort),
+		Local: fmt.Sprintf("%s:%d", localIP, localPort),
+	}
+	if dash := startInspector(rel, tunnelName, info.URL, localPort, mgr); dash != nil {
+		defer dash.Stop()
+		info.Dashboard = fmt.Sprintf("http://localhost:%d", dash.Port())
+	}
+	fields := output.Fields{
+		"type":        "tcp",
+		"name":        tunnelName,
+		"local":       fmt.Sprintf("%s:%d", localIP, localPort),
+		"remote":      server.TCPAddress(tcpRemotePort),
+		"remote_port": tcpRemotePort,
+	}
+	if info.Dashboard != "" {
+		fields["dashboard"] = info.Dashboard
+	}
+	return runManaged(mgr, rel, info, fields)
 }
@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/control"
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/lum-tools/lrok/internal/relay"
 	"github.com/lum-tools/lrok/internal/tunnel"
 	"github.com/spf13/cobra"
 )
@@ -42,6 +44,7 @@ func init() {
 	visitorCmd.Flags().IntVar(&visitorBindPort, "bind-port", 0, "Local port to bind to (required)")
 	visitorCmd.Flags().StringVar(&visitorBindAddr, "bind-addr", "127.0.0.1", "Local address to bind to")
 	visitorCmd.Flags().StringVarP(&apiKey, "api-key", "k", "", "lum.tools platform API key")
+	addInspectFlag(visitorCmd)
 	
 	// Mark required flags
 	visitorCmd.MarkFlagRequired("type")
@@ -72,90 +75,103 @@ func runVisitor(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid bind port: %w", err)
 	}
 
-	// Get API key with priority: flag > env var > config file
-	if apiKey == "" {
-		apiKey = os.Getenv("LUM_API_KEY")
-		if apiKey == "" {
-			apiKey = os.Getenv("FRP_API_KEY") // Legacy support
-		}
-	}
-
-	// Try config file if still not found
-	if apiKey == "" {
-		if key, err := config.GetAPIKey(); err == nil {
-			apiKey = key
-		}
-	}
-
-	if apiKey == "" {
-		return fmt.Errorf(`❌ No API key configured!
-
-You need a lum.tools platform API key to use lrok.
-
-📝 Get your API key:
-   1. Visit: https://platform.lum.tools/keys
-   2. Login with your account
-   3. Create a new API key
-   4. Copy your API key (starts with 'lum_')
-
-💡 Save it with login command (recommended):
-   lrok login lum_your_api_key_here
-
-Or use environment variable:
-   export LUM_API_KEY='lum_your_api_key_here'
-
-Or pass it directly:
-   lrok visitor my-tunnel --type stcp --secret-key my-secret --bind-port 5432 --api-key lum_your_key`)
-	}
-
-	if !strings.HasPrefix(apiKey, "lum_") {
-		fmt.Println("⚠️  Warning: API key should start with 'lum_'")
-		fmt.Println("   Make sure you're using a valid platform API key from https://platform.lum.tools/keys")
+	cred, err := resolveCredential("lrok visitor my-tunnel --type stcp --secret-key my-secret --bind-port 5432 --api-key lum_your_key")
+	if err != nil {
+		return err
 	}
+	apiKey = cred.APIKey
 
 	// Validate tunnel name
 	if err := tunnel.ValidateTunnelName(tunnelName); err != nil {
 		return fmt.Errorf("invalid tunnel name: %w", err)
 	}
 
+	// With --inspect the relay takes the bind address and frpc binds a
+	// private port behind it
+	frpcBindAddr, frpcBindPort := visitorBindAddr, visitorBindPort
+	var rel *relay.Relay
+	if inspecting() {
+		if frpcBindPort, err = freeLocalPort(); err != nil {
+			return err
+		}
+		frpcBindAddr = "127.0.0.1"
+		rel = relay.New(fmt.Sprintf("%s:%d", frpcBindAddr, frpcBindPort), relay.Limits{})
+		if err := inspectRelay(rel); err != nil {
+			return err
+		}
+		if _, err := rel.StartOn(fmt.Sprintf("%s:%d", visitorBindAddr, visitorBindPort)); err != nil {
+			return err
+		}
+		defer rel.Close()
+	}
+
 	// Generate visitor config
 	cfg := &config.TunnelConfig{
 		APIKey:     apiKey,
 		Subdomain:  tunnelName,
 		ProxyType:  visitorType,
 		SecretKey:  visitorSecretKey,
-		LocalPort:  visitorBindPort,
-		LocalIP:    visitorBindAddr,
+		LocalPort:  frpcBindPort,
+		LocalIP:    frpcBindAddr,
 	}
 
+	server, err := resolveServer()
+	if err != nil {
+		return err
+	}
+	server.Apply(cfg)
+	if err := applyProfile(cfg); err != nil {
+		return err
+	}
+
+	cfg.SecretsFromEnv = true
 	configPath, err := config.GenerateVisitorTOML(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to generate visitor config: %w", err)
 	}
 
-	fmt.Printf("🚀 Starting %s visitor...\n", strings.ToUpper(visitorType))
-	fmt.Println("⏳ Connecting to frp.lum.tools...")
-	fmt.Printf("🔗 Tunnel:     %s\n", tunnelName)
-	fmt.Printf("📍 Local:      %s:%d\n", visitorBindAddr, visitorBindPort)
+	out.Printf("🚀 Starting %s visitor...\n", strings.ToUpper(visitorType))
+	out.Printf("⏳ Connecting to %s...\n", server.Address())
+	out.Printf("🔗 Tunnel:     %s\n", tunnelName)
+	out.Printf("📍 Local:      %s:%d\n", visitorBindAddr, visitorBindPort)
 	secretDisplay := visitorSecretKey
 	if len(secretDisplay) > 8 {
 		secretDisplay = secretDisplay[:8]
 	}
-	fmt.Printf("🔐 Secret:     %s...\n", secretDisplay)
-	fmt.Println()
+	out.Printf("🔐 Secret:     %s...\n", secretDisplay)
+	out.Println()
 	
 	if visitorType == "xtcp" {
-		fmt.Println("⚡ P2P Mode: Attempting direct connection")
-		fmt.Println("ℹ️  If P2P fails, connection will fall back to server relay")
+		out.Println("⚡ P2P Mode: Attempting direct connection")
+		out.Println("ℹ️  If P2P fails, connection will fall back to server relay")
 	} else {
-		fmt.Println("🔒 Secure Mode: Connection encrypted with secret key")
+		out.Println("🔒 Secure Mode: Connection encrypted with secret key")
 	}
-	fmt.Println()
+	out.Println()
 
 	// Start tunnel
 	mgr := tunnel.New(configPath)
+	mgr.SetEnv(cfg.Env()...)
 	defer mgr.Cleanup()
 
-	return mgr.StartWithGracefulShutdown()
+	info := control.Info{
+		Name:  "visitor-" + tunnelName,
+		Type:  visitorType + "-visitor",
+		Local: fmt.Sprintf("%s:%d", visitorBindAddr, visitorBindPort),
+	}
+	fields := output.Fields{
+		"type":   "visitor",
+		"name":   tunnelName,
+		"proxy_type": visitorType,
+		"local":  fmt.Sprintf("%s:%d", visitorBindAddr, visitorBindPort),
+	}
+	if rel != nil {
+		if dash := startInspector(rel, info.Name, info.Local, visitorBindPort, mgr); dash != nil {
+			defer dash.Stop()
+			info.Dashboard = fmt.Sprintf("http://localhost:%d", dash.Port())
+			fields["dashboard"] = info.Dashboard
+		}
+	}
+	return runManaged(mgr, rel, info, fields)
 }
 
@@ -6,6 +6,7 @@ require (
 	github.com/pelletier/go-toml/v2 v2.2.4
 	github.com/spf13/cobra v1.10.1
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.33.0
 )
 
 require (
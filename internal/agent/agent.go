@@ -0,0 +1,636 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/control"
+	"github.com/lum-tools/lrok/internal/dashboard"
+	"github.com/lum-tools/lrok/internal/names"
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/lum-tools/lrok/internal/tracing"
+	"github.com/lum-tools/lrok/internal/tunnel"
+)
+
+// Spec describes a tunnel managed by the agent
+type Spec struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"` // http or tcp
+	LocalPort     int      `json:"local_port"`
+	LocalIP       string   `json:"local_ip,omitempty"`
+	RemotePort    int      `json:"remote_port,omitempty"` // For TCP tunnels
+	APIKey        string   `json:"api_key,omitempty"`
+	Server        string   `json:"server,omitempty"` // host[:port], overrides Region
+	Region        string   `json:"region,omitempty"`
+	SubdomainHost string   `json:"subdomain_host,omitempty"`
+	EgressProxy   string   `json:"egress_proxy,omitempty"`
+	Domains       []string `json:"domains,omitempty"` // verified custom domains (HTTP)
+	Routes        []string `json:"routes,omitempty"`  // [host]/prefix=port[,port] upstreams (HTTP)
+	LB            string   `json:"lb,omitempty"`      // round-robin or least-conn
+	LBHealthPath  string   `json:"lb_health_path,omitempty"`
+
+	VerifyWebhooks []string      `json:"verify_webhooks,omitempty"` // provider:secret signature checks (HTTP)
+	RejectWebhooks bool          `json:"reject_webhooks,omitempty"`
+	HoldRequests   time.Duration `json:"hold_requests,omitempty"` // queue requests while the app is down
+	ReadyPath      string        `json:"ready_path,omitempty"`    // checked once frpc connects (HTTP)
+
+	OTLPEndpoint string   `json:"otlp_endpoint,omitempty"` // request span export (HTTP)
+	OTLPProtocol string   `json:"otlp_protocol,omitempty"`
+	OTLPHeaders  []string `json:"otlp_headers,omitempty"` // key=value collector headers
+
+	Transport config.TransportConfig `json:"transport"` // how frpc reaches the server
+
+	Limits relay.Limits `json:"limits"` // enforced locally by the relay
+}
+
+// TunnelStatus is the API representation of a managed tunnel
+type TunnelStatus struct {
+	Spec
+	URL         string    `json:"url"`
+	Dashboard   string    `json:"dashboard,omitempty"`
+	State       string    `json:"state"`
+	Error       string    `json:"error,omitempty"`
+	StartTime   time.Time `json:"start_time"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	Connections int64     `json:"connections"`
+}
+
+// Delays before restarting an frpc that exited, doubling from min to max
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+)
+
+// managedTunnel holds the runtime pieces of a single tunnel
+type managedTunnel struct {
+	spec      Spec
+	url       string
+	proxy     *proxy.Proxy
+	tracer    *tracing.Tracer
+	relay     *relay.Relay
+	dashboard *dashboard.Server
+	manager   *tunnel.Manager
+	control   *control.Server
+	logs      *control.LogBuffer
+	cancel    context.CancelFunc
+	done      chan struct{}
+	startTime time.Time
+	lastErr   error
+	mu        sync.Mutex
+}
+
+// Agent runs and supervises many tunnels in one long-lived process
+type Agent struct {
+	tunnels map[string]*managedTunnel
+	mu      sync.Mutex
+	runDir  string
+}
+
+// New creates an agent. Tunnels register in runDir so that 'lrok list'
+// and friends see them like any other running tunnel.
+func New(runDir string) *Agent {
+	return &Agent{
+		tunnels: make(map[string]*managedTunnel),
+		runDir:  runDir,
+	}
+}
+
+// normalize fills defaults and validates a spec
+func normalize(spec Spec) (Spec, error) {
+	if spec.Type == "" {
+		spec.Type = "http"
+	}
+	if spec.LocalIP == "" {
+		spec.LocalIP = "127.0.0.1"
+	}
+	if spec.Name == "" {
+		spec.Name = names.Generate()
+	}
+
+	if err := tunnel.ValidateTunnelName(spec.Name); err != nil {
+		return spec, fmt.Errorf("invalid tunnel name: %w", err)
+	}
+	if len(spec.Routes) > 0 {
+		if spec.Type != "http" {
+			return spec, fmt.Errorf("routes require an http tunnel")
+		}
+		if _, err := proxy.ParseRoutes(spec.Routes, spec.LocalPort); err != nil {
+			return spec, err
+		}
+		if err := proxy.ValidateLBStrategy(spec.LB); err != nil {
+			return spec, err
+		}
+	} else if spec.LocalPort < 1 || spec.LocalPort > 65535 {
+		return spec, fmt.Errorf("invalid local port: %d", spec.LocalPort)
+	}
+
+	switch spec.Type {
+	case "http":
+	case "tcp":
+		if err := tunnel.ValidatePort(spec.RemotePort); err != nil {
+			return spec, fmt.Errorf("invalid remote port: %w", err)
+		}
+	default:
+		return spec, fmt.Errorf("unsupported tunnel type '%s', must be one of: http, tcp", spec.Type)
+	}
+
+	for _, domain := range spec.Domains {
+		if spec.Type != "http" {
+			return spec, fmt.Errorf("custom domains require an http tunnel")
+		}
+		if err := tunnel.ValidateDomain(domain); err != nil {
+			return spec, err
+		}
+	}
+	if len(spec.VerifyWebhooks) > 0 && spec.Type != "http" {
+		return spec, fmt.Errorf("webhook verification requires an http tunnel")
+	}
+	if _, err := proxy.ParseWebhookVerifiers(spec.VerifyWebhooks); err != nil {
+		return spec, err
+	}
+	if (spec.ReadyPath != "" || spec.OTLPEndpoint != "") && spec.Type != "http" {
+		return spec, fmt.Errorf("ready_path and otlp_endpoint require an http tunnel")
+	}
+	if spec.Limits.MaxBytes < 0 || spec.Limits.MaxConns < 0 || spec.Limits.ExpireAfter < 0 {
+		return spec, fmt.Errorf("limits must not be negative")
+	}
+	if spec.HoldRequests < 0 || spec.HoldRequests > proxy.MaxHold {
+		return spec, fmt.Errorf("hold_requests must be between 0 and %s", proxy.MaxHold)
+	}
+
+	if spec.APIKey == "" && !config.SelfHostedActive() {
+		key, err := defaultAPIKey()
+		if err != nil {
+			return spec, err
+		}
+		spec.APIKey = key
+	}
+
+	return spec, nil
+}
+
+// defaultAPIKey resolves the agent's own API key when a spec has none
+func defaultAPIKey() (string, error) {
+	cred, err := config.ResolveAPIKey("")
+	if err != nil {
+		return "", fmt.Errorf("no API key in request and none configured for the agent: %w", err)
+	}
+	return cred.APIKey, nil
+}
+
+// Create starts a new tunnel
+func (a *Agent) Create(spec Spec) (*TunnelStatus, error) {
+	spec, err := normalize(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	if _, exists := a.tunnels[spec.Name]; exists {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("tunnel '%s' already exists", spec.Name)
+	}
+	// Reserve the name while starting
+	t := &managedTunnel{spec: spec}
+	a.tunnels[spec.Name] = t
+	a.mu.Unlock()
+
+	if err := a.start(t); err != nil {
+		a.mu.Lock()
+		delete(a.tunnels, spec.Name)
+		a.mu.Unlock()
+		return nil, err
+	}
+
+	status := t.status()
+	return &status, nil
+}
+
+// start brings up the proxy, dashboard and frpc for a tunnel
+func (a *Agent) start(t *managedTunnel) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spec := t.spec
+	t.logs = control.NewLogBuffer(1000)
+	t.startTime = time.Now()
+
+	server, err := config.ResolveServer(context.Background(), config.ServerOptions{
+		Server:        spec.Server,
+		Region:        spec.Region,
+		SubdomainHost: spec.SubdomainHost,
+		EgressProxy:   spec.EgressProxy,
+		Transport:     spec.Transport,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to select server: %w", err)
+	}
+	if err := tunnel.ValidateTransport(server.Transport); err != nil {
+		return err
+	}
+	if err := config.CheckDomains(server, spec.Domains); err != nil {
+		return err
+	}
+
+	cfg := &config.TunnelConfig{
+		APIKey:    spec.APIKey,
+		LocalPort: spec.LocalPort,
+		LocalIP:   spec.LocalIP,
+		Subdomain: spec.Name,
+		ProxyType: spec.Type,
+
+		CustomDomains: spec.Domains,
+	}
+	server.Apply(cfg)
+
+	switch spec.Type {
+	case "http":
+		t.url = server.HTTPURL(spec.Name)
+		if len(spec.Domains) > 0 {
+			t.url = server.CustomURL(spec.Domains[0])
+		}
+
+		t.proxy = proxy.New(spec.LocalPort, 100)
+		if len(spec.Routes) > 0 {
+			routes, err := proxy.ParseRoutes(spec.Routes, spec.LocalPort)
+			if err != nil {
+				return err
+			}
+			t.proxy = proxy.NewWithRoutes(routes, 100)
+		}
+		t.proxy.SetLoadBalancing(proxy.LBOptions{Strategy: spec.LB, HealthPath: spec.LBHealthPath})
+		verifiers, err := proxy.ParseWebhookVerifiers(spec.VerifyWebhooks)
+		if err != nil {
+			return err
+		}
+		t.proxy.SetWebhookVerifiers(verifiers, spec.RejectWebhooks)
+		t.proxy.SetHoldRequests(spec.HoldRequests)
+		if spec.OTLPEndpoint != "" {
+			// Tracing is optional: a bad setting only disables span export
+			tracer, err := tracing.New(traceConfig(spec))
+			if err != nil {
+				fmt.Fprintf(t.logs, "⚠️  Not exporting request spans: %v\n", err)
+			}
+			t.tracer = tracer
+			t.proxy.SetTracer(tracer)
+		}
+		proxyPort, err := t.proxy.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start proxy: %w", err)
+		}
+		cfg.LocalPort = proxyPort
+		cfg.LocalIP = "127.0.0.1"
+
+		stats := &dashboard.Stats{
+			TunnelName: spec.Name,
+			PublicURL:  t.url,
+			LocalPort:  spec.LocalPort,
+			Status:     "Connected",
+			StartTime:  t.startTime,
+		}
+		t.dashboard = dashboard.New(stats, t.proxy)
+		if err := t.dashboard.Start(0); err != nil {
+			t.dashboard = nil
+		}
+	case "tcp":
+		t.url = "tcp://" + server.TCPAddress(spec.RemotePort)
+		cfg.RemotePort = spec.RemotePort
+	}
+
+	// Count traffic and enforce limits between frpc and the target
+	t.relay = relay.New(fmt.Sprintf("%s:%d", cfg.LocalIP, cfg.LocalPort), spec.Limits)
+	relayPort, err := t.relay.Start()
+	if err != nil {
+		t.stopComponents()
+		return err
+	}
+	cfg.LocalPort = relayPort
+	cfg.LocalIP = "127.0.0.1"
+
+	cfg.SecretsFromEnv = true
+	configPath, err := config.GenerateTOML(cfg)
+	if err != nil {
+		t.stopComponents()
+		return fmt.Errorf("failed to generate config: %w", err)
+	}
+
+	t.manager = tunnel.New(configPath)
+	t.manager.SetEnv(cfg.Env()...)
+	t.manager.SetOutput(t.logs, t.logs)
+	if t.dashboard != nil {
+		t.dashboard.SetTunnel(t.manager)
+		t.dashboard.SetRelay(t.relay)
+	}
+
+	info := control.Info{
+		Name:      spec.Name,
+		Type:      spec.Type,
+		URL:       t.url,
+		Local:     fmt.Sprintf("%s:%d", spec.LocalIP, spec.LocalPort),
+		Dashboard: t.dashboardURL(),
+		StartTime: t.startTime,
+	}
+	name := spec.Name
+	t.control = control.NewServer(a.runDir, info, func() control.Status {
+		s := t.status()
+		return control.Status{State: s.State, BytesIn: s.BytesIn, BytesOut: s.BytesOut, Connections: s.Connections}
+	}, func() { a.Delete(name) }, t.logs)
+	if err := t.control.Start(); err != nil {
+		t.control = nil
+		fmt.Fprintf(t.logs, "⚠️  Control socket unavailable: %v\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done = make(chan struct{})
+
+	go t.run(ctx)
+	go t.watchLimits(ctx)
+	if t.proxy != nil {
+		go t.checkReady(ctx, spec.ReadyPath)
+	}
+
+	return nil
+}
+
+// run keeps frpc running until the tunnel is stopped, restarting it with
+// backoff whenever it exits on its own
+func (t *managedTunnel) run(ctx context.Context) {
+	defer close(t.done)
+
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := t.manager.Start(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("frpc exited")
+		}
+		t.mu.Lock()
+		t.lastErr = err
+		t.mu.Unlock()
+
+		// A run that stayed up a while starts the backoff over
+		if time.Since(started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+		fmt.Fprintf(t.logs, "❌ frpc exited: %v, restarting in %s\n", err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// checkReady reports once frpc connects whether the app answers, the same
+// check a foreground tunnel prints in its banner
+func (t *managedTunnel) checkReady(ctx context.Context, path string) {
+	if t.manager.WaitConnected(ctx) != nil {
+		return
+	}
+	if err := t.proxy.CheckUpstreams(ctx, path); err != nil {
+		fmt.Fprintf(t.logs, "⚠️  App not ready: %v\n", err)
+		return
+	}
+	fmt.Fprintln(t.logs, "✅ App is ready")
+}
+
+// watchLimits stops the tunnel once its relay hits a limit
+func (t *managedTunnel) watchLimits(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-t.relay.Done():
+		t.mu.Lock()
+		t.lastErr = t.relay.Err()
+		t.mu.Unlock()
+		fmt.Fprintf(t.logs, "⛔ Stopping: %v\n", t.relay.Err())
+		t.cancel()
+	}
+}
+
+func (t *managedTunnel) dashboardURL() string {
+	if t.dashboard == nil {
+		return ""
+	}
+	return fmt.Sprintf("http://localhost:%d", t.dashboard.Port())
+}
+
+// stopComponents shuts down everything started for a tunnel
+func (t *managedTunnel) stopComponents() {
+	if t.cancel != nil {
+		t.cancel()
+		<-t.done
+	}
+	if t.manager != nil {
+		t.manager.Cleanup()
+	}
+	if t.control != nil {
+		t.control.Stop()
+	}
+	if t.dashboard != nil {
+		t.dashboard.Stop()
+	}
+	if t.relay != nil {
+		t.relay.Close()
+	}
+	if t.proxy != nil {
+		t.proxy.Stop()
+	}
+	if t.tracer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t.tracer.Shutdown(ctx)
+		cancel()
+	}
+}
+
+// traceConfig builds the span exporter settings for a spec
+func traceConfig(spec Spec) tracing.Config {
+	return tracing.Config{
+		Endpoint: tracing.TracesURL(spec.OTLPEndpoint),
+		Protocol: spec.OTLPProtocol,
+		Headers:  tracing.ParseHeaders(strings.Join(spec.OTLPHeaders, ",")),
+	}
+}
+
+func (t *managedTunnel) status() TunnelStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spec := t.spec
+	spec.APIKey = "" // Never echo credentials over the API
+	spec.EgressProxy = config.RedactURL(spec.EgressProxy)
+	if len(spec.VerifyWebhooks) > 0 {
+		spec.VerifyWebhooks = make([]string, len(t.spec.VerifyWebhooks))
+		for i, verifier := range t.spec.VerifyWebhooks {
+			provider, _, _ := strings.Cut(verifier, ":")
+			spec.VerifyWebhooks[i] = provider + ":***"
+		}
+	}
+	if len(spec.OTLPHeaders) > 0 {
+		spec.OTLPHeaders = make([]string, len(t.spec.OTLPHeaders))
+		for i, header := range t.spec.OTLPHeaders {
+			key, _, _ := strings.Cut(header, "=")
+			spec.OTLPHeaders[i] = key + "=***"
+		}
+	}
+
+	status := TunnelStatus{
+		Spec:      spec,
+		URL:       t.url,
+		Dashboard: t.dashboardURL(),
+		State:     tunnel.StateStarting,
+		StartTime: t.startTime,
+	}
+	if t.manager != nil {
+		status.State = t.manager.State()
+	}
+	if t.lastErr != nil {
+		status.Error = t.lastErr.Error()
+	}
+	if t.relay != nil {
+		stats := t.relay.Stats()
+		status.BytesIn, status.BytesOut, status.Connections = stats.BytesIn, stats.BytesOut, stats.Connections
+	}
+	return status
+}
+
+// List returns all managed tunnels sorted by name
+func (a *Agent) List() []TunnelStatus {
+	a.mu.Lock()
+	tunnels := make([]*managedTunnel, 0, len(a.tunnels))
+	for _, t := range a.tunnels {
+		tunnels = append(tunnels, t)
+	}
+	a.mu.Unlock()
+
+	result := make([]TunnelStatus, 0, len(tunnels))
+	for _, t := range tunnels {
+		result = append(result, t.status())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Get returns a single tunnel
+func (a *Agent) Get(name string) (*TunnelStatus, error) {
+	a.mu.Lock()
+	t, ok := a.tunnels[name]
+	a.mu.Unlock()
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+	status := t.status()
+	return &status, nil
+}
+
+// Update replaces a tunnel's spec and restarts it
+func (a *Agent) Update(name string, spec Spec) (*TunnelStatus, error) {
+	spec.Name = name
+
+	a.mu.Lock()
+	old, ok := a.tunnels[name]
+	a.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// Keep the old credentials unless new ones were provided
+	if spec.APIKey == "" {
+		spec.APIKey = old.spec.APIKey
+	}
+	spec, err := normalize(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// The old tunnel holds the name, ports and control socket, so it has
+	// to stop first; if the new spec fails, bring the old one back
+	old.stopComponents()
+
+	t := &managedTunnel{spec: spec}
+	a.mu.Lock()
+	a.tunnels[name] = t
+	a.mu.Unlock()
+
+	if err := a.start(t); err != nil {
+		restored := &managedTunnel{spec: old.spec}
+		a.mu.Lock()
+		a.tunnels[name] = restored
+		a.mu.Unlock()
+		if restoreErr := a.start(restored); restoreErr != nil {
+			a.mu.Lock()
+			delete(a.tunnels, name)
+			a.mu.Unlock()
+			return nil, fmt.Errorf("%w (and restoring the previous tunnel failed: %v)", err, restoreErr)
+		}
+		return nil, err
+	}
+
+	status := t.status()
+	return &status, nil
+}
+
+// Delete stops and removes a tunnel
+func (a *Agent) Delete(name string) error {
+	a.mu.Lock()
+	t, ok := a.tunnels[name]
+	delete(a.tunnels, name)
+	a.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+	t.stopComponents()
+	return nil
+}
+
+// Logs returns the buffered output of a tunnel
+func (a *Agent) Logs(name string) (*control.LogBuffer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t, ok := a.tunnels[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t.logs, nil
+}
+
+// Shutdown stops every tunnel
+func (a *Agent) Shutdown() {
+	a.mu.Lock()
+	names := make([]string, 0, len(a.tunnels))
+	for name := range a.tunnels {
+		names = append(names, name)
+	}
+	a.mu.Unlock()
+
+	for _, name := range names {
+		a.Delete(name)
+	}
+}
+
+// GetSocketPath returns the default agent API socket path
+func GetSocketPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".lrok", "agent.sock"), nil
+}
@@ -0,0 +1,267 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNotFound is returned when a tunnel name is unknown to the agent
+var ErrNotFound = errors.New("tunnel not found")
+
+// apiError is the JSON body of a failed API call
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Server exposes the agent over a REST/JSON API on a unix socket
+type Server struct {
+	agent    *Agent
+	socket   string
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewServer creates an API server for the agent
+func NewServer(agent *Agent, socketPath string) *Server {
+	return &Server{
+		agent:  agent,
+		socket: socketPath,
+	}
+}
+
+// Handler returns the API routes:
+//
+//	GET    /tunnels          list tunnels
+//	POST   /tunnels          create a tunnel from a Spec
+//	GET    /tunnels/{name}   get one tunnel
+//	PUT    /tunnels/{name}   replace a tunnel's spec (restarts it)
+//	DELETE /tunnels/{name}   stop and remove a tunnel
+//	GET    /tunnels/{name}/logs   buffered output
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tunnels", s.handleList)
+	mux.HandleFunc("POST /tunnels", s.handleCreate)
+	mux.HandleFunc("GET /tunnels/{name}", s.handleGet)
+	mux.HandleFunc("PUT /tunnels/{name}", s.handleUpdate)
+	mux.HandleFunc("DELETE /tunnels/{name}", s.handleDelete)
+	mux.HandleFunc("GET /tunnels/{name}/logs", s.handleLogs)
+	return mux
+}
+
+// Start listens on the unix socket and serves the API in the background
+func (s *Server) Start() error {
+	if err := os.MkdirAll(filepath.Dir(s.socket), 0700); err != nil {
+		return fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if _, err := Dial(s.socket).List(); err == nil {
+		return fmt.Errorf("an lrok agent is already running on %s", s.socket)
+	}
+	os.Remove(s.socket)
+
+	listener, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.socket, err)
+	}
+	os.Chmod(s.socket, 0600)
+
+	s.listener = listener
+	s.server = &http.Server{Handler: s.Handler()}
+	go s.server.Serve(listener)
+
+	return nil
+}
+
+// Stop stops the API server and removes the socket
+func (s *Server) Stop() error {
+	if s.server != nil {
+		s.server.Close()
+	}
+	os.Remove(s.socket)
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.agent.List())
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var spec Spec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	status, err := s.agent.Create(spec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	status, err := s.agent.Get(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var spec Spec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	status, err := s.agent.Update(r.PathValue("name"), spec)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if err := s.agent.Delete(r.PathValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	logs, err := s.agent.Logs(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range logs.Lines() {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// Client talks to a running agent
+type Client struct {
+	http *http.Client
+}
+
+// Dial creates a client for the agent listening on socketPath
+func Dial(socketPath string) *Client {
+	return &Client{
+		http: &http.Client{
+			// Creating a tunnel waits for the proxy to warm up
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// do performs an API call, decoding the response into result when non-nil
+func (c *Client) do(method, path string, body interface{}, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, "http://lrok-agent"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("lrok agent is not reachable (start it with 'lrok daemon'): %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr apiError
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrNotFound
+		}
+		return fmt.Errorf("agent: %s", apiErr.Error)
+	}
+
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// List returns all tunnels managed by the agent
+func (c *Client) List() ([]TunnelStatus, error) {
+	var result []TunnelStatus
+	err := c.do("GET", "/tunnels", nil, &result)
+	return result, err
+}
+
+// Create asks the agent to start a tunnel
+func (c *Client) Create(spec Spec) (*TunnelStatus, error) {
+	var result TunnelStatus
+	if err := c.do("POST", "/tunnels", spec, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Get returns a single tunnel
+func (c *Client) Get(name string) (*TunnelStatus, error) {
+	var result TunnelStatus
+	if err := c.do("GET", "/tunnels/"+name, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Update replaces a tunnel's spec
+func (c *Client) Update(name string, spec Spec) (*TunnelStatus, error) {
+	var result TunnelStatus
+	if err := c.do("PUT", "/tunnels/"+name, spec, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Delete stops and removes a tunnel
+func (c *Client) Delete(name string) error {
+	return c.do("DELETE", "/tunnels/"+name, nil, nil)
+}
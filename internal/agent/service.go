@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ServiceName is the systemd user unit installed by 'lrok service install'
+const ServiceName = "lrok.service"
+
+// GetUnitPath returns where the systemd user unit is installed
+func GetUnitPath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configDir, "systemd", "user", ServiceName), nil
+}
+
+// SystemdUnit renders a systemd user unit running 'lrok daemon'
+func SystemdUnit(execPath string, env map[string]string) string {
+	var b strings.Builder
+
+	b.WriteString("# Generated by 'lrok service install'\n")
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=lrok tunnel agent\n")
+	b.WriteString("Documentation=https://github.com/lum-tools/lrok\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s daemon\n", quoteArg(execPath))
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=5\n")
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "Environment=%s\n", quoteArg(k+"="+env[k]))
+	}
+
+	b.WriteString("\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=default.target\n")
+
+	return b.String()
+}
+
+// quoteArg quotes a value for systemd if it contains spaces or quotes
+func quoteArg(s string) string {
+	if !strings.ContainsAny(s, " \t\"\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
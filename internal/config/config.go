@@ -10,6 +10,9 @@ import (
 const (
 	DefaultServerAddr = "142.132.245.5"
 	DefaultServerPort = 7000
+
+	// APIKeyEnvVar passes the API key to frpc without writing it to disk
+	APIKeyEnvVar = "LROK_FRPC_API_KEY"
 )
 
 // TunnelConfig represents the configuration for a tunnel
@@ -20,6 +23,7 @@ type TunnelConfig struct {
 	LocalPort       int
 	LocalIP         string
 	Subdomain       string
+	CustomDomains   []string // HTTP tunnels: extra hostnames routed to this tunnel
 	ProxyType       string // http, tcp, stcp, xtcp
 	RemotePort      int    // For TCP tunnels
 	SecretKey       string // For STCP/XTCP tunnels
@@ -27,6 +31,56 @@ type TunnelConfig struct {
 	UseEncryption   bool
 	UseCompression  bool
 	HealthCheckType string // tcp, http
+	ProxyProtocol   string // v1 or v2: frpc sends the client address ahead of each connection
+	SecretsFromEnv  bool   // Reference secrets from frpc's environment instead of embedding them
+	SelfHosted      bool   // Own frps: native auth instead of lum.tools metadata
+	Auth            AuthConfig
+	TLS             TLSConfig
+	ProxyURL        string // Egress proxy for the connection to the server (http, socks5, ntlm)
+	Transport       TransportConfig
+}
+
+// Env returns the environment frpc needs to render this config
+func (cfg *TunnelConfig) Env() []string {
+	if !cfg.SecretsFromEnv {
+		return nil
+	}
+	var env []string
+	if !cfg.SelfHosted {
+		env = append(env, APIKeyEnvVar+"="+cfg.APIKey)
+	}
+	if cfg.SelfHosted && cfg.Auth.Token != "" {
+		env = append(env, AuthTokenEnvVar+"="+cfg.Auth.Token)
+	}
+	if cfg.SelfHosted && cfg.Auth.OIDCClientSecret != "" {
+		env = append(env, OIDCSecretEnvVar+"="+cfg.Auth.OIDCClientSecret)
+	}
+	if cfg.proxyHasCredentials() {
+		env = append(env, EgressProxyURLEnvVar+"="+cfg.ProxyURL)
+	}
+	return env
+}
+
+// secretValue returns the config value for a secret: the secret itself,
+// or an frpc template reading it from the environment
+func (cfg *TunnelConfig) secretValue(envVar, value string) string {
+	if cfg.SecretsFromEnv {
+		return fmt.Sprintf("{{ .Envs.%s }}", envVar)
+	}
+	return value
+}
+
+// clientSection renders the connection settings and authentication: frps
+// native auth for self-hosted servers, plugin metadata for lum.tools
+func (cfg *TunnelConfig) clientSection(metadataLines []string) string {
+	section := ""
+	if lines := cfg.connectionLines(); len(lines) > 0 {
+		section = strings.Join(lines, "\n") + "\n\n"
+	}
+	if cfg.SelfHosted {
+		return strings.TrimSuffix(section, "\n\n")
+	}
+	return section + "# Pass configuration in metadata for plugin authentication and tracking\n" + strings.Join(metadataLines, "\n")
 }
 
 // GenerateTOML creates a frpc TOML configuration file and returns the path
@@ -40,13 +94,16 @@ func GenerateTOML(cfg *TunnelConfig) (string, error) {
 	if cfg.LocalIP == "" {
 		cfg.LocalIP = "127.0.0.1"
 	}
+	if err := cfg.validateConnection(); err != nil {
+		return "", err
+	}
 	if cfg.ProxyType == "" {
 		cfg.ProxyType = "http" // Default to HTTP for backward compatibility
 	}
 
 	// Build metadata section
 	metadataLines := []string{
-		fmt.Sprintf(`metadatas.api_key = "%s"`, cfg.APIKey),
+		fmt.Sprintf(`metadatas.api_key = "%s"`, cfg.secretValue(APIKeyEnvVar, cfg.APIKey)),
 		fmt.Sprintf(`metadatas.local_port = "%d"`, cfg.LocalPort),
 		fmt.Sprintf(`metadatas.proxy_type = "%s"`, cfg.ProxyType),
 	}
@@ -69,6 +126,9 @@ func GenerateTOML(cfg *TunnelConfig) (string, error) {
 	if cfg.HealthCheckType != "" {
 		metadataLines = append(metadataLines, fmt.Sprintf(`metadatas.health_check_type = "%s"`, cfg.HealthCheckType))
 	}
+	if len(cfg.CustomDomains) > 0 {
+		metadataLines = append(metadataLines, fmt.Sprintf(`metadatas.custom_domains = "%s"`, strings.Join(cfg.CustomDomains, ",")))
+	}
 
 	// Build proxy configuration based on type
 	var proxyConfig string
@@ -81,6 +141,13 @@ localIP = "%s"
 localPort = %d
 subdomain = "%s"`,
 			cfg.Subdomain, cfg.ProxyType, cfg.LocalIP, cfg.LocalPort, cfg.Subdomain)
+		if len(cfg.CustomDomains) > 0 {
+			quoted := make([]string, len(cfg.CustomDomains))
+			for i, d := range cfg.CustomDomains {
+				quoted[i] = fmt.Sprintf("%q", d)
+			}
+			proxyConfig += fmt.Sprintf("\ncustomDomains = [%s]", strings.Join(quoted, ", "))
+		}
 		
 	case "tcp":
 		if cfg.RemotePort == 0 {
@@ -111,7 +178,7 @@ localPort = %d`,
 	}
 
 	// Add transport options if specified
-	if cfg.BandwidthLimit != "" || cfg.UseEncryption || cfg.UseCompression {
+	if cfg.BandwidthLimit != "" || cfg.UseEncryption || cfg.UseCompression || cfg.ProxyProtocol != "" {
 		proxyConfig += "\n\n[proxies.transport]"
 		if cfg.BandwidthLimit != "" {
 			proxyConfig += fmt.Sprintf("\nbandwidthLimit = \"%s\"", cfg.BandwidthLimit)
@@ -122,6 +189,9 @@ localPort = %d`,
 		if cfg.UseCompression {
 			proxyConfig += "\nuseCompression = true"
 		}
+		if cfg.ProxyProtocol != "" {
+			proxyConfig += fmt.Sprintf("\nproxyProtocolVersion = \"%s\"", cfg.ProxyProtocol)
+		}
 	}
 
 	// Add health check if specified
@@ -141,14 +211,13 @@ serverPort = %d
 
 log.level = "info"
 
-# Pass configuration in metadata for plugin authentication and tracking
 %s
 
 %s
 `,
 		cfg.ServerAddr,
 		cfg.ServerPort,
-		strings.Join(metadataLines, "\n"),
+		cfg.clientSection(metadataLines),
 		proxyConfig,
 	)
 
@@ -174,10 +243,13 @@ func GenerateVisitorTOML(cfg *TunnelConfig) (string, error) {
 	if cfg.LocalIP == "" {
 		cfg.LocalIP = "127.0.0.1"
 	}
+	if err := cfg.validateConnection(); err != nil {
+		return "", err
+	}
 
 	// Build metadata section for visitor
 	metadataLines := []string{
-		fmt.Sprintf(`metadatas.api_key = "%s"`, cfg.APIKey),
+		fmt.Sprintf(`metadatas.api_key = "%s"`, cfg.secretValue(APIKeyEnvVar, cfg.APIKey)),
 		fmt.Sprintf(`metadatas.proxy_type = "%s"`, cfg.ProxyType),
 		fmt.Sprintf(`metadatas.secret_key = "%s"`, cfg.SecretKey),
 		fmt.Sprintf(`metadatas.bind_port = "%d"`, cfg.LocalPort),
@@ -201,14 +273,13 @@ serverPort = %d
 
 log.level = "info"
 
-# Pass configuration in metadata for plugin authentication and tracking
 %s
 
 %s
 `,
 		cfg.ServerAddr,
 		cfg.ServerPort,
-		strings.Join(metadataLines, "\n"),
+		cfg.clientSection(metadataLines),
 		visitorConfig,
 	)
 
@@ -4,18 +4,124 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
+	"github.com/lum-tools/lrok/internal/secrets"
 	"github.com/pelletier/go-toml/v2"
 )
 
-// Credentials stores user authentication config
+// DefaultProfile is used when no profile is selected
+const DefaultProfile = "default"
+
+// Credentials stores user authentication config. It mirrors the default
+// profile so older lrok versions keep working.
 type Credentials struct {
 	APIKey string `toml:"api_key"`
 }
 
+// TunnelDefaults are tunnel options applied when not set on the command line
+type TunnelDefaults struct {
+	BandwidthLimit string `toml:"bandwidth_limit"`
+	UseEncryption  bool   `toml:"use_encryption"`
+	UseCompression bool   `toml:"use_compression"`
+	HealthCheck    string `toml:"health_check"`
+}
+
+// Profile is a named set of credentials and defaults
+type Profile struct {
+	APIKey        string         `toml:"api_key"`
+	APIKeyCommand string         `toml:"api_key_command"` // e.g. "pass show lum/api-key"
+	KeyStore      string         `toml:"key_store"`       // secret backend holding the key
+	Organization  string         `toml:"organization"`
+	Server        string         `toml:"server"`         // host or host:port
+	Region        string         `toml:"region"`         // region name or "auto"
+	SubdomainHost string         `toml:"subdomain_host"` // public domain for HTTP tunnels
+	Defaults      TunnelDefaults `toml:"defaults"`
+	SelfHosted    SelfHosted     `toml:"self_hosted"` // own frps with native auth
+
+	Transport TransportConfig `toml:"transport"` // how to connect to the server
+}
+
+// SecretsConfig selects where 'lrok login' stores API keys
+type SecretsConfig struct {
+	Backend string `toml:"backend"` // plaintext, file, secret-service, pass
+}
+
 // Config represents the lrok configuration file
 type Config struct {
-	Auth Credentials `toml:"auth"`
+	CurrentProfile string                   `toml:"current_profile"`
+	Auth           Credentials              `toml:"auth"`
+	Secrets        SecretsConfig            `toml:"secrets"`
+	Profiles       map[string]*Profile      `toml:"profiles"`
+	Regions        map[string]Server        `toml:"regions"`
+	Domains        map[string]*CustomDomain `toml:"domains"`
+
+	// raw holds the file as read so unknown settings survive a save
+	raw map[string]interface{}
+}
+
+// profileOverride is set by --profile and wins over LROK_PROFILE
+var profileOverride string
+
+// SetProfile selects the profile for this process (from --profile)
+func SetProfile(name string) {
+	profileOverride = name
+}
+
+// ActiveProfileName resolves the profile: --profile > LROK_PROFILE > current_profile > default
+func (c *Config) ActiveProfileName() string {
+	if profileOverride != "" {
+		return profileOverride
+	}
+	if env := os.Getenv("LROK_PROFILE"); env != "" {
+		return env
+	}
+	if c.CurrentProfile != "" {
+		return c.CurrentProfile
+	}
+	return DefaultProfile
+}
+
+// Profile returns a named profile
+func (c *Config) Profile(name string) (*Profile, bool) {
+	p, ok := c.Profiles[name]
+	return p, ok
+}
+
+// EnsureProfile returns a named profile, creating it if needed
+func (c *Config) EnsureProfile(name string) *Profile {
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*Profile)
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		p = &Profile{}
+		c.Profiles[name] = p
+	}
+	return p
+}
+
+// ProfileNames returns all profile names sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyDefaults fills tunnel settings left unset with the profile's defaults
+func (p *Profile) ApplyDefaults(cfg *TunnelConfig) error {
+	if cfg.BandwidthLimit == "" {
+		cfg.BandwidthLimit = p.Defaults.BandwidthLimit
+	}
+	if cfg.HealthCheckType == "" {
+		cfg.HealthCheckType = p.Defaults.HealthCheck
+	}
+	cfg.UseEncryption = cfg.UseEncryption || p.Defaults.UseEncryption
+	cfg.UseCompression = cfg.UseCompression || p.Defaults.UseCompression
+	return nil
 }
 
 // GetConfigPath returns the path to the config file
@@ -31,6 +137,16 @@ func GetConfigPath() (string, error) {
 	return configFile, nil
 }
 
+// GetRunDir returns the directory where running instances register themselves
+func GetRunDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".lrok", "run"), nil
+}
+
 // EnsureConfigDir ensures the config directory exists
 func EnsureConfigDir() error {
 	homeDir, err := os.UserHomeDir()
@@ -68,11 +184,22 @@ func LoadConfig() (*Config, error) {
 	if err := toml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err := toml.Unmarshal(data, &config.raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	// Files written before profiles existed only have [auth]
+	if config.Auth.APIKey != "" {
+		if _, ok := config.Profiles[DefaultProfile]; !ok {
+			config.EnsureProfile(DefaultProfile).APIKey = config.Auth.APIKey
+		}
+	}
 
 	return &config, nil
 }
 
-// SaveConfig saves the configuration to file
+// SaveConfig saves the configuration to file. Settings lrok doesn't know
+// about are preserved from the file that was loaded.
 func SaveConfig(config *Config) error {
 	if err := EnsureConfigDir(); err != nil {
 		return err
@@ -83,7 +210,32 @@ func SaveConfig(config *Config) error {
 		return err
 	}
 
-	data, err := toml.Marshal(config)
+	// Keep [auth] in sync with the default profile for older versions
+	config.Auth.APIKey = ""
+	if p, ok := config.Profiles[DefaultProfile]; ok {
+		config.Auth.APIKey = p.APIKey
+	}
+
+	known, err := toml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var typed map[string]interface{}
+	if err := toml.Unmarshal(known, &typed); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	merged := config.raw
+	if merged == nil {
+		merged = make(map[string]interface{})
+	}
+	mergeTable(merged, typed)
+
+	// Removed profiles and domains must not be resurrected from the old file
+	pruneTable(merged, "profiles", func(name string) bool { _, ok := config.Profiles[name]; return ok })
+	pruneTable(merged, "domains", func(name string) bool { _, ok := config.Domains[name]; return ok })
+
+	data, err := toml.Marshal(merged)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -95,29 +247,247 @@ func SaveConfig(config *Config) error {
 	return nil
 }
 
-// SaveAPIKey saves an API key to the config file
+// mergeTable overlays src onto dst. Keys lrok manages but left empty are
+// removed; keys only present in dst are kept.
+func mergeTable(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if sub, ok := v.(map[string]interface{}); ok {
+			existing, ok := dst[k].(map[string]interface{})
+			if !ok {
+				existing = make(map[string]interface{})
+			}
+			mergeTable(existing, sub)
+			if len(existing) == 0 {
+				delete(dst, k)
+			} else {
+				dst[k] = existing
+			}
+			continue
+		}
+		if isZero(v) {
+			delete(dst, k)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// pruneTable drops entries of a table of tables that keep rejects
+func pruneTable(merged map[string]interface{}, key string, keep func(name string) bool) {
+	table, ok := merged[key].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for name := range table {
+		if !keep(name) {
+			delete(table, name)
+		}
+	}
+	if len(table) == 0 {
+		delete(merged, key)
+	}
+}
+
+func isZero(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case bool:
+		return !val
+	case int64:
+		return val == 0
+	case float64:
+		return val == 0
+	}
+	return false
+}
+
+// openStore opens a secret backend rooted in the config directory
+func openStore(backend string) (secrets.Store, error) {
+	configFile, err := GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Open(backend, filepath.Dir(configFile))
+}
+
+// ProfileAPIKey resolves a profile's key and describes where it is stored
+func (c *Config) ProfileAPIKey(name string) (string, string, error) {
+	p, ok := c.Profile(name)
+	if !ok {
+		return "", "", fmt.Errorf("no API key found in config for profile '%s'", name)
+	}
+
+	configFile, _ := GetConfigPath()
+	switch {
+	case p.APIKey != "":
+		return p.APIKey, fmt.Sprintf("config file (%s)", configFile), nil
+	case p.APIKeyCommand != "":
+		key, err := secrets.RunCommand(p.APIKeyCommand)
+		return key, fmt.Sprintf("api_key_command (%s)", p.APIKeyCommand), err
+	case p.KeyStore != "":
+		store, err := openStore(p.KeyStore)
+		if err != nil {
+			return "", "", err
+		}
+		key, err := store.Get(name)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read API key from %s: %w", store.Location(), err)
+		}
+		return key, store.Location(), nil
+	}
+	return "", "", fmt.Errorf("no API key found in config for profile '%s'", name)
+}
+
+// SaveAPIKey saves an API key to the active profile using the configured backend
 func SaveAPIKey(apiKey string) error {
-	config := &Config{
-		Auth: Credentials{
-			APIKey: apiKey,
-		},
+	return SaveAPIKeyTo(apiKey, "")
+}
+
+// SaveAPIKeyTo saves an API key to the active profile in the given secret
+// backend (empty uses the configured one) and remembers the choice
+func SaveAPIKeyTo(apiKey, backend string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
 	}
 
-	return SaveConfig(config)
+	if backend != "" {
+		if err := secrets.ValidateBackend(backend); err != nil {
+			return err
+		}
+		config.Secrets.Backend = backend
+		if backend == secrets.BackendPlaintext {
+			config.Secrets.Backend = ""
+		}
+	}
+
+	name := config.ActiveProfileName()
+	p := config.EnsureProfile(name)
+	previous := p.KeyStore
+
+	if config.Secrets.Backend == "" || config.Secrets.Backend == secrets.BackendPlaintext {
+		p.APIKey = apiKey
+		p.KeyStore = ""
+	} else {
+		store, err := openStore(config.Secrets.Backend)
+		if err != nil {
+			return err
+		}
+		if err := store.Set(name, apiKey); err != nil {
+			return fmt.Errorf("failed to store API key in %s: %w", store.Location(), err)
+		}
+		// Never leave a plaintext copy behind
+		p.APIKey = ""
+		p.KeyStore = config.Secrets.Backend
+	}
+
+	if err := SaveConfig(config); err != nil {
+		return err
+	}
+
+	// Drop the copy in the backend the key moved away from
+	if previous != "" && previous != p.KeyStore {
+		if store, err := openStore(previous); err == nil {
+			store.Delete(name)
+		}
+	}
+	return nil
 }
 
-// GetAPIKey retrieves the API key from the config file
+// GetActiveProfile returns the active profile and its name. A missing
+// profile is returned empty unless it was explicitly selected.
+func GetActiveProfile() (*Profile, string, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := config.ActiveProfileName()
+	if p, ok := config.Profile(name); ok {
+		return p, name, nil
+	}
+	if name != DefaultProfile {
+		return nil, name, fmt.Errorf("profile '%s' not found (see 'lrok profile list')", name)
+	}
+	return &Profile{}, name, nil
+}
+
+// GetAPIKey retrieves the API key of the active profile
 func GetAPIKey() (string, error) {
 	config, err := LoadConfig()
 	if err != nil {
 		return "", err
 	}
 
-	if config.Auth.APIKey == "" {
-		return "", fmt.Errorf("no API key found in config")
+	key, _, err := config.ProfileAPIKey(config.ActiveProfileName())
+	return key, err
+}
+
+// ClearAPIKey removes the API key of the active profile, keeping its other settings
+func ClearAPIKey() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	name := config.ActiveProfileName()
+	if p, ok := config.Profile(name); ok {
+		if p.KeyStore != "" {
+			store, err := openStore(p.KeyStore)
+			if err != nil {
+				return err
+			}
+			if err := store.Delete(name); err != nil {
+				return fmt.Errorf("failed to remove API key from %s: %w", store.Location(), err)
+			}
+		}
+		p.APIKey = ""
+		p.KeyStore = ""
 	}
+	return SaveConfig(config)
+}
 
-	return config.Auth.APIKey, nil
+// UseProfile makes a profile the default for future runs
+func UseProfile(name string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := config.Profile(name); !ok {
+		return fmt.Errorf("profile '%s' not found", name)
+	}
+	config.CurrentProfile = name
+	if name == DefaultProfile {
+		config.CurrentProfile = ""
+	}
+	return SaveConfig(config)
+}
+
+// RemoveProfile deletes a profile
+func RemoveProfile(name string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	p, ok := config.Profile(name)
+	if !ok {
+		return fmt.Errorf("profile '%s' not found", name)
+	}
+	if p.KeyStore != "" {
+		if store, err := openStore(p.KeyStore); err == nil {
+			store.Delete(name)
+		}
+	}
+	delete(config.Profiles, name)
+	if config.CurrentProfile == name {
+		config.CurrentProfile = ""
+	}
+	return SaveConfig(config)
 }
 
 // ClearConfig removes the config file
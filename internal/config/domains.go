@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CustomDomain is a domain registered with 'lrok domains add'
+type CustomDomain struct {
+	Token      string `toml:"token"`  // ownership token for the TXT record
+	Target     string `toml:"target"` // host the domain must CNAME to
+	Verified   bool   `toml:"verified"`
+	VerifiedAt string `toml:"verified_at"` // RFC 3339
+}
+
+// DomainNames returns all registered custom domains sorted
+func (c *Config) DomainNames() []string {
+	names := make([]string, 0, len(c.Domains))
+	for name := range c.Domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddDomain registers a custom domain, keeping an existing token
+func (c *Config) AddDomain(name, token, target string) *CustomDomain {
+	if c.Domains == nil {
+		c.Domains = make(map[string]*CustomDomain)
+	}
+	d, ok := c.Domains[name]
+	if !ok {
+		d = &CustomDomain{Token: token}
+		c.Domains[name] = d
+	}
+	if d.Target != target {
+		d.Target = target
+		d.Verified = false
+		d.VerifiedAt = ""
+	}
+	return d
+}
+
+// RequireVerifiedDomains returns an error unless every domain has been verified
+func (c *Config) RequireVerifiedDomains(names []string) error {
+	for _, name := range names {
+		d, ok := c.Domains[name]
+		if !ok {
+			return fmt.Errorf("domain '%s' is not registered (run 'lrok domains add %s')", name, name)
+		}
+		if !d.Verified {
+			return fmt.Errorf("domain '%s' is not verified yet (run 'lrok domains verify %s')", name, name)
+		}
+	}
+	return nil
+}
+
+// CheckDomains ensures custom domains may be routed to a tunnel on server.
+// Self-hosted servers route whatever their frps allows, so only lum.tools
+// servers require verified domains.
+func CheckDomains(server *Server, names []string) error {
+	if len(names) == 0 || server.SelfHosted {
+		return nil
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	return cfg.RequireVerifiedDomains(names)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// EgressProxyURLEnvVar carries an egress proxy URL with credentials to frpc,
+// so they stay out of the generated config
+const EgressProxyURLEnvVar = "LROK_FRPC_PROXY_URL"
+
+// egressProxyVars are read in order when --egress-proxy is not given.
+// HTTP_PROXY is left out: the control connection is not plain HTTP.
+var egressProxyVars = []string{"LROK_EGRESS_PROXY", "HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy"}
+
+// ParseEgressProxy parses an http://, socks5:// or ntlm:// proxy URL;
+// host:port alone means an HTTP proxy
+func ParseEgressProxy(value string) (*url.URL, error) {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid egress proxy '%s'", RedactURL(value))
+	}
+	switch u.Scheme {
+	case "http", "socks5", "ntlm":
+		return u, nil
+	case "socks5h":
+		u.Scheme = "socks5"
+		return u, nil
+	}
+	return nil, fmt.Errorf("unsupported egress proxy scheme '%s', must be one of: http, socks5, ntlm", u.Scheme)
+}
+
+// ResolveEgressProxy picks the proxy for connections to host, with priority:
+// --egress-proxy > LROK_EGRESS_PROXY > HTTPS_PROXY > ALL_PROXY. NO_PROXY
+// exempts matching hosts from the environment, and a flag of "none" disables
+// the proxy. It returns nil for direct connections.
+func ResolveEgressProxy(flagValue, host string, getenv func(string) string) (*url.URL, string, error) {
+	switch flagValue {
+	case "none", "direct":
+		return nil, "--egress-proxy", nil
+	case "":
+	default:
+		u, err := ParseEgressProxy(flagValue)
+		return u, "--egress-proxy", err
+	}
+
+	for _, name := range egressProxyVars {
+		value := getenv(name)
+		if value == "" {
+			continue
+		}
+		if NoProxyMatches(firstNonEmpty(getenv("NO_PROXY"), getenv("no_proxy")), host) {
+			return nil, "NO_PROXY", nil
+		}
+		u, err := ParseEgressProxy(value)
+		if err != nil {
+			return nil, name, fmt.Errorf("%s: %w", name, err)
+		}
+		return u, name, nil
+	}
+	return nil, "", nil
+}
+
+// NoProxyMatches reports whether a NO_PROXY list exempts host. Entries are
+// "*", hosts or domains (matching their subdomains, with or without a
+// leading dot), IP addresses or CIDR ranges.
+func NoProxyMatches(noProxy, host string) bool {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		domain := strings.TrimPrefix(entry, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactURL hides the credentials of a URL, with or without a scheme
+func RedactURL(value string) string {
+	if at := strings.LastIndex(value, "@"); at >= 0 {
+		if scheme := strings.Index(value, "://"); scheme >= 0 && scheme < at {
+			return value[:scheme+3] + "***" + value[at:]
+		}
+		return "***" + value[at:]
+	}
+	return value
+}
+
+// proxyHasCredentials reports whether the egress proxy URL holds a user
+// or password, which are kept out of the config file like other secrets
+func (cfg *TunnelConfig) proxyHasCredentials() bool {
+	u, err := url.Parse(cfg.ProxyURL)
+	return err == nil && u.User != nil
+}
+
+// proxyURLValue is the transport.proxyURL value of a frpc config
+func (cfg *TunnelConfig) proxyURLValue() string {
+	if cfg.proxyHasCredentials() {
+		return cfg.secretValue(EgressProxyURLEnvVar, cfg.ProxyURL)
+	}
+	return cfg.ProxyURL
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// APIKeyPrefix starts every lum.tools platform API key
+const APIKeyPrefix = "lum_"
+
+// DefaultPlatformURL is the lum.tools platform
+const DefaultPlatformURL = "https://platform.lum.tools"
+
+// ErrNoAPIKey is returned when no source provides an API key
+var ErrNoAPIKey = errors.New("no API key configured")
+
+// ErrInvalidAPIKey is returned when the tunnel server rejects a key
+var ErrInvalidAPIKey = errors.New("API key rejected by the server")
+
+// KeySource is one place an API key can come from, in precedence order
+type KeySource struct {
+	Name    string `json:"name"`
+	Present bool   `json:"present"`
+	Used    bool   `json:"used"`
+	Detail  string `json:"detail,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Credential is a resolved API key and how it was found
+type Credential struct {
+	APIKey  string      `json:"-"`
+	Source  string      `json:"source"`
+	Profile string      `json:"profile"`
+	Chain   []KeySource `json:"chain"`
+}
+
+// ResolveAPIKey finds the API key with priority:
+// --api-key flag > LUM_API_KEY > FRP_API_KEY (legacy) > active config profile
+func ResolveAPIKey(flagValue string) (*Credential, error) {
+	return resolve(flagValue, false)
+}
+
+// InspectAPIKey resolves like ResolveAPIKey but checks every source, even
+// ones that would not be used (running api_key_command if configured)
+func InspectAPIKey(flagValue string) (*Credential, error) {
+	return resolve(flagValue, true)
+}
+
+func resolve(flagValue string, all bool) (*Credential, error) {
+	cred := &Credential{}
+
+	consider := func(name, key, detail string, err error) {
+		src := KeySource{Name: name, Present: key != "", Detail: detail}
+		if err != nil {
+			src.Error = err.Error()
+		}
+		if src.Present && cred.APIKey == "" {
+			cred.APIKey = key
+			cred.Source = name
+			src.Used = true
+		}
+		cred.Chain = append(cred.Chain, src)
+	}
+
+	consider("--api-key flag", flagValue, "", nil)
+	consider("LUM_API_KEY", os.Getenv("LUM_API_KEY"), "environment variable", nil)
+	consider("FRP_API_KEY", os.Getenv("FRP_API_KEY"), "legacy environment variable", nil)
+
+	cfg, err := LoadConfig()
+	if err == nil {
+		cred.Profile = cfg.ActiveProfileName()
+	}
+
+	switch {
+	case cred.APIKey != "" && !all:
+		// Already found; don't touch secret stores needlessly
+	case err != nil:
+		consider("config file", "", "", err)
+	default:
+		name := fmt.Sprintf("profile '%s'", cred.Profile)
+		if p, ok := cfg.Profile(cred.Profile); ok {
+			if p.APIKey == "" && p.APIKeyCommand == "" && p.KeyStore == "" {
+				consider(name, "", "no key saved", nil)
+			} else {
+				key, location, err := cfg.ProfileAPIKey(cred.Profile)
+				consider(name, key, location, err)
+			}
+		} else {
+			detail := "not configured"
+			if cred.Profile != DefaultProfile {
+				detail = "profile not found"
+			}
+			consider(name, "", detail, nil)
+		}
+	}
+
+	if cred.APIKey == "" {
+		for _, src := range cred.Chain {
+			if src.Error != "" {
+				return cred, fmt.Errorf("%w (%s: %s)", ErrNoAPIKey, src.Name, src.Error)
+			}
+		}
+		return cred, ErrNoAPIKey
+	}
+	return cred, nil
+}
+
+// ValidateAPIKeyFormat checks that a key looks like a platform API key
+func ValidateAPIKeyFormat(key string) error {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return fmt.Errorf("invalid API key format (should start with '%s')", APIKeyPrefix)
+	}
+	if len(key) <= len(APIKeyPrefix) {
+		return fmt.Errorf("invalid API key format (too short)")
+	}
+	return nil
+}
+
+// KeyVerifier checks an API key against the tunnel server
+type KeyVerifier interface {
+	Verify(ctx context.Context, apiKey string) error
+}
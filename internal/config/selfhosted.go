@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Auth methods understood by frps
+const (
+	AuthMethodToken = "token"
+	AuthMethodOIDC  = "oidc"
+)
+
+const (
+	// AuthTokenEnvVar passes the frps auth token to frpc without writing it to disk
+	AuthTokenEnvVar = "LROK_FRPC_AUTH_TOKEN"
+	// OIDCSecretEnvVar passes the OIDC client secret to frpc without writing it to disk
+	OIDCSecretEnvVar = "LROK_FRPC_OIDC_CLIENT_SECRET"
+)
+
+// DefaultURLTemplate is the public URL of an HTTP tunnel
+const DefaultURLTemplate = "https://{name}.{domain}"
+
+// AuthConfig is frps native authentication (auth.* in frpc)
+type AuthConfig struct {
+	Method           string `toml:"method"` // token or oidc
+	Token            string `toml:"token"`
+	OIDCClientID     string `toml:"oidc_client_id"`
+	OIDCClientSecret string `toml:"oidc_client_secret"`
+	OIDCAudience     string `toml:"oidc_audience"`
+	OIDCScope        string `toml:"oidc_scope"`
+	OIDCTokenURL     string `toml:"oidc_token_endpoint_url"`
+}
+
+// TLSConfig is TLS to the tunnel server (transport.tls.* in frpc)
+type TLSConfig struct {
+	Enable     bool   `toml:"enable"`
+	CAFile     string `toml:"ca_file"`   // trusted CA for the server certificate
+	CertFile   string `toml:"cert_file"` // client certificate for mutual TLS
+	KeyFile    string `toml:"key_file"`
+	ServerName string `toml:"server_name"`
+}
+
+// SelfHosted points a profile at your own frps instead of lum.tools
+type SelfHosted struct {
+	Enabled     bool       `toml:"enabled"`
+	Auth        AuthConfig `toml:"auth"`
+	TLS         TLSConfig  `toml:"tls"`
+	URLTemplate string     `toml:"url_template"` // e.g. "http://{name}.{domain}:8080"
+}
+
+// Validate checks that the configured auth method has what it needs
+func (a AuthConfig) Validate() error {
+	switch a.Method {
+	case "":
+		if a.Token != "" {
+			return nil
+		}
+		return fmt.Errorf("self-hosted auth needs a token (auth_token) or auth_method=oidc")
+	case AuthMethodToken:
+		if a.Token == "" {
+			return fmt.Errorf("auth method 'token' requires a token (set auth_token or LROK_AUTH_TOKEN)")
+		}
+	case AuthMethodOIDC:
+		if a.OIDCClientID == "" || a.OIDCTokenURL == "" {
+			return fmt.Errorf("auth method 'oidc' requires oidc_client_id and oidc_token_endpoint_url")
+		}
+	default:
+		return fmt.Errorf("invalid auth method '%s', must be one of: token, oidc", a.Method)
+	}
+	return nil
+}
+
+// method returns the effective auth method
+func (a AuthConfig) method() string {
+	if a.Method == "" {
+		return AuthMethodToken
+	}
+	return a.Method
+}
+
+// Validate checks that the TLS files exist and certificates come in pairs
+func (t TLSConfig) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("TLS client certificate and key must be set together")
+	}
+	for _, file := range []string{t.CAFile, t.CertFile, t.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("TLS file: %w", err)
+		}
+	}
+	return nil
+}
+
+// enabled reports whether any TLS setting asks for TLS
+func (t TLSConfig) enabled() bool {
+	return t.Enable || t.CAFile != "" || t.CertFile != "" || t.ServerName != ""
+}
+
+// ValidateURLTemplate checks that a URL template names the tunnel
+func ValidateURLTemplate(tmpl string) error {
+	if !strings.Contains(tmpl, "{name}") {
+		return fmt.Errorf("URL template '%s' must contain {name}", tmpl)
+	}
+	return nil
+}
+
+// SelfHostedActive reports whether the active profile uses its own frps,
+// in which case no lum.tools API key is needed
+func SelfHostedActive() bool {
+	p, _, err := GetActiveProfile()
+	return err == nil && p.SelfHosted.Enabled
+}
+
+// validateConnection checks the server auth, TLS, transport and egress proxy
+// settings
+func (cfg *TunnelConfig) validateConnection() error {
+	if cfg.SelfHosted {
+		if err := cfg.Auth.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.ProxyURL != "" {
+		if _, err := ParseEgressProxy(cfg.ProxyURL); err != nil {
+			return err
+		}
+	}
+	if cfg.Transport.DisableTLS && cfg.TLS.enabled() {
+		return fmt.Errorf("TLS is disabled for the transport but TLS settings are configured")
+	}
+	return cfg.TLS.Validate()
+}
+
+// connectionLines renders the auth, TLS, transport and egress proxy
+// settings of a frpc config
+func (cfg *TunnelConfig) connectionLines() []string {
+	var lines []string
+	if cfg.SelfHosted {
+		auth := cfg.Auth
+		lines = append(lines, fmt.Sprintf(`auth.method = "%s"`, auth.method()))
+		switch auth.method() {
+		case AuthMethodToken:
+			lines = append(lines, fmt.Sprintf(`auth.token = "%s"`, cfg.secretValue(AuthTokenEnvVar, auth.Token)))
+		case AuthMethodOIDC:
+			lines = append(lines, fmt.Sprintf(`auth.oidc.clientID = "%s"`, auth.OIDCClientID))
+			if auth.OIDCClientSecret != "" {
+				lines = append(lines, fmt.Sprintf(`auth.oidc.clientSecret = "%s"`, cfg.secretValue(OIDCSecretEnvVar, auth.OIDCClientSecret)))
+			}
+			if auth.OIDCAudience != "" {
+				lines = append(lines, fmt.Sprintf(`auth.oidc.audience = "%s"`, auth.OIDCAudience))
+			}
+			if auth.OIDCScope != "" {
+				lines = append(lines, fmt.Sprintf(`auth.oidc.scope = "%s"`, auth.OIDCScope))
+			}
+			lines = append(lines, fmt.Sprintf(`auth.oidc.tokenEndpointURL = "%s"`, auth.OIDCTokenURL))
+		}
+	}
+
+	if tls := cfg.TLS; tls.enabled() {
+		lines = append(lines, "transport.tls.enable = true")
+		if tls.CAFile != "" {
+			lines = append(lines, fmt.Sprintf(`transport.tls.trustedCaFile = "%s"`, tls.CAFile))
+		}
+		if tls.CertFile != "" {
+			lines = append(lines, fmt.Sprintf(`transport.tls.certFile = "%s"`, tls.CertFile))
+			lines = append(lines, fmt.Sprintf(`transport.tls.keyFile = "%s"`, tls.KeyFile))
+		}
+		if tls.ServerName != "" {
+			lines = append(lines, fmt.Sprintf(`transport.tls.serverName = "%s"`, tls.ServerName))
+		}
+	}
+	lines = append(lines, cfg.transportLines()...)
+	if cfg.ProxyURL != "" {
+		lines = append(lines, fmt.Sprintf(`transport.proxyURL = "%s"`, cfg.proxyURLValue()))
+	}
+	return lines
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RegionAuto picks the region with the lowest connect latency among those
+// defined in config.toml and the built-in one
+const RegionAuto = "auto"
+
+// DefaultRegion is used when nothing else is selected
+const DefaultRegion = "eu"
+
+// Server is a tunnel server and the public names it serves tunnels under
+type Server struct {
+	Region  string `toml:"-" json:"region,omitempty"`
+	Addr    string `toml:"addr" json:"addr"`
+	Port    int    `toml:"port" json:"port"`
+	Domain  string `toml:"domain" json:"domain"`     // HTTP tunnels: <name>.<domain>
+	TCPHost string `toml:"tcp_host" json:"tcp_host"` // TCP tunnels: <tcp_host>:<remote-port>
+
+	URLTemplate string     `toml:"url_template" json:"url_template,omitempty"` // overrides https://{name}.{domain}
+	SelfHosted  bool       `toml:"-" json:"self_hosted,omitempty"`
+	Auth        AuthConfig `toml:"-" json:"-"`
+	TLS         TLSConfig  `toml:"-" json:"-"`
+	EgressProxy string     `toml:"-" json:"-"` // proxy URL frpc connects through, empty for direct
+
+	Transport TransportConfig `toml:"transport" json:"transport,omitempty"` // e.g. wss on port 443
+}
+
+// Regions are the built-in lum.tools regions
+var Regions = map[string]Server{
+	DefaultRegion: {
+		Region:  DefaultRegion,
+		Addr:    DefaultServerAddr,
+		Port:    DefaultServerPort,
+		Domain:  "t.lum.tools",
+		TCPHost: "frp.lum.tools",
+	},
+}
+
+// DefaultServer returns the server of the default region
+func DefaultServer() Server {
+	return Regions[DefaultRegion]
+}
+
+// Address returns host:port for connecting to the server
+func (s Server) Address() string {
+	return net.JoinHostPort(s.Addr, strconv.Itoa(s.Port))
+}
+
+// HTTPURL returns the public URL of an HTTP tunnel, rendering {name} and
+// {domain} into the server's URL template
+func (s Server) HTTPURL(name string) string {
+	tmpl := s.URLTemplate
+	if tmpl == "" {
+		tmpl = DefaultURLTemplate
+	}
+	return strings.NewReplacer("{name}", name, "{domain}", s.Domain).Replace(tmpl)
+}
+
+// CustomURL returns the public URL of an HTTP tunnel on a custom domain,
+// keeping the scheme and port of the server's URL template
+func (s Server) CustomURL(domain string) string {
+	tmpl := s.URLTemplate
+	if tmpl == "" || !strings.Contains(tmpl, "{name}.{domain}") {
+		tmpl = DefaultURLTemplate
+	}
+	return strings.Replace(tmpl, "{name}.{domain}", domain, 1)
+}
+
+// CNAMETarget returns the host custom domains must point at
+func (s Server) CNAMETarget() string {
+	return s.TCPHost
+}
+
+// TCPAddress returns the public host:port of a TCP tunnel
+func (s Server) TCPAddress(remotePort int) string {
+	return net.JoinHostPort(s.TCPHost, strconv.Itoa(remotePort))
+}
+
+// Apply points a tunnel config at the server
+func (s Server) Apply(cfg *TunnelConfig) {
+	cfg.ServerAddr = s.Addr
+	cfg.ServerPort = s.Port
+	cfg.SelfHosted = s.SelfHosted
+	cfg.Auth = s.Auth
+	cfg.TLS = s.TLS
+	cfg.ProxyURL = s.EgressProxy
+	cfg.Transport = s.Transport
+}
+
+// ServerOptions are the command-line choices for the tunnel server
+type ServerOptions struct {
+	Server        string // host or host:port
+	Region        string // region name or "auto"
+	SubdomainHost string // public domain override
+
+	URLTemplate string // public URL template override
+	EgressProxy string // proxy URL, or "none" to ignore the environment
+	Transport   TransportConfig
+}
+
+// AllRegions returns the built-in regions plus those defined in config.toml
+func (c *Config) AllRegions() map[string]Server {
+	regions := make(map[string]Server, len(Regions)+len(c.Regions))
+	for name, s := range Regions {
+		regions[name] = s
+	}
+	for name, s := range c.Regions {
+		s.Region = name
+		if s.Port == 0 {
+			s.Port = DefaultServerPort
+		}
+		if s.Domain == "" {
+			s.Domain = deriveDomain(s.Addr)
+		}
+		if s.TCPHost == "" {
+			s.TCPHost = s.Addr
+		}
+		regions[name] = s
+	}
+	return regions
+}
+
+// ResolveServer picks the tunnel server with priority:
+// --server > --region > LROK_SERVER > LROK_REGION > profile server > profile region > default.
+// The public domain comes from --subdomain-host, LROK_SUBDOMAIN_HOST, the profile, or the server itself.
+// A self-hosted profile also supplies frps auth and TLS; LROK_AUTH_TOKEN overrides its token.
+// The egress proxy comes from --egress-proxy or the environment (see ResolveEgressProxy).
+// Transport settings layer flags over LROK_TRANSPORT over the profile over the region.
+func ResolveServer(ctx context.Context, opts ServerOptions) (*Server, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	profile, _ := cfg.Profile(cfg.ActiveProfileName())
+	if profile == nil {
+		profile = &Profile{}
+	}
+
+	// Flags beat the environment, which beats the profile; within each
+	// level an explicit server beats a region
+	serverAddr, region := opts.Server, opts.Region
+	if serverAddr == "" && region == "" {
+		serverAddr, region = os.Getenv("LROK_SERVER"), os.Getenv("LROK_REGION")
+	}
+	if serverAddr == "" && region == "" {
+		serverAddr, region = profile.Server, profile.Region
+	}
+	selfHosted := profile.SelfHosted
+	if selfHosted.Enabled && serverAddr == "" && region == "" {
+		return nil, fmt.Errorf("self-hosted profile '%s' has no server (lrok profile set %s server=host:port)", cfg.ActiveProfileName(), cfg.ActiveProfileName())
+	}
+
+	var server Server
+	switch {
+	case serverAddr != "":
+		s, err := ParseServer(serverAddr)
+		if err != nil {
+			return nil, err
+		}
+		server = s
+	case region == RegionAuto && len(cfg.Regions) == 0:
+		// Nothing to choose between without regions of your own
+		server = DefaultServer()
+	case region == RegionAuto:
+		s, err := ClosestRegion(ctx, cfg.AllRegions(), 2*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		server = s
+	case region != "":
+		s, ok := cfg.AllRegions()[region]
+		if !ok {
+			return nil, fmt.Errorf("unknown region '%s' (see 'lrok regions')", region)
+		}
+		server = s
+	default:
+		server = DefaultServer()
+	}
+
+	if domain := firstNonEmpty(opts.SubdomainHost, os.Getenv("LROK_SUBDOMAIN_HOST"), profile.SubdomainHost); domain != "" {
+		server.Domain = domain
+	}
+	if tmpl := firstNonEmpty(opts.URLTemplate, os.Getenv("LROK_URL_TEMPLATE"), selfHosted.URLTemplate); tmpl != "" {
+		if err := ValidateURLTemplate(tmpl); err != nil {
+			return nil, err
+		}
+		server.URLTemplate = tmpl
+	}
+
+	if selfHosted.Enabled {
+		server.SelfHosted = true
+		server.Auth = selfHosted.Auth
+		server.TLS = selfHosted.TLS
+		if token := os.Getenv("LROK_AUTH_TOKEN"); token != "" {
+			server.Auth.Token = token
+		}
+		if err := server.Auth.Validate(); err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", cfg.ActiveProfileName(), err)
+		}
+		if err := server.TLS.Validate(); err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", cfg.ActiveProfileName(), err)
+		}
+	}
+
+	server.Transport = server.Transport.
+		merge(profile.Transport).
+		merge(TransportConfig{Protocol: os.Getenv("LROK_TRANSPORT")}).
+		merge(opts.Transport)
+
+	proxyURL, _, err := ResolveEgressProxy(opts.EgressProxy, server.Addr, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL != nil {
+		server.EgressProxy = proxyURL.String()
+	}
+	return &server, nil
+}
+
+// ParseServer builds a custom server from host or host:port
+func ParseServer(value string) (Server, error) {
+	host, port := value, DefaultServerPort
+	if h, p, err := net.SplitHostPort(value); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return Server{}, fmt.Errorf("invalid server port in '%s'", value)
+		}
+		host, port = h, n
+	}
+	if host == "" {
+		return Server{}, fmt.Errorf("invalid server '%s'", value)
+	}
+
+	// The built-in regions keep their public names when addressed directly
+	for _, s := range Regions {
+		if (host == s.Addr || host == s.TCPHost) && port == s.Port {
+			return s, nil
+		}
+	}
+
+	return Server{
+		Addr:    host,
+		Port:    port,
+		Domain:  deriveDomain(host),
+		TCPHost: host,
+	}, nil
+}
+
+// deriveDomain guesses the HTTP tunnel domain of a server: frp.example.com
+// serves t.example.com (the lum.tools layout); anything else serves itself
+func deriveDomain(host string) string {
+	if rest, ok := strings.CutPrefix(host, "frp."); ok && net.ParseIP(host) == nil {
+		return "t." + rest
+	}
+	return host
+}
+
+// ProbeResult is the measured connect latency to a region
+type ProbeResult struct {
+	Region  string        `json:"region"`
+	Server  Server        `json:"server"`
+	Latency time.Duration `json:"latency_ns"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ProbeRegions measures TCP connect time to every region concurrently,
+// fastest first; unreachable regions sort last
+func ProbeRegions(ctx context.Context, regions map[string]Server, timeout time.Duration) []ProbeResult {
+	results := make([]ProbeResult, 0, len(regions))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, s := range regions {
+		wg.Add(1)
+		go func(name string, s Server) {
+			defer wg.Done()
+
+			result := ProbeResult{Region: name, Server: s}
+			dialer := net.Dialer{Timeout: timeout}
+			start := time.Now()
+			conn, err := dialer.DialContext(ctx, "tcp", s.Address())
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Latency = time.Since(start)
+				conn.Close()
+			}
+
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(name, s)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Error == "") != (b.Error == "") {
+			return a.Error == ""
+		}
+		if a.Latency != b.Latency {
+			return a.Latency < b.Latency
+		}
+		return a.Region < b.Region
+	})
+	return results
+}
+
+// ClosestRegion returns the reachable region with the lowest latency
+func ClosestRegion(ctx context.Context, regions map[string]Server, timeout time.Duration) (Server, error) {
+	results := ProbeRegions(ctx, regions, timeout)
+	if len(results) == 0 || results[0].Error != "" {
+		return Server{}, fmt.Errorf("no region reachable")
+	}
+	return results[0].Server, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
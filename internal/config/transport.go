@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transport protocols frpc can connect to the server with
+const (
+	TransportTCP       = "tcp"
+	TransportWebSocket = "websocket"
+	TransportWSS       = "wss"
+	TransportQUIC      = "quic"
+	TransportKCP       = "kcp"
+)
+
+// TransportConfig tunes the connection to the tunnel server (transport.* in
+// frpc). Zero values keep frpc's defaults.
+type TransportConfig struct {
+	Protocol          string `toml:"protocol,omitempty" json:"protocol,omitempty"`       // tcp, websocket, wss, quic or kcp
+	DisableTLS        bool   `toml:"disable_tls,omitempty" json:"disable_tls,omitempty"` // frpc uses TLS by default
+	PoolCount         int    `toml:"pool_count,omitempty" json:"pool_count,omitempty"`
+	HeartbeatInterval int    `toml:"heartbeat_interval,omitempty" json:"heartbeat_interval,omitempty"` // seconds, -1 disables
+	HeartbeatTimeout  int    `toml:"heartbeat_timeout,omitempty" json:"heartbeat_timeout,omitempty"`   // seconds
+	DisableTCPMux     bool   `toml:"disable_tcp_mux,omitempty" json:"disable_tcp_mux,omitempty"`
+	TCPMuxKeepalive   int    `toml:"tcp_mux_keepalive_interval,omitempty" json:"tcp_mux_keepalive_interval,omitempty"` // seconds
+
+	// Set by an explicit --transport-tls or --tcp-mux to turn back on what a
+	// profile or region disabled
+	EnableTLS    bool `toml:"-" json:"enable_tls,omitempty"`
+	EnableTCPMux bool `toml:"-" json:"enable_tcp_mux,omitempty"`
+}
+
+// UDP reports whether the protocol runs over UDP rather than TCP
+func (t TransportConfig) UDP() bool {
+	return t.Protocol == TransportQUIC || t.Protocol == TransportKCP
+}
+
+// String describes the non-default settings, e.g. "wss, pool 5"
+func (t TransportConfig) String() string {
+	parts := []string{t.Protocol}
+	if t.Protocol == "" {
+		parts[0] = TransportTCP
+	}
+	if t.DisableTLS {
+		parts = append(parts, "no TLS")
+	}
+	if t.PoolCount > 0 {
+		parts = append(parts, fmt.Sprintf("pool %d", t.PoolCount))
+	}
+	if t.DisableTCPMux {
+		parts = append(parts, "no mux")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// merge returns t with every setting made in o applied on top
+func (t TransportConfig) merge(o TransportConfig) TransportConfig {
+	if o.Protocol != "" {
+		t.Protocol = o.Protocol
+	}
+	if o.DisableTLS {
+		t.DisableTLS = true
+	} else if o.EnableTLS {
+		t.DisableTLS = false
+	}
+	if o.PoolCount != 0 {
+		t.PoolCount = o.PoolCount
+	}
+	if o.HeartbeatInterval != 0 {
+		t.HeartbeatInterval = o.HeartbeatInterval
+	}
+	if o.HeartbeatTimeout != 0 {
+		t.HeartbeatTimeout = o.HeartbeatTimeout
+	}
+	if o.DisableTCPMux {
+		t.DisableTCPMux = true
+	} else if o.EnableTCPMux {
+		t.DisableTCPMux = false
+	}
+	if o.TCPMuxKeepalive != 0 {
+		t.TCPMuxKeepalive = o.TCPMuxKeepalive
+	}
+	return t
+}
+
+// transportLines renders the transport settings of a frpc config
+func (cfg *TunnelConfig) transportLines() []string {
+	t := cfg.Transport
+	var lines []string
+	if t.Protocol != "" {
+		lines = append(lines, fmt.Sprintf(`transport.protocol = "%s"`, t.Protocol))
+	}
+	if t.DisableTLS {
+		lines = append(lines, "transport.tls.enable = false")
+	}
+	if t.PoolCount > 0 {
+		lines = append(lines, fmt.Sprintf("transport.poolCount = %d", t.PoolCount))
+	}
+	if t.HeartbeatInterval != 0 {
+		lines = append(lines, fmt.Sprintf("transport.heartbeatInterval = %d", t.HeartbeatInterval))
+	}
+	if t.HeartbeatTimeout != 0 {
+		lines = append(lines, fmt.Sprintf("transport.heartbeatTimeout = %d", t.HeartbeatTimeout))
+	}
+	if t.DisableTCPMux {
+		lines = append(lines, "transport.tcpMux = false")
+	}
+	if t.TCPMuxKeepalive > 0 {
+		lines = append(lines, fmt.Sprintf("transport.tcpMuxKeepaliveInterval = %d", t.TCPMuxKeepalive))
+	}
+	return lines
+}
@@ -0,0 +1,334 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Info describes a running lrok instance
+type Info struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	PID       int       `json:"pid"`
+	URL       string    `json:"url,omitempty"`
+	Local     string    `json:"local"`
+	Dashboard string    `json:"dashboard,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	Socket    string    `json:"socket"`
+}
+
+// Status is the live state reported by a running instance
+type Status struct {
+	Info
+	State         string  `json:"state"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	BytesIn       int64   `json:"bytes_in"`
+	BytesOut      int64   `json:"bytes_out"`
+	Connections   int64   `json:"connections"`
+}
+
+// Uptime returns the uptime rounded to seconds
+func (s Status) Uptime() time.Duration {
+	return time.Duration(s.UptimeSeconds * float64(time.Second)).Round(time.Second)
+}
+
+// StatusFunc returns the current status of the instance
+type StatusFunc func() Status
+
+// Server exposes a running instance on a unix control socket
+type Server struct {
+	runDir   string
+	info     Info
+	status   StatusFunc
+	stop     func()
+	logs     *LogBuffer
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewServer creates a control server registering in runDir
+func NewServer(runDir string, info Info, status StatusFunc, stop func(), logs *LogBuffer) *Server {
+	if info.PID == 0 {
+		info.PID = os.Getpid()
+	}
+	if info.StartTime.IsZero() {
+		info.StartTime = time.Now()
+	}
+	return &Server{
+		runDir: runDir,
+		info:   info,
+		status: status,
+		stop:   stop,
+		logs:   logs,
+	}
+}
+
+// Start registers the instance and starts serving the control socket
+func (s *Server) Start() error {
+	if err := checkName(s.info.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.runDir, 0700); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	socketPath := filepath.Join(s.runDir, s.info.Name+".sock")
+
+	// Another instance with the same name may still be alive
+	if _, err := Dial(socketPath).Status(); err == nil {
+		return fmt.Errorf("a tunnel named '%s' is already running", s.info.Name)
+	}
+	os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	os.Chmod(socketPath, 0600)
+
+	s.listener = listener
+	s.info.Socket = socketPath
+
+	data, err := json.MarshalIndent(s.info, "", "  ")
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	if err := os.WriteFile(s.infoPath(), data, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to register instance: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/stop", s.handleStop)
+	mux.HandleFunc("/logs", s.handleLogs)
+
+	s.server = &http.Server{Handler: mux}
+	go s.server.Serve(listener)
+
+	return nil
+}
+
+// Stop stops serving and removes the registration
+func (s *Server) Stop() error {
+	if s.server != nil {
+		s.server.Close()
+	}
+	os.Remove(s.info.Socket)
+	os.Remove(s.infoPath())
+	return nil
+}
+
+// checkName keeps instance names from escaping the run directory
+func checkName(name string) error {
+	if name == "" || name == "." || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid tunnel name '%s'", name)
+	}
+	return nil
+}
+
+func (s *Server) infoPath() string {
+	return filepath.Join(s.runDir, s.info.Name+".json")
+}
+
+func (s *Server) currentStatus() Status {
+	status := Status{}
+	if s.status != nil {
+		status = s.status()
+	}
+	status.Info = s.info
+	status.UptimeSeconds = time.Since(s.info.StartTime).Seconds()
+	return status
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.currentStatus())
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if s.stop != nil {
+		go s.stop()
+	}
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if s.logs == nil {
+		return
+	}
+
+	if r.URL.Query().Get("follow") != "1" {
+		for _, line := range s.logs.Lines() {
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+
+	existing, ch := s.logs.Follow()
+	defer s.logs.Unfollow(ch)
+
+	flusher, _ := w.(http.Flusher)
+	for _, line := range existing {
+		fmt.Fprintln(w, line)
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-ch:
+			fmt.Fprintln(w, line)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// Client talks to a running instance over its control socket
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// Dial creates a client for the given socket path
+func Dial(socketPath string) *Client {
+	return &Client{
+		socket: socketPath,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Status fetches the live status of the instance
+func (c *Client) Status() (*Status, error) {
+	c.http.Timeout = 2 * time.Second
+	resp, err := c.http.Get("http://lrok/status")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("invalid status response: %w", err)
+	}
+	return &status, nil
+}
+
+// Stop asks the instance to shut down gracefully
+func (c *Client) Stop() error {
+	c.http.Timeout = 2 * time.Second
+	resp, err := c.http.Post("http://lrok/stop", "text/plain", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("stop request returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Logs copies the instance's output to w, streaming new lines if follow is set
+func (c *Client) Logs(ctx context.Context, w io.Writer, follow bool) error {
+	url := "http://lrok/logs"
+	if follow {
+		url += "?follow=1"
+	} else {
+		c.http.Timeout = 5 * time.Second
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fmt.Fprintln(w, scanner.Text())
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// List returns the status of every live instance registered in runDir,
+// removing registrations left behind by instances that no longer respond
+func List(runDir string) ([]*Status, error) {
+	entries, err := os.ReadDir(runDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run directory: %w", err)
+	}
+
+	var result []*Status
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		socketPath := filepath.Join(runDir, name+".sock")
+
+		status, err := Dial(socketPath).Status()
+		if err != nil {
+			// Stale registration from a crashed instance
+			os.Remove(socketPath)
+			os.Remove(filepath.Join(runDir, entry.Name()))
+			continue
+		}
+		result = append(result, status)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result, nil
+}
+
+// Find returns a client for the named instance
+func Find(runDir, name string) (*Client, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	socketPath := filepath.Join(runDir, name+".sock")
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, fmt.Errorf("no running tunnel named '%s' (see 'lrok list')", name)
+	}
+	return Dial(socketPath), nil
+}
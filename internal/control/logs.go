@@ -0,0 +1,99 @@
+package control
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// LogBuffer keeps the most recent output lines of a running instance and
+// lets followers receive new lines as they are written
+type LogBuffer struct {
+	lines     []string
+	maxLines  int
+	partial   bytes.Buffer
+	followers []chan string
+	mu        sync.Mutex
+}
+
+// NewLogBuffer creates a buffer holding up to maxLines lines
+func NewLogBuffer(maxLines int) *LogBuffer {
+	if maxLines == 0 {
+		maxLines = 1000
+	}
+	return &LogBuffer{
+		lines:    make([]string, 0, maxLines),
+		maxLines: maxLines,
+	}
+}
+
+// Write implements io.Writer, splitting input into lines
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.partial.Write(p)
+	for {
+		data := b.partial.Bytes()
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimRight(string(data[:idx]), "\r")
+		b.partial.Next(idx + 1)
+		b.append(line)
+	}
+
+	return len(p), nil
+}
+
+func (b *LogBuffer) append(line string) {
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.maxLines {
+		b.lines = b.lines[1:]
+	}
+
+	for _, ch := range b.followers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// Lines returns a copy of the buffered lines
+func (b *LogBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	result := make([]string, len(b.lines))
+	copy(result, b.lines)
+	return result
+}
+
+// Follow returns the buffered lines and a channel receiving new ones
+func (b *LogBuffer) Follow() ([]string, chan string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	existing := make([]string, len(b.lines))
+	copy(existing, b.lines)
+
+	ch := make(chan string, 100)
+	b.followers = append(b.followers, ch)
+	return existing, ch
+}
+
+// Unfollow stops delivering lines to ch
+func (b *LogBuffer) Unfollow(ch chan string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, follower := range b.followers {
+		if follower == ch {
+			b.followers = append(b.followers[:i], b.followers[i+1:]...)
+			close(ch)
+			break
+		}
+	}
+}
@@ -5,13 +5,19 @@ import (
 	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/lum-tools/lrok/internal/relay"
 )
 
 // handleRequests serves the request list API
 func (s *Server) handleRequests(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
-	requests := s.proxy.GetRequests()
+	requests := []*proxy.Request{}
+	if s.proxy != nil {
+		requests = s.proxy.GetRequests()
+	}
 	json.NewEncoder(w).Encode(requests)
 }
 
@@ -20,6 +26,10 @@ func (s *Server) handleRequestsStream(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+	if s.proxy == nil {
+		http.Error(w, "no HTTP inspector for this tunnel", http.StatusNotFound)
+		return
+	}
 	
 	// Subscribe to new requests
 	ch := s.proxy.Subscribe()
@@ -44,6 +54,63 @@ func (s *Server) handleRequestsStream(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleConnections serves the connections recorded by the relay
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	conns := []relay.Conn{}
+	if s.relay != nil {
+		conns = s.relay.Connections()
+	}
+	json.NewEncoder(w).Encode(conns)
+}
+
+// handleConnectionsStream serves an SSE stream of connections as they open
+// and close
+func (s *Server) handleConnectionsStream(w http.ResponseWriter, r *http.Request) {
+	if s.relay == nil {
+		http.Error(w, "no connection inspector for this tunnel", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := s.relay.Subscribe()
+	defer s.relay.Unsubscribe(ch)
+
+	send := func(conn relay.Conn) {
+		data, _ := json.Marshal(conn)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	conns := s.relay.Connections()
+	for i := len(conns) - 1; i >= 0; i-- {
+		send(conns[i])
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case conn := <-ch:
+			send(conn)
+		}
+	}
+}
+
+// handleUpstreams serves per-upstream health and traffic
+func (s *Server) handleUpstreams(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	
+	upstreams := []proxy.UpstreamStats{}
+	if s.proxy != nil {
+		upstreams = append(upstreams, s.proxy.UpstreamStats()...)
+	}
+	json.NewEncoder(w).Encode(upstreams)
+}
+
 // Enhanced handleIndex with request inspector
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -76,6 +143,11 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         /* Stats Grid */
         .stats { display: grid; grid-template-columns: repeat(auto-fit, minmax(150px, 1fr)); gap: 12px; margin-top: 16px; }
         .stat { background: rgba(255, 255, 255, 0.05); padding: 12px; border-radius: 6px; text-align: center; }
+        .upstreams { width: 100%%; border-collapse: collapse; font-size: 13px; }
+        .upstreams th { text-align: left; font-size: 11px; color: #888; text-transform: uppercase; padding: 6px 8px; }
+        .upstreams td { padding: 6px 8px; border-top: 1px solid #222; }
+        .up { color: #10b981; }
+        .down { color: #E94055; }
         .stat-label { font-size: 11px; color: #888; text-transform: uppercase; margin-bottom: 4px; }
         .stat-value { font-size: 18px; font-weight: 600; color: #FF8000; }
         
@@ -86,7 +158,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         .btn:hover { background: rgba(255, 128, 0, 0.3); }
         
         .request-list { max-height: 400px; overflow-y: auto; }
-        .request-item { background: rgba(255, 255, 255, 0.03); border: 1px solid #2a2a2a; padding: 12px; margin-bottom: 8px; border-radius: 6px; cursor: pointer; transition: all 0.2s; display: grid; grid-template-columns: 80px 60px 80px 1fr 80px 120px; gap: 12px; align-items: center; font-size: 13px; }
+        .request-item { background: rgba(255, 255, 255, 0.03); border: 1px solid #2a2a2a; padding: 12px; margin-bottom: 8px; border-radius: 6px; cursor: pointer; transition: all 0.2s; display: grid; grid-template-columns: 80px 60px 80px 1fr 80px 120px 80px; gap: 12px; align-items: center; font-size: 13px; }
         .request-item:hover { background: rgba(255, 255, 255, 0.08); border-color: #FF8000; }
         
         .req-time { color: #888; font-size: 12px; }
@@ -99,6 +171,14 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         .req-path { color: #f0f0f0; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
         .req-duration { color: #888; font-size: 12px; }
         .req-size { color: #888; font-size: 12px; }
+        .req-trace { color: #666; font-size: 11px; font-family: monospace; }
+        .conn-item { grid-template-columns: 80px 180px 1fr 90px 80px 120px; }
+        .conn-event { color: #888; font-family: monospace; font-size: 12px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+        .conn-proto { color: #FF8000; font-weight: 600; margin-right: 6px; }
+        .events { width: 100%%; border-collapse: collapse; font-size: 12px; }
+        .events td { padding: 4px 8px; border-top: 1px solid #222; vertical-align: top; }
+        .events td:last-child { font-family: monospace; word-break: break-all; }
+        .conn-open { color: #10b981; font-size: 12px; }
         
         .empty { text-align: center; padding: 40px; color: #666; font-size: 14px; }
         
@@ -148,9 +228,18 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                     <div class="stat-value" id="uptime">%s</div>
                 </div>
             </div>
+            <div class="info" id="limits" style="display: none; margin-top: 12px;"></div>
         </div>
         
-        <div class="card">
+        <div class="card" id="upstreams-card" style="display: none;">
+            <h2 style="margin-bottom: 12px; font-size: 16px; color: #f0f0f0;">⚖️ Upstreams</h2>
+            <table class="upstreams">
+                <thead><tr><th>Route</th><th>Upstream</th><th>Health</th><th>Active</th><th>Requests</th><th>Failures</th></tr></thead>
+                <tbody id="upstreams"></tbody>
+            </table>
+        </div>
+        
+        <div class="card" id="requests-card" style="display: %s;">
             <div class="requests-header">
                 <h2>🔍 Request Inspector</h2>
                 <div>
@@ -163,6 +252,18 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             </div>
         </div>
         
+        <div class="card" id="connections-card" style="display: %s;">
+            <div class="requests-header">
+                <h2>🔌 Connections</h2>
+                <div>
+                    <button class="btn" onclick="clearConnections()">Clear</button>
+                </div>
+            </div>
+            <div class="request-list" id="connectionList">
+                <div class="empty">No connections yet.</div>
+            </div>
+        </div>
+        
         <div class="card">
             <h2 style="margin-bottom: 12px; font-size: 16px; color: #f0f0f0;">💡 Tips</h2>
             <ul style="list-style: none; padding: 0; color: #888; font-size: 13px; line-height: 1.8;">
@@ -186,22 +287,154 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 document.getElementById('bytes-out').textContent = formatBytes(data.bytes_out);
                 document.getElementById('connections').textContent = data.connections;
                 document.getElementById('uptime').textContent = formatDuration(data.start_time);
+                updateLimits(data);
+            } catch (e) {}
+            updateUpstreams();
+        }
+        
+        // Local limits from --max-bytes, --max-conns and --expire-after
+        function updateLimits(data) {
+            const limits = data.limits || {};
+            const parts = [];
+            if (limits.max_bytes) parts.push('📦 ' + formatBytes(data.bytes_in + data.bytes_out) + ' of ' + formatBytes(limits.max_bytes));
+            if (limits.max_conns) parts.push('🔗 ' + data.active + ' of ' + limits.max_conns + ' connections (' + data.rejected + ' refused)');
+            if (data.expires_at) parts.push('⏰ expires ' + new Date(data.expires_at).toLocaleTimeString());
+            document.getElementById('limits').style.display = parts.length ? '' : 'none';
+            document.getElementById('limits').textContent = parts.join(' • ');
+        }
+        
+        // Per-upstream health, shown when there is more than one upstream
+        async function updateUpstreams() {
+            try {
+                const response = await fetch('/api/upstreams');
+                const upstreams = await response.json();
+                document.getElementById('upstreams-card').style.display = upstreams.length > 1 ? '' : 'none';
+                document.getElementById('upstreams').innerHTML = upstreams.map(u => ` + "`" + `
+                    <tr title="${u.last_error || ''}">
+                        <td>${u.route}</td>
+                        <td><code>${u.url}</code></td>
+                        <td class="${u.healthy ? 'up' : 'down'}">${u.healthy ? '● healthy' : '● down'}</td>
+                        <td>${u.active}</td>
+                        <td>${u.requests}</td>
+                        <td>${u.failures}</td>
+                    </tr>
+                ` + "`" + `).join('');
             } catch (e) {}
         }
         
         // Load requests via SSE
-        const eventSource = new EventSource('/api/requests/stream');
         const requests = [];
+        if (document.getElementById('requests-card').style.display !== 'none') {
+            const eventSource = new EventSource('/api/requests/stream');
+            eventSource.onmessage = function(event) {
+                if (paused) return;
+                
+                const req = JSON.parse(event.data);
+                requests.unshift(req);
+                if (requests.length > 100) requests.pop();
+                
+                renderRequests();
+            };
+        }
         
-        eventSource.onmessage = function(event) {
-            if (paused) return;
-            
-            const req = JSON.parse(event.data);
-            requests.unshift(req);
-            if (requests.length > 100) requests.pop();
-            
-            renderRequests();
-        };
+        // Load raw TCP connections via SSE; each arrives when it opens and again when it closes
+        const connections = [];
+        if (document.getElementById('connections-card').style.display !== 'none') {
+            const connSource = new EventSource('/api/connections/stream');
+            connSource.onmessage = function(event) {
+                const conn = JSON.parse(event.data);
+                const i = connections.findIndex(c => c.id === conn.id);
+                if (i >= 0) {
+                    connections[i] = conn;
+                } else {
+                    connections.unshift(conn);
+                    if (connections.length > 100) connections.pop();
+                }
+                renderConnections();
+            };
+        }
+        
+        function renderConnections() {
+            const container = document.getElementById('connectionList');
+            if (connections.length === 0) {
+                container.innerHTML = '<div class="empty">No connections yet.</div>';
+                return;
+            }
+            container.innerHTML = connections.map(conn => {
+                const time = new Date(conn.start).toLocaleTimeString();
+                const state = conn.error
+                    ? '<span class="down" title="' + escapeHtml(conn.error) + '">● error</span>'
+                    : conn.end ? '<span class="req-duration">closed</span>' : '<span class="conn-open">● open</span>';
+                return ` + "`" + `
+                    <div class="request-item conn-item" onclick="showConnection('${conn.id}')">
+                        <div class="req-time">${time}</div>
+                        <div class="req-path">${escapeHtml(conn.remote_addr)}</div>
+                        <div class="conn-event">${connSummary(conn)}</div>
+                        <div>${state}</div>
+                        <div class="req-duration">${formatConnDuration(conn.duration)}</div>
+                        <div class="req-size">↓${formatBytes(conn.bytes_in)} ↑${formatBytes(conn.bytes_out)}</div>
+                    </div>
+                ` + "`" + `;
+            }).join('');
+        }
+        
+        function showConnection(id) {
+            const conn = connections.find(c => c.id === id);
+            if (!conn) return;
+            const modal = ` + "`" + `
+                <div style="position: fixed; top: 0; left: 0; right: 0; bottom: 0; background: rgba(0,0,0,0.8); z-index: 1000; overflow-y: auto; padding: 20px;" onclick="this.remove()">
+                    <div class="card" style="max-width: 900px; margin: 40px auto;" onclick="event.stopPropagation()">
+                        <div style="margin-bottom: 20px;">
+                            <button class="btn" onclick="this.closest('[style*=fixed]').remove()">◀ Back</button>
+                        </div>
+                        <h2 style="font-size: 20px; margin-bottom: 8px; color: #FF8000;">${escapeHtml(conn.remote_addr)}</h2>
+                        <div style="font-size: 13px; color: #888; margin-bottom: 20px;">
+                            ${new Date(conn.start).toLocaleString()}
+                            • ${conn.end ? formatConnDuration(conn.duration) : 'open'}
+                            • ↓ ${formatBytes(conn.bytes_in)}
+                            • ↑ ${formatBytes(conn.bytes_out)}
+                        </div>
+                        ${conn.error ? ` + "`" + `
+                        <div style="background: #0a0a0a; border-left: 3px solid #E94055; padding: 12px; border-radius: 4px; font-size: 13px; margin-bottom: 16px;">${escapeHtml(conn.error)}</div>
+                        ` + "`" + ` : ''}
+                        ${conn.events && conn.events.length ? ` + "`" + `
+                        <h3 style="font-size: 14px; color: #f0f0f0; margin: 16px 0 8px;">🧩 ${escapeHtml(conn.protocol)} messages</h3>
+                        <table class="events">${conn.events.map(e => ` + "`" + `
+                            <tr>
+                                <td style="color: #666;">${new Date(e.time).toLocaleTimeString()}</td>
+                                <td>${e.client ? 'client →' : '← server'}</td>
+                                <td class="${e.kind === 'error' ? 'down' : ''}">${escapeHtml(e.kind)}</td>
+                                <td>${escapeHtml(e.text)}</td>
+                            </tr>` + "`" + `).join('')}
+                        </table>
+                        ` + "`" + ` : ''}
+                        <h3 style="font-size: 14px; color: #f0f0f0; margin: 16px 0 8px;">📥 First bytes received</h3>
+                        <pre style="background: #0a0a0a; padding: 12px; border-radius: 4px; font-size: 12px; overflow-x: auto; color: #10b981;">${escapeHtml(conn.first_in || '(none)')}</pre>
+                        <h3 style="font-size: 14px; color: #f0f0f0; margin: 16px 0 8px;">📤 First bytes sent</h3>
+                        <pre style="background: #0a0a0a; padding: 12px; border-radius: 4px; font-size: 12px; overflow-x: auto; color: #E94055;">${escapeHtml(conn.first_out || '(none)')}</pre>
+                    </div>
+                </div>
+            ` + "`" + `;
+            document.body.insertAdjacentHTML('beforeend', modal);
+        }
+        
+        // Protocol and latest decoded message of a connection
+        function connSummary(conn) {
+            if (!conn.protocol) return '';
+            const last = (conn.events || []).filter(e => e.kind === 'query' || e.kind === 'command' || e.kind === 'error').pop()
+                || (conn.events || []).slice(-1)[0];
+            return '<span class="conn-proto">' + escapeHtml(conn.protocol) + '</span>' + (last ? escapeHtml(last.text) : '');
+        }
+        
+        function clearConnections() {
+            connections.length = 0;
+            renderConnections();
+        }
+        
+        function formatConnDuration(ns) {
+            const ms = Math.round(ns / 1000000);
+            return ms < 1000 ? ms + 'ms' : (ms / 1000).toFixed(1) + 's';
+        }
         
         function renderRequests() {
             const container = document.getElementById('requestList');
@@ -221,14 +454,23 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                         <div class="req-time">${time}</div>
                         <div class="req-status ${statusClass}">${req.status_code}</div>
                         <div class="req-method">${req.method}</div>
-                        <div class="req-path">${req.path}</div>
+                        <div class="req-path" title="${req.error ? req.error : req.upstream ? 'served by ' + req.upstream : ''}">${req.path} ${webhookBadge(req.webhook)}${req.verification ? ' <span title="lrok check request">🔍</span>' : ''}</div>
                         <div class="req-duration">${duration}</div>
                         <div class="req-size">↓${formatBytes(req.bytes_in)} ↑${formatBytes(req.bytes_out)}</div>
+                        <div class="req-trace" title="trace ${req.trace_id || ''}">${(req.trace_id || '').slice(0, 8)}</div>
                     </div>
                 ` + "`" + `;
             }).join('');
         }
         
+        // Pass/fail marker for requests checked with --verify-webhook
+        function webhookBadge(webhook) {
+            if (!webhook) return '';
+            return webhook.valid
+                ? '<span class="up" title="' + webhook.provider + ' signature valid">🔏</span>'
+                : '<span class="down" title="' + webhook.provider + ': ' + webhook.reason + '">⚠️</span>';
+        }
+        
         function showRequest(id) {
             const req = requests.find(r => r.id === id);
             if (!req) return;
@@ -261,7 +503,26 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                             • ${Math.round(req.duration / 1000000)}ms
                             • ↓ ${formatBytes(req.bytes_in)}
                             • ↑ ${formatBytes(req.bytes_out)}
+                            ${req.trace_id ? ` + "`" + `• trace <code style="color: #f0f0f0;">${req.trace_id}</code>` + "`" + ` : ''}
+                            ${req.upstream ? ` + "`" + `• upstream <code style="color: #f0f0f0;">${req.upstream}</code>` + "`" + ` : ''}
+                            ${req.held ? ` + "`" + `• held ${Math.round(req.held / 1000000)}ms` + "`" + ` : ''}
+                            ${req.verification ? '• lrok check request' : ''}
+                        </div>
+                        
+                        ${req.error ? ` + "`" + `
+                        <div style="background: #0a0a0a; border-left: 3px solid #E94055; padding: 12px; border-radius: 4px; font-size: 13px; margin-bottom: 16px;">
+                            🔌 <strong>Upstream failed</strong>, answered by lrok
+                            <div style="color: #888; margin-top: 4px;">${escapeHtml(req.error)}</div>
                         </div>
+                        ` + "`" + ` : ''}
+                        
+                        ${req.webhook ? ` + "`" + `
+                        <div style="background: #0a0a0a; padding: 12px; border-radius: 4px; font-size: 13px; margin-bottom: 16px;">
+                            ${webhookBadge(req.webhook)} <strong>${req.webhook.provider}</strong> signature
+                            ${req.webhook.valid ? 'valid' : 'invalid (' + req.webhook.reason.replace('_', ' ') + ')'}${req.webhook.rejected ? ', rejected with 401' : ''}
+                            <div style="color: #888; margin-top: 4px;">${escapeHtml(req.webhook.detail)}</div>
+                        </div>
+                        ` + "`" + ` : ''}
                         
                         <h3 style="font-size: 14px; color: #f0f0f0; margin: 16px 0 8px;">📤 Request Headers</h3>
                         <pre style="background: #0a0a0a; padding: 12px; border-radius: 4px; font-size: 12px; overflow-x: auto; color: #888;">${formatHeaders(req.request_headers)}</pre>
@@ -333,8 +594,18 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 		stats.PublicURL,
 		stats.LocalPort,
 		uptime.String(),
+		display(s.proxy != nil),
+		display(s.relay != nil && s.relay.Recording()),
 	)
 	
 	fmt.Fprint(w, html)
 }
 
+
+// display is the CSS display value showing a card when shown is true
+func display(shown bool) string {
+	if shown {
+		return "block"
+	}
+	return "none"
+}
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/lum-tools/lrok/internal/metrics"
 	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/lum-tools/lrok/internal/tunnel"
 )
 
 // Stats holds tunnel statistics
@@ -22,6 +26,12 @@ type Stats struct {
 	BytesOut     int64     `json:"bytes_out"`
 	Connections  int64     `json:"connections"`
 	mu           sync.RWMutex
+
+	// Set from the relay when the tunnel has one
+	Active    int64        `json:"active"`
+	Rejected  int64        `json:"rejected"`
+	Limits    relay.Limits `json:"limits"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
 }
 
 // UpdateStats updates the tunnel statistics
@@ -46,46 +56,127 @@ func (s *Stats) GetStats() Stats {
 		BytesIn:     s.BytesIn,
 		BytesOut:    s.BytesOut,
 		Connections: s.Connections,
+		Active:      s.Active,
+		Rejected:    s.Rejected,
+		Limits:      s.Limits,
+		ExpiresAt:   s.ExpiresAt,
 	}
 }
 
+// TunnelState reports the state of the frpc process behind a tunnel
+type TunnelState interface {
+	State() string
+	Restarts() int64
+}
+
 // Server is a minimal HTTP server for tunnel dashboard
 type Server struct {
-	stats  *Stats
-	proxy  *proxy.Proxy
-	server *http.Server
-	port   int
+	stats   *Stats
+	proxy   *proxy.Proxy
+	tunnel  TunnelState
+	relay   *relay.Relay
+	server  *http.Server
+	port    int
+	metrics *metrics.Registry
+	state   *metrics.GaugeVec
 }
 
 // New creates a new dashboard server
 func New(stats *Stats, prox *proxy.Proxy) *Server {
-	return &Server{
-		stats: stats,
-		proxy: prox,
+	s := &Server{
+		stats:   stats,
+		proxy:   prox,
+		metrics: metrics.NewRegistry(),
+	}
+	s.registerMetrics()
+	return s
+}
+
+// SetTunnel attaches the tunnel whose state is exported on /metrics
+func (s *Server) SetTunnel(t TunnelState) {
+	s.tunnel = t
+}
+
+// SetRelay attaches the relay counting the tunnel's wire-level traffic
+func (s *Server) SetRelay(r *relay.Relay) {
+	s.relay = r
+}
+
+// relayStats returns the relay counters, zero without a relay
+func (s *Server) relayStats() relay.Stats {
+	if s.relay == nil {
+		return relay.Stats{}
 	}
+	return s.relay.Stats()
+}
+
+// registerMetrics sets up tunnel-level metrics computed at scrape time
+func (s *Server) registerMetrics() {
+	s.metrics.NewGaugeFunc("lrok_tunnel_start_time_seconds",
+		"Unix time the tunnel was started.", func() float64 {
+			return float64(s.stats.GetStats().StartTime.Unix())
+		})
+	s.metrics.NewGaugeFunc("lrok_tunnel_up",
+		"Whether frpc reports the tunnel as connected (1) or not (0).", func() float64 {
+			if s.tunnel != nil && s.tunnel.State() == tunnel.StateConnected {
+				return 1
+			}
+			return 0
+		})
+	s.metrics.NewCounterFunc("lrok_frpc_restarts_total",
+		"Times frpc had to re-establish its session with the server.", func() float64 {
+			if s.tunnel == nil {
+				return 0
+			}
+			return float64(s.tunnel.Restarts())
+		})
+	s.metrics.NewCounterFunc("lrok_tunnel_received_bytes_total",
+		"Bytes received from the public side of the tunnel.", func() float64 {
+			return float64(s.relayStats().BytesIn)
+		})
+	s.metrics.NewCounterFunc("lrok_tunnel_sent_bytes_total",
+		"Bytes sent back to the public side of the tunnel.", func() float64 {
+			return float64(s.relayStats().BytesOut)
+		})
+	s.metrics.NewCounterFunc("lrok_tunnel_connections_total",
+		"Connections accepted through the tunnel.", func() float64 {
+			return float64(s.relayStats().Connections)
+		})
+	s.metrics.NewCounterFunc("lrok_tunnel_rejected_connections_total",
+		"Connections refused by --max-conns.", func() float64 {
+			return float64(s.relayStats().Rejected)
+		})
+	s.metrics.NewGaugeFunc("lrok_tunnel_active_connections",
+		"Connections currently open through the tunnel.", func() float64 {
+			return float64(s.relayStats().Active)
+		})
+	s.state = s.metrics.NewGaugeVec("lrok_tunnel_state",
+		"Current frpc connection state (1 for the active state).", "state")
 }
 
 // Start starts the dashboard server on the specified port (or finds available port)
 func (s *Server) Start(preferredPort int) error {
 	// Try preferred port first, then find available
-	port := preferredPort
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", preferredPort))
 	if err != nil {
 		// Port occupied, find random available port
 		listener, err = net.Listen("tcp", ":0")
 		if err != nil {
 			return fmt.Errorf("failed to start dashboard: %w", err)
 		}
-		port = listener.Addr().(*net.TCPAddr).Port
 	}
 	
-	s.port = port
+	s.port = listener.Addr().(*net.TCPAddr).Port
 	
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleIndex)
 	mux.HandleFunc("/api/stats", s.handleStats)
 	mux.HandleFunc("/api/requests", s.handleRequests)
 	mux.HandleFunc("/api/requests/stream", s.handleRequestsStream)
+	mux.HandleFunc("/api/upstreams", s.handleUpstreams)
+	mux.HandleFunc("/api/connections", s.handleConnections)
+	mux.HandleFunc("/api/connections/stream", s.handleConnectionsStream)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 	
 	s.server = &http.Server{
 		Handler: mux,
@@ -115,14 +206,51 @@ func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	
 	stats := s.stats.GetStats()
 	
-	// Add proxy stats if available
-	if s.proxy != nil {
+	// Wire-level counts from the relay, else the proxy's HTTP counts
+	if s.relay != nil {
+		rs := s.relay.Stats()
+		stats.BytesIn = rs.BytesIn
+		stats.BytesOut = rs.BytesOut
+		stats.Connections = rs.Connections
+		stats.Active = rs.Active
+		stats.Rejected = rs.Rejected
+		stats.Limits = rs.Limits
+		stats.ExpiresAt = rs.ExpiresAt
+	} else if s.proxy != nil {
 		bytesIn, bytesOut, conns := s.proxy.GetStats()
 		stats.BytesIn = bytesIn
 		stats.BytesOut = bytesOut
 		stats.Connections = conns
 	}
 	
-	json.NewEncoder(w).Encode(stats)
+	json.NewEncoder(w).Encode(&stats)
+}
+
+// handleMetrics serves Prometheus/OpenMetrics text exposition
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	current := ""
+	if s.tunnel != nil {
+		current = s.tunnel.State()
+	}
+	for _, state := range tunnel.States {
+		value := 0.0
+		if state == current {
+			value = 1
+		}
+		s.state.Set(value, state)
+	}
+
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", metrics.ContentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", metrics.ContentTypeText)
+	}
+
+	var proxyMetrics *metrics.Registry
+	if s.proxy != nil {
+		proxyMetrics = s.proxy.Metrics()
+	}
+	metrics.WriteAll(w, openMetrics, s.metrics, proxyMetrics)
 }
 
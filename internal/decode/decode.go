@@ -0,0 +1,292 @@
+// Package decode recognises common protocols in a raw TCP stream and
+// summarises their messages: Postgres and MySQL logins and queries, Redis
+// commands, TLS hellos and SSH banners.
+package decode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocols a stream can be decoded as
+const (
+	Auto     = "auto"
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	Redis    = "redis"
+	TLS      = "tls"
+	SSH      = "ssh"
+	Unknown  = "unknown"
+)
+
+// Protocols lists the names Validate accepts
+var Protocols = []string{Auto, Postgres, MySQL, Redis, TLS, SSH}
+
+const (
+	maxEvents  = 100     // most recent events kept per stream
+	maxText    = 500     // characters of an event's text
+	maxMessage = 1 << 20 // bytes buffered for one message before it is skipped
+)
+
+// Event is one decoded protocol message
+type Event struct {
+	Time   time.Time `json:"time"`
+	Client bool      `json:"client"` // sent by the client, else by the server
+	Kind   string    `json:"kind"`   // e.g. startup, query, error
+	Text   string    `json:"text"`
+}
+
+// decoder turns the bytes of one direction into events
+type decoder interface {
+	feed(client bool, data []byte) []Event
+}
+
+// Validate checks a protocol name given to --decode
+func Validate(protocol string) error {
+	for _, p := range Protocols {
+		if protocol == p {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown protocol '%s', must be one of: %s", protocol, strings.Join(Protocols, ", "))
+}
+
+// Stream decodes both directions of one connection
+type Stream struct {
+	mu       sync.Mutex
+	protocol string
+	dec      decoder
+	pending  [2][]byte // bytes seen while detecting the protocol
+	events   []Event
+}
+
+// NewStream decodes a connection as protocol, or detects it with Auto
+func NewStream(protocol string) *Stream {
+	s := &Stream{protocol: protocol}
+	if protocol != Auto {
+		s.dec = newDecoder(protocol)
+	}
+	return s
+}
+
+// Protocol returns the protocol being decoded, empty while detecting
+func (s *Stream) Protocol() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.protocol == Auto {
+		return ""
+	}
+	return s.protocol
+}
+
+// Events returns the most recent events, oldest first
+func (s *Stream) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// Feed decodes bytes sent by the client or the server and returns how many
+// events they produced
+func (s *Stream) Feed(client bool, data []byte) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.protocol == Auto {
+		side := 1
+		if client {
+			side = 0
+		}
+		s.pending[side] = append(s.pending[side], data...)
+		protocol, sure := detect(client, s.pending[side])
+		if !sure {
+			return 0
+		}
+		s.protocol = protocol
+		s.dec = newDecoder(protocol)
+		pending := s.pending
+		s.pending = [2][]byte{}
+
+		// The other side may have sent bytes before this one was recognised
+		n := s.decode(client, pending[side])
+		if other := pending[1-side]; len(other) > 0 {
+			n += s.decode(!client, other)
+		}
+		return n
+	}
+	return s.decode(client, data)
+}
+
+// Stop gives up decoding, keeping the events seen so far
+func (s *Stream) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.protocol == Auto {
+		s.protocol = Unknown
+	}
+	s.dec = nil
+	s.pending = [2][]byte{}
+}
+
+// decode runs the decoder and stores its events; the caller holds s.mu
+func (s *Stream) decode(client bool, data []byte) int {
+	if s.dec == nil {
+		return 0
+	}
+	events := s.dec.feed(client, data)
+	now := time.Now()
+	for i := range events {
+		events[i].Time = now
+		events[i].Client = client
+		events[i].Text = truncate(events[i].Text, maxText)
+	}
+	s.events = append(s.events, events...)
+	if len(s.events) > maxEvents {
+		s.events = s.events[len(s.events)-maxEvents:]
+	}
+	return len(events)
+}
+
+// newDecoder returns the decoder for protocol, nil when there is none
+func newDecoder(protocol string) decoder {
+	switch protocol {
+	case Postgres:
+		return &postgresDecoder{}
+	case MySQL:
+		return &mysqlDecoder{}
+	case Redis:
+		return &redisDecoder{}
+	case TLS:
+		return &tlsDecoder{}
+	case SSH:
+		return &sshDecoder{}
+	}
+	return nil
+}
+
+// detect guesses the protocol from the first bytes one side sent; sure is
+// false while there are too few bytes to tell
+func detect(client bool, b []byte) (protocol string, sure bool) {
+	if bytes.HasPrefix(b, []byte("SSH-")) {
+		return SSH, true
+	}
+	if !client {
+		// MySQL servers speak first: a packet with sequence 0 and protocol 10
+		if len(b) >= 5 && b[3] == 0 && b[4] == 10 {
+			return MySQL, true
+		}
+		return Unknown, len(b) >= 5
+	}
+	if len(b) >= 3 && b[0] == 0x16 && b[1] == 0x03 {
+		return TLS, true
+	}
+	if len(b) >= 8 {
+		switch binary.BigEndian.Uint32(b[4:8]) {
+		case pgProtocol3, pgSSLRequest, pgGSSENCRequest, pgCancelRequest:
+			return Postgres, true
+		}
+	}
+	if len(b) >= 2 && b[0] == '*' && b[1] >= '0' && b[1] <= '9' {
+		return Redis, true
+	}
+	if line, _, found := bytes.Cut(b, []byte("\r\n")); found {
+		// "GET / HTTP/1.1" is a web request, not an inline Redis GET
+		if cmd, _, _ := strings.Cut(string(line), " "); redisInlineCommands[strings.ToUpper(cmd)] && !bytes.Contains(line, []byte(" HTTP/")) {
+			return Redis, true
+		}
+		return Unknown, true
+	}
+	return Unknown, len(b) >= 16
+}
+
+// sshDecoder reports the identification banner each side sends
+type sshDecoder struct {
+	buf  [2][]byte
+	done [2]bool
+}
+
+func (d *sshDecoder) feed(client bool, data []byte) []Event {
+	side := 1
+	if client {
+		side = 0
+	}
+	if d.done[side] {
+		return nil
+	}
+	d.buf[side] = append(d.buf[side], data...)
+	line, _, found := bytes.Cut(d.buf[side], []byte("\n"))
+	if !found {
+		if len(d.buf[side]) > 255 {
+			d.done[side], d.buf[side] = true, nil
+		}
+		return nil
+	}
+	d.done[side], d.buf[side] = true, nil
+	return []Event{{Kind: "banner", Text: strings.TrimSpace(string(line))}}
+}
+
+// framer buffers one direction of a length-prefixed protocol, skipping
+// messages too large to keep
+type framer struct {
+	buf  []byte
+	skip int
+}
+
+// add appends data, first dropping bytes of a skipped message
+func (f *framer) add(data []byte) {
+	if f.skip > 0 {
+		n := min(f.skip, len(data))
+		f.skip -= n
+		data = data[n:]
+	}
+	f.buf = append(f.buf, data...)
+}
+
+// next returns the next complete message of size bytes, or ok false until
+// it has arrived. Messages over maxMessage are skipped, returning only
+// their first bytes with skipped set.
+func (f *framer) next(header, size int) (msg []byte, skipped, ok bool) {
+	if size > maxMessage {
+		msg = append([]byte(nil), f.buf[:min(len(f.buf), header+64)]...)
+		if size <= len(f.buf) {
+			f.buf = f.buf[size:]
+		} else {
+			f.skip = size - len(f.buf)
+			f.buf = nil
+		}
+		return msg, true, true
+	}
+	if len(f.buf) < size {
+		return nil, false, false
+	}
+	msg = f.buf[:size]
+	f.buf = f.buf[size:]
+	return msg, false, true
+}
+
+// truncate shortens s to n characters
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+// cstring reads a NUL-terminated string, returning it and the rest
+func cstring(b []byte) (string, []byte) {
+	s, rest, found := bytes.Cut(b, []byte{0})
+	if !found {
+		return string(b), nil
+	}
+	return string(s), rest
+}
+
+// oneLine collapses whitespace so queries fit on one line
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,195 @@
+package decode
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MySQL capability flags the login decoder needs
+const (
+	mysqlConnectWithDB    = 0x00000008
+	mysqlSSL              = 0x00000800
+	mysqlSecureConnection = 0x00008000
+	mysqlLenencAuthData   = 0x00200000
+)
+
+// MySQL commands a client sends
+const (
+	mysqlQuit        = 0x01
+	mysqlInitDB      = 0x02
+	mysqlQuery       = 0x03
+	mysqlStmtPrepare = 0x16
+)
+
+// mysqlDecoder follows the MySQL client/server protocol: the server
+// handshake, the client login, commands and the first reply to each
+type mysqlDecoder struct {
+	client, server framer
+	handshake      bool        // the server greeted the client
+	login          bool        // the client sent its login
+	authenticated  bool        // the server accepted the login
+	awaitReply     bool        // report the server's next OK or error
+	tls            *tlsDecoder // after the client asked for SSL
+}
+
+func (d *mysqlDecoder) feed(client bool, data []byte) []Event {
+	if d.tls != nil {
+		return d.tls.feed(client, data)
+	}
+	f := &d.server
+	if client {
+		f = &d.client
+	}
+	f.add(data)
+
+	var events []Event
+	for d.tls == nil && len(f.buf) >= 4 {
+		size := 4 + int(uint32(f.buf[0])|uint32(f.buf[1])<<8|uint32(f.buf[2])<<16)
+		msg, skipped, ok := f.next(4, size)
+		if !ok {
+			break
+		}
+		if client {
+			events = append(events, d.clientPacket(msg[3], msg[4:], skipped)...)
+		} else if !skipped {
+			events = append(events, d.serverPacket(msg[4:])...)
+		}
+	}
+	// The TLS hello can follow the SSL request in the same read
+	if d.tls != nil && len(f.buf) > 0 {
+		events = append(events, d.tls.feed(client, f.buf)...)
+		f.buf = nil
+	}
+	return events
+}
+
+// clientPacket decodes the login or a command
+func (d *mysqlDecoder) clientPacket(seq byte, payload []byte, skipped bool) []Event {
+	if d.handshake && !d.login {
+		if len(payload) < 32 {
+			return nil
+		}
+		caps := binary.LittleEndian.Uint32(payload)
+		if len(payload) == 32 && caps&mysqlSSL != 0 {
+			d.tls = &tlsDecoder{}
+			return []Event{{Kind: "ssl_request", Text: "client requested SSL"}}
+		}
+		d.login, d.awaitReply = true, true
+		return []Event{{Kind: "login", Text: mysqlLogin(caps, payload[32:])}}
+	}
+	if seq != 0 || len(payload) == 0 {
+		return nil
+	}
+
+	text := string(payload[1:])
+	if skipped {
+		text = "(too large to show)"
+	}
+	d.awaitReply = true
+	switch payload[0] {
+	case mysqlQuery:
+		return []Event{{Kind: "query", Text: oneLine(text)}}
+	case mysqlStmtPrepare:
+		return []Event{{Kind: "prepare", Text: oneLine(text)}}
+	case mysqlInitDB:
+		return []Event{{Kind: "use", Text: text}}
+	case mysqlQuit:
+		d.awaitReply = false
+		return []Event{{Kind: "quit", Text: "client closed the session"}}
+	}
+	return nil
+}
+
+// mysqlLogin summarises a HandshakeResponse41 after its fixed 32 bytes
+func mysqlLogin(caps uint32, rest []byte) string {
+	user, rest := cstring(rest)
+	text := "user=" + user
+
+	// Skip the auth response to reach the database
+	switch {
+	case caps&mysqlLenencAuthData != 0:
+		n, size := lenenc(rest)
+		if uint64(len(rest)) < uint64(size)+n {
+			return text
+		}
+		rest = rest[uint64(size)+n:]
+	case caps&mysqlSecureConnection != 0 && len(rest) > 0:
+		rest = rest[min(len(rest), 1+int(rest[0])):]
+	default:
+		_, rest = cstring(rest)
+	}
+	if caps&mysqlConnectWithDB != 0 && len(rest) > 0 {
+		db, _ := cstring(rest)
+		text += " database=" + db
+	}
+	return text
+}
+
+// serverPacket decodes the greeting and the replies the client waits for
+func (d *mysqlDecoder) serverPacket(payload []byte) []Event {
+	if len(payload) == 0 {
+		return nil
+	}
+	if !d.handshake {
+		d.handshake = true
+		switch payload[0] {
+		case 10:
+			version, _ := cstring(payload[1:])
+			return []Event{{Kind: "server", Text: "MySQL " + version}}
+		case 0xff:
+			return []Event{{Kind: "error", Text: mysqlError(payload)}}
+		}
+		return nil
+	}
+	if !d.awaitReply {
+		return nil
+	}
+
+	switch payload[0] {
+	case 0x00:
+		d.awaitReply = false
+		if !d.authenticated {
+			d.authenticated = true
+			return []Event{{Kind: "auth", Text: "authentication ok"}}
+		}
+	case 0xff:
+		d.awaitReply = false
+		return []Event{{Kind: "error", Text: mysqlError(payload)}}
+	default:
+		// Auth switches and more auth data precede the login's OK;
+		// result sets follow a query
+		d.awaitReply = !d.authenticated
+	}
+	return nil
+}
+
+// mysqlError renders an ERR packet as "ERROR 1045 (28000): message"
+func mysqlError(payload []byte) string {
+	if len(payload) < 3 {
+		return "ERROR"
+	}
+	code := binary.LittleEndian.Uint16(payload[1:3])
+	msg := payload[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		return fmt.Sprintf("ERROR %d (%s): %s", code, msg[1:6], msg[6:])
+	}
+	return fmt.Sprintf("ERROR %d: %s", code, msg)
+}
+
+// lenenc reads a length-encoded integer, returning it and its size
+func lenenc(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	switch {
+	case b[0] < 0xfb:
+		return uint64(b[0]), 1
+	case b[0] == 0xfc && len(b) >= 3:
+		return uint64(binary.LittleEndian.Uint16(b[1:3])), 3
+	case b[0] == 0xfd && len(b) >= 4:
+		return uint64(b[1]) | uint64(b[2])<<8 | uint64(b[3])<<16, 4
+	case b[0] == 0xfe && len(b) >= 9:
+		return binary.LittleEndian.Uint64(b[1:9]), 9
+	}
+	return 0, len(b)
+}
@@ -0,0 +1,228 @@
+package decode
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Codes in the untyped messages a Postgres client starts with
+const (
+	pgProtocol3     = 196608 // 3.0
+	pgSSLRequest    = 80877103
+	pgGSSENCRequest = 80877104
+	pgCancelRequest = 80877102
+)
+
+// postgresDecoder follows the Postgres wire protocol: the startup and
+// authentication exchange, simple and extended queries, and errors
+type postgresDecoder struct {
+	client, server framer
+	started        bool        // the client sent its startup message
+	encReply       bool        // the server answers SSL/GSS requests with one byte
+	tls            *tlsDecoder // after the server accepted SSL
+	dead           bool        // the stream stopped making sense
+}
+
+func (d *postgresDecoder) feed(client bool, data []byte) []Event {
+	if d.dead {
+		return nil
+	}
+	if d.tls != nil {
+		return d.tls.feed(client, data)
+	}
+	if client {
+		d.client.add(data)
+		return d.clientMessages()
+	}
+	if d.encReply && len(data) > 0 {
+		d.encReply = false
+		switch data[0] {
+		case 'S':
+			d.tls = &tlsDecoder{}
+			return append([]Event{{Kind: "ssl", Text: "server accepted encryption"}}, d.tls.feed(false, data[1:])...)
+		case 'N':
+			events := []Event{{Kind: "ssl", Text: "server declined encryption"}}
+			return append(events, d.feed(false, data[1:])...)
+		}
+	}
+	d.server.add(data)
+	return d.serverMessages()
+}
+
+// clientMessages decodes the buffered client messages
+func (d *postgresDecoder) clientMessages() []Event {
+	var events []Event
+	for {
+		if !d.started {
+			// Untyped: length, then a request code
+			if len(d.client.buf) < 8 {
+				return events
+			}
+			size := int(binary.BigEndian.Uint32(d.client.buf))
+			if size < 8 {
+				d.dead = true
+				return events
+			}
+			msg, _, ok := d.client.next(8, size)
+			if !ok {
+				return events
+			}
+			events = append(events, d.startup(msg)...)
+			continue
+		}
+
+		if len(d.client.buf) < 5 {
+			return events
+		}
+		size := 1 + int(binary.BigEndian.Uint32(d.client.buf[1:5]))
+		if size < 5 {
+			d.dead = true
+			return events
+		}
+		msg, skipped, ok := d.client.next(5, size)
+		if !ok {
+			return events
+		}
+		body := msg[5:]
+		switch msg[0] {
+		case 'Q':
+			query, _ := cstring(body)
+			if skipped {
+				query = "(too large to show)"
+			}
+			events = append(events, Event{Kind: "query", Text: oneLine(query)})
+		case 'P':
+			_, rest := cstring(body)
+			query, _ := cstring(rest)
+			if skipped {
+				query = "(too large to show)"
+			}
+			events = append(events, Event{Kind: "parse", Text: oneLine(query)})
+		case 'p':
+			events = append(events, Event{Kind: "auth", Text: "password or SASL response"})
+		case 'X':
+			events = append(events, Event{Kind: "terminate", Text: "client closed the session"})
+		}
+	}
+}
+
+// startup decodes the client's first, untyped message
+func (d *postgresDecoder) startup(msg []byte) []Event {
+	if len(msg) < 8 {
+		return nil
+	}
+	switch binary.BigEndian.Uint32(msg[4:8]) {
+	case pgSSLRequest:
+		d.encReply = true
+		return []Event{{Kind: "ssl_request", Text: "client requested SSL"}}
+	case pgGSSENCRequest:
+		d.encReply = true
+		return []Event{{Kind: "ssl_request", Text: "client requested GSSAPI encryption"}}
+	case pgCancelRequest:
+		return []Event{{Kind: "cancel", Text: "cancel request for a running query"}}
+	case pgProtocol3:
+		d.started = true
+		var params []string
+		rest := msg[8:]
+		for len(rest) > 0 {
+			var key, value string
+			key, rest = cstring(rest)
+			if key == "" {
+				break
+			}
+			value, rest = cstring(rest)
+			params = append(params, key+"="+value)
+		}
+		return []Event{{Kind: "startup", Text: strings.Join(params, " ")}}
+	}
+	return nil
+}
+
+// serverMessages decodes the buffered server messages
+func (d *postgresDecoder) serverMessages() []Event {
+	var events []Event
+	for {
+		if len(d.server.buf) < 5 {
+			return events
+		}
+		size := 1 + int(binary.BigEndian.Uint32(d.server.buf[1:5]))
+		if size < 5 {
+			d.dead = true
+			return events
+		}
+		msg, skipped, ok := d.server.next(5, size)
+		if !ok {
+			return events
+		}
+		if skipped {
+			continue
+		}
+		body := msg[5:]
+		switch msg[0] {
+		case 'R':
+			if text := pgAuthRequest(body); text != "" {
+				events = append(events, Event{Kind: "auth", Text: text})
+			}
+		case 'E':
+			events = append(events, Event{Kind: "error", Text: pgError(body)})
+		case 'C':
+			tag, _ := cstring(body)
+			events = append(events, Event{Kind: "complete", Text: tag})
+		case 'S':
+			key, rest := cstring(body)
+			if key == "server_version" {
+				version, _ := cstring(rest)
+				events = append(events, Event{Kind: "server", Text: "PostgreSQL " + version})
+			}
+		}
+	}
+}
+
+// pgAuthRequest describes an authentication request from the server
+func pgAuthRequest(body []byte) string {
+	if len(body) < 4 {
+		return ""
+	}
+	switch binary.BigEndian.Uint32(body) {
+	case 0:
+		return "authentication ok"
+	case 3:
+		return "cleartext password requested"
+	case 5:
+		return "md5 password requested"
+	case 7, 8:
+		return "GSSAPI authentication requested"
+	case 9:
+		return "SSPI authentication requested"
+	case 10:
+		var mechanisms []string
+		rest := body[4:]
+		for len(rest) > 0 {
+			var m string
+			m, rest = cstring(rest)
+			if m == "" {
+				break
+			}
+			mechanisms = append(mechanisms, m)
+		}
+		return "SASL requested (" + strings.Join(mechanisms, ", ") + ")"
+	}
+	return ""
+}
+
+// pgError renders an ErrorResponse as "FATAL 28P01: message"
+func pgError(body []byte) string {
+	fields := map[byte]string{}
+	for len(body) > 1 && body[0] != 0 {
+		code := body[0]
+		var value string
+		value, body = cstring(body[1:])
+		fields[code] = value
+	}
+	severity := fields['V']
+	if severity == "" {
+		severity = fields['S']
+	}
+	return fmt.Sprintf("%s %s: %s", severity, fields['C'], fields['M'])
+}
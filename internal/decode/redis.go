@@ -0,0 +1,180 @@
+package decode
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// redisInlineCommands are commands recognised when sent inline, without RESP
+var redisInlineCommands = map[string]bool{
+	"PING": true, "AUTH": true, "HELLO": true, "INFO": true, "GET": true, "SET": true,
+	"KEYS": true, "SELECT": true, "MONITOR": true, "QUIT": true, "DEL": true, "CONFIG": true,
+}
+
+// errIncomplete means a RESP value has not fully arrived
+var errIncomplete = errors.New("incomplete")
+
+// redisDecoder reports the commands a client sends and the errors the
+// server answers with
+type redisDecoder struct {
+	buf  [2][]byte
+	dead [2]bool // stopped decoding a side that made no sense
+}
+
+func (d *redisDecoder) feed(client bool, data []byte) []Event {
+	side := 1
+	if client {
+		side = 0
+	}
+	if d.dead[side] {
+		return nil
+	}
+	d.buf[side] = append(d.buf[side], data...)
+
+	var events []Event
+	for len(d.buf[side]) > 0 {
+		b := d.buf[side]
+		var args []string
+		var n int
+		var err error
+		if client && b[0] != '*' {
+			args, n, err = redisInline(b)
+		} else {
+			var v respValue
+			v, n, err = readRESP(b, 0)
+			args = v.strings()
+			if !client {
+				if v.kind == '-' || v.kind == '!' {
+					events = append(events, Event{Kind: "error", Text: v.str})
+				}
+				args = nil
+			}
+		}
+		if errors.Is(err, errIncomplete) && len(b) <= maxMessage {
+			break
+		}
+		if err != nil {
+			d.dead[side], d.buf[side] = true, nil
+			break
+		}
+		d.buf[side] = b[n:]
+		if len(args) > 0 {
+			events = append(events, Event{Kind: "command", Text: redisCommand(args)})
+		}
+	}
+	return events
+}
+
+// redisInline reads an inline command line such as "PING\r\n"
+func redisInline(b []byte) ([]string, int, error) {
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return nil, 0, errIncomplete
+	}
+	return strings.Fields(string(b[:i])), i + 1, nil
+}
+
+// redisCommand renders a command, hiding credentials and long arguments
+func redisCommand(args []string) string {
+	name := strings.ToUpper(args[0])
+	parts := []string{name}
+	for i, arg := range args[1:] {
+		switch {
+		case name == "AUTH", name == "HELLO" && i > 0 && strings.EqualFold(args[i], "AUTH"),
+			name == "HELLO" && i > 1 && strings.EqualFold(args[i-1], "AUTH"):
+			arg = "***"
+		case len(arg) > 64:
+			arg = arg[:64] + "…"
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\r\n\"") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// respValue is one decoded RESP2 or RESP3 value
+type respValue struct {
+	kind  byte
+	str   string
+	items []respValue
+}
+
+// strings returns an array of bulk strings as plain strings
+func (v respValue) strings() []string {
+	var args []string
+	for _, item := range v.items {
+		args = append(args, item.str)
+	}
+	return args
+}
+
+// readRESP reads one value from b, returning it and the bytes it used
+func readRESP(b []byte, depth int) (respValue, int, error) {
+	if depth > 32 {
+		return respValue{}, 0, errors.New("RESP nested too deep")
+	}
+	i := bytes.Index(b, []byte("\r\n"))
+	if i < 0 {
+		return respValue{}, 0, errIncomplete
+	}
+	if i == 0 {
+		return respValue{}, 0, errors.New("empty RESP line")
+	}
+	v := respValue{kind: b[0], str: string(b[1:i])}
+	n := i + 2
+
+	switch v.kind {
+	case '+', '-', ':', ',', '(', '#', '_':
+		return v, n, nil
+	case '$', '!', '=':
+		size, err := strconv.Atoi(v.str)
+		if err != nil {
+			return v, 0, err
+		}
+		if size < 0 {
+			v.str = ""
+			return v, n, nil
+		}
+		if size > maxMessage {
+			return v, 0, errors.New("RESP string too long")
+		}
+		if len(b) < n+size+2 {
+			return v, 0, errIncomplete
+		}
+		v.str = string(b[n : n+size])
+		return v, n + size + 2, nil
+	case '*', '~', '>', '%', '|':
+		count, err := strconv.Atoi(v.str)
+		if err != nil {
+			return v, 0, err
+		}
+		if count > maxMessage {
+			return v, 0, errors.New("RESP aggregate too long")
+		}
+		if v.kind == '%' || v.kind == '|' {
+			count *= 2
+		}
+		for j := 0; j < count; j++ {
+			item, used, err := readRESP(b[n:], depth+1)
+			if err != nil {
+				return v, 0, err
+			}
+			v.items = append(v.items, item)
+			n += used
+		}
+		if v.kind == '|' {
+			// Attributes precede the value they describe
+			next, used, err := readRESP(b[n:], depth+1)
+			if err != nil {
+				return v, 0, err
+			}
+			return next, n + used, nil
+		}
+		return v, n, nil
+	}
+	return v, 0, errors.New("invalid RESP type")
+}
@@ -0,0 +1,161 @@
+package decode
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// TLS extensions the hello decoder reads
+const (
+	tlsExtServerName        = 0
+	tlsExtALPN              = 16
+	tlsExtSupportedVersions = 43
+)
+
+// tlsDecoder reports the ClientHello's SNI and ALPN and what the server
+// picked; everything after the hellos is encrypted
+type tlsDecoder struct {
+	buf  [2][]byte
+	done [2]bool
+}
+
+func (d *tlsDecoder) feed(client bool, data []byte) []Event {
+	side := 1
+	if client {
+		side = 0
+	}
+	if d.done[side] {
+		return nil
+	}
+	d.buf[side] = append(d.buf[side], data...)
+	b := d.buf[side]
+	if len(b) < 5 {
+		return nil
+	}
+	if b[0] != 0x16 { // not a handshake record
+		d.done[side], d.buf[side] = true, nil
+		return nil
+	}
+	size := 5 + int(binary.BigEndian.Uint16(b[3:5]))
+	if len(b) < size {
+		return nil
+	}
+	d.done[side], d.buf[side] = true, nil
+
+	hello := b[5:size]
+	if len(hello) < 4 {
+		return nil
+	}
+	switch {
+	case client && hello[0] == 1:
+		return []Event{{Kind: "client_hello", Text: clientHello(hello[4:])}}
+	case !client && hello[0] == 2:
+		return []Event{{Kind: "server_hello", Text: serverHello(hello[4:])}}
+	}
+	return nil
+}
+
+// clientHello summarises a ClientHello body as "sni=host alpn=h2,http/1.1"
+func clientHello(b []byte) string {
+	// version, random, session id, cipher suites, compression methods
+	r := reader(b)
+	r.skip(2 + 32)
+	r.skip(int(r.uint8()))
+	r.skip(int(r.uint16()))
+	r.skip(int(r.uint8()))
+
+	var sni string
+	var alpn []string
+	exts := reader(r.bytes(int(r.uint16())))
+	for len(exts) >= 4 {
+		typ := exts.uint16()
+		ext := reader(exts.bytes(int(exts.uint16())))
+		switch typ {
+		case tlsExtServerName:
+			names := reader(ext.bytes(int(ext.uint16())))
+			for len(names) >= 3 {
+				kind := names.uint8()
+				name := names.bytes(int(names.uint16()))
+				if kind == 0 {
+					sni = string(name)
+				}
+			}
+		case tlsExtALPN:
+			protos := reader(ext.bytes(int(ext.uint16())))
+			for len(protos) > 0 {
+				alpn = append(alpn, string(protos.bytes(int(protos.uint8()))))
+			}
+		}
+	}
+
+	parts := []string{"sni=" + sni}
+	if sni == "" {
+		parts[0] = "no sni"
+	}
+	if len(alpn) > 0 {
+		parts = append(parts, "alpn="+strings.Join(alpn, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// serverHello summarises a ServerHello body as "TLS 1.3 TLS_AES_128_GCM_SHA256 alpn=h2"
+func serverHello(b []byte) string {
+	r := reader(b)
+	version := r.uint16()
+	r.skip(32)
+	r.skip(int(r.uint8()))
+	cipher := r.uint16()
+	r.skip(1)
+
+	var alpn string
+	exts := reader(r.bytes(int(r.uint16())))
+	for len(exts) >= 4 {
+		typ := exts.uint16()
+		ext := reader(exts.bytes(int(exts.uint16())))
+		switch typ {
+		case tlsExtSupportedVersions:
+			version = ext.uint16()
+		case tlsExtALPN:
+			protos := reader(ext.bytes(int(ext.uint16())))
+			alpn = string(protos.bytes(int(protos.uint8())))
+		}
+	}
+
+	text := fmt.Sprintf("%s %s", tls.VersionName(version), tls.CipherSuiteName(cipher))
+	if alpn != "" {
+		text += " alpn=" + alpn
+	}
+	return text
+}
+
+// reader reads big-endian fields, yielding zeros once it runs out
+type reader []byte
+
+func (r *reader) bytes(n int) []byte {
+	n = min(n, len(*r))
+	b := (*r)[:n]
+	*r = (*r)[n:]
+	return b
+}
+
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *reader) uint8() uint8 {
+	b := r.bytes(1)
+	if len(b) < 1 {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.bytes(2)
+	if len(b) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
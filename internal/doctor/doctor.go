@@ -0,0 +1,383 @@
+// Package doctor diagnoses the local environment for common tunnel problems.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/embed"
+)
+
+// Check outcomes
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Clock skew thresholds
+const (
+	SkewWarn = 30 * time.Second
+	SkewFail = 5 * time.Minute
+)
+
+// Check is the result of one diagnostic
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"` // how to fix a warning or failure
+}
+
+// Report is the result of a doctor run
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Count returns how many checks ended with status
+func (r Report) Count(status string) int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Resolver looks up host addresses
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Dialer opens network connections
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// TimeSource returns the current time according to a remote server
+type TimeSource interface {
+	RemoteTime(ctx context.Context) (time.Time, error)
+}
+
+// Options select what to check
+type Options struct {
+	Server        *config.Server // nil if it could not be resolved
+	ServerErr     error          // why the server could not be resolved
+	APIKeyFlag    string
+	EgressProxy   string // --egress-proxy
+	LocalPort     int    // 0 skips the local port check
+	DashboardPort int
+}
+
+// Doctor runs the checks. Every dependency outside the process is a field,
+// so tests can run it offline.
+type Doctor struct {
+	Resolver    Resolver
+	Dialer      Dialer
+	Time        TimeSource
+	Listen      func(network, address string) (net.Listener, error)
+	FrpcVersion func() (string, error)
+	ResolveKey  func(flagValue string) (*config.Credential, error)
+	Getenv      func(key string) string
+	TempDir     string
+	Now         func() time.Time
+	Timeout     time.Duration // per network check
+}
+
+// New returns a doctor using the real network, frpc and environment
+func New() *Doctor {
+	return &Doctor{
+		Resolver:    net.DefaultResolver,
+		Dialer:      &net.Dialer{},
+		Time:        HTTPDate{URL: config.DefaultPlatformURL, Client: &http.Client{Timeout: 5 * time.Second}},
+		Listen:      net.Listen,
+		FrpcVersion: embed.CheckFrpcVersion,
+		ResolveKey:  config.ResolveAPIKey,
+		Getenv:      os.Getenv,
+		TempDir:     os.TempDir(),
+		Now:         time.Now,
+		Timeout:     5 * time.Second,
+	}
+}
+
+// Run performs every check in order
+func (d *Doctor) Run(ctx context.Context, opts Options) Report {
+	var report Report
+	add := func(c Check) { report.Checks = append(report.Checks, c) }
+
+	add(d.checkFrpc())
+	add(d.checkTempDir())
+	add(d.checkAPIKey(opts))
+	add(d.checkServerDNS(ctx, opts))
+	add(d.checkServerTCP(ctx, opts))
+	add(d.checkEgressProxy(opts))
+	add(d.checkLocalPort(ctx, opts))
+	add(d.checkDashboardPort(opts))
+	add(d.checkClock(ctx))
+	return report
+}
+
+func (d *Doctor) checkFrpc() Check {
+	c := Check{Name: "frpc"}
+	version, err := d.FrpcVersion()
+	if err != nil {
+		c.Status = StatusFail
+		c.Detail = err.Error()
+		c.Hint = fmt.Sprintf("lrok extracts frpc to %s and runs it from there; make sure that directory is writable and not mounted noexec (or set TMPDIR elsewhere)", filepath.Join(d.TempDir, "lrok-frpc"))
+		return c
+	}
+	c.Status = StatusOK
+	c.Detail = "embedded frpc " + strings.TrimSpace(version)
+	return c
+}
+
+func (d *Doctor) checkTempDir() Check {
+	c := Check{Name: "temp dir"}
+	f, err := os.CreateTemp(d.TempDir, "lrok-doctor-*")
+	if err != nil {
+		c.Status = StatusFail
+		c.Detail = err.Error()
+		c.Hint = "lrok writes frpc and its config to the temp dir; fix its permissions or point TMPDIR at a writable directory"
+		return c
+	}
+	f.Close()
+	os.Remove(f.Name())
+	c.Status = StatusOK
+	c.Detail = d.TempDir + " is writable"
+	return c
+}
+
+func (d *Doctor) checkAPIKey(opts Options) Check {
+	c := Check{Name: "API key"}
+	if opts.Server != nil && opts.Server.SelfHosted {
+		c.Status = StatusSkip
+		c.Detail = "self-hosted server uses " + opts.Server.Auth.Method + " auth"
+		return c
+	}
+	cred, err := d.ResolveKey(opts.APIKeyFlag)
+	if err != nil {
+		c.Status = StatusFail
+		c.Detail = err.Error()
+		c.Hint = "run 'lrok login' or set LUM_API_KEY (get a key at https://platform.lum.tools/keys)"
+		return c
+	}
+	if err := config.ValidateAPIKeyFormat(cred.APIKey); err != nil {
+		c.Status = StatusWarn
+		c.Detail = fmt.Sprintf("%v, from %s", err, cred.Source)
+		c.Hint = "platform API keys start with '" + config.APIKeyPrefix + "'; check you copied the right key"
+		return c
+	}
+	c.Status = StatusOK
+	c.Detail = "found in " + cred.Source
+	return c
+}
+
+func (d *Doctor) checkServerDNS(ctx context.Context, opts Options) Check {
+	c := Check{Name: "server DNS"}
+	if opts.Server == nil {
+		c.Status = StatusFail
+		c.Detail = fmt.Sprintf("no server: %v", opts.ServerErr)
+		c.Hint = "check --server, --region, LROK_SERVER and the active profile"
+		return c
+	}
+	host := opts.Server.Addr
+	if net.ParseIP(host) != nil {
+		c.Status = StatusSkip
+		c.Detail = host + " is an IP address"
+		return c
+	}
+	if opts.Server.EgressProxy != "" {
+		c.Status = StatusSkip
+		c.Detail = host + " is resolved by the egress proxy"
+		return c
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	addrs, err := d.Resolver.LookupHost(ctx, host)
+	if err != nil {
+		c.Status = StatusFail
+		c.Detail = err.Error()
+		c.Hint = "check your DNS settings, VPN or /etc/resolv.conf; try --server with an IP address"
+		return c
+	}
+	c.Status = StatusOK
+	c.Detail = fmt.Sprintf("%s → %s", host, strings.Join(addrs, ", "))
+	return c
+}
+
+func (d *Doctor) checkServerTCP(ctx context.Context, opts Options) Check {
+	c := Check{Name: "server reachable"}
+	if opts.Server == nil {
+		c.Status = StatusSkip
+		c.Detail = "no server"
+		return c
+	}
+
+	if opts.Server.Transport.UDP() {
+		c.Status = StatusSkip
+		c.Detail = opts.Server.Transport.Protocol + " runs over UDP, which can't be probed without a server handshake"
+		return c
+	}
+
+	// Through a proxy, frpc only ever connects to the proxy itself
+	addr, label := opts.Server.Address(), ""
+	hint := fmt.Sprintf("a firewall may block outbound TCP port %d; try another network, --region, or --egress-proxy", opts.Server.Port)
+	if opts.Server.EgressProxy != "" {
+		u, err := url.Parse(opts.Server.EgressProxy)
+		if err != nil {
+			c.Status = StatusFail
+			c.Detail = err.Error()
+			return c
+		}
+		addr, label = u.Host, "egress proxy "
+		hint = "the egress proxy is unreachable; check its address, or try --egress-proxy none"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	start := d.Now()
+	conn, err := d.Dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		c.Status = StatusFail
+		c.Detail = err.Error()
+		c.Hint = hint
+		return c
+	}
+	conn.Close()
+	c.Status = StatusOK
+	c.Detail = fmt.Sprintf("%s%s in %s", label, addr, d.Now().Sub(start).Round(time.Millisecond))
+	return c
+}
+
+func (d *Doctor) checkEgressProxy(opts Options) Check {
+	c := Check{Name: "egress proxy"}
+	host := ""
+	if opts.Server != nil {
+		host = opts.Server.Addr
+	}
+	u, source, err := config.ResolveEgressProxy(opts.EgressProxy, host, d.Getenv)
+	switch {
+	case err != nil:
+		c.Status = StatusFail
+		c.Detail = err.Error()
+		c.Hint = "use http://host:port, socks5://host:port or ntlm://host:port, with user:password@ if the proxy needs them"
+	case u != nil:
+		c.Status = StatusOK
+		c.Detail = fmt.Sprintf("via %s (from %s)", config.RedactURL(u.String()), source)
+	case source == "NO_PROXY":
+		c.Status = StatusOK
+		c.Detail = "NO_PROXY exempts the server, connecting directly"
+	case source != "":
+		c.Status = StatusOK
+		c.Detail = "disabled with --egress-proxy none, connecting directly"
+	case d.Getenv("HTTP_PROXY") != "" || d.Getenv("http_proxy") != "":
+		c.Status = StatusWarn
+		c.Detail = "only HTTP_PROXY is set, connecting directly"
+		c.Hint = "the tunnel connection is not plain HTTP; set HTTPS_PROXY, ALL_PROXY or --egress-proxy if direct connections are blocked"
+	default:
+		c.Status = StatusOK
+		c.Detail = "none configured, connecting directly"
+	}
+	return c
+}
+
+func (d *Doctor) checkLocalPort(ctx context.Context, opts Options) Check {
+	c := Check{Name: "local port"}
+	if opts.LocalPort == 0 {
+		c.Status = StatusSkip
+		c.Detail = "no port given (lrok doctor <port>)"
+		return c
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(opts.LocalPort))
+	conn, err := d.Dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		c.Status = StatusWarn
+		c.Detail = fmt.Sprintf("nothing listening on %s", addr)
+		c.Hint = "start your app, and make sure it listens on 127.0.0.1 or 0.0.0.0 rather than only ::1 (or use --ip)"
+		return c
+	}
+	conn.Close()
+	c.Status = StatusOK
+	c.Detail = addr + " is accepting connections"
+	return c
+}
+
+func (d *Doctor) checkDashboardPort(opts Options) Check {
+	c := Check{Name: "dashboard port"}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(opts.DashboardPort))
+	l, err := d.Listen("tcp", addr)
+	if err != nil {
+		c.Status = StatusWarn
+		c.Detail = fmt.Sprintf("%s is in use", addr)
+		c.Hint = "another lrok (see 'lrok list') or another program holds it; tunnels still work but this one won't get a dashboard"
+		return c
+	}
+	l.Close()
+	c.Status = StatusOK
+	c.Detail = addr + " is free"
+	return c
+}
+
+func (d *Doctor) checkClock(ctx context.Context) Check {
+	c := Check{Name: "clock"}
+	ctx, cancel := context.WithTimeout(ctx, d.Timeout)
+	defer cancel()
+	remote, err := d.Time.RemoteTime(ctx)
+	if err != nil {
+		c.Status = StatusSkip
+		c.Detail = "could not get a reference time: " + err.Error()
+		return c
+	}
+
+	skew := d.Now().Sub(remote).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	c.Detail = fmt.Sprintf("off by %s", skew)
+	switch {
+	case skew >= SkewFail:
+		c.Status = StatusFail
+	case skew >= SkewWarn:
+		c.Status = StatusWarn
+	default:
+		c.Status = StatusOK
+		return c
+	}
+	c.Hint = "sync your clock (e.g. enable NTP); TLS, token auth and webhook timestamp checks fail with a skewed clock"
+	return c
+}
+
+// HTTPDate reads the reference time from the Date header of a HEAD request
+type HTTPDate struct {
+	URL    string
+	Client *http.Client
+}
+
+// RemoteTime returns the server's Date header
+func (h HTTPDate) RemoteTime(ctx context.Context) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", h.URL, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+	return http.ParseTime(resp.Header.Get("Date"))
+}
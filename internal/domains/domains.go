@@ -0,0 +1,110 @@
+// Package domains verifies DNS for custom domains on HTTP tunnels
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ChallengePrefix is prepended to a domain to form its TXT record name
+const ChallengePrefix = "_lrok-challenge."
+
+// Resolver is the subset of DNS lookups verification needs. *net.Resolver
+// satisfies it; tests use a fake.
+type Resolver interface {
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DefaultResolver uses the system DNS configuration
+var DefaultResolver Resolver = net.DefaultResolver
+
+// NewToken creates a random ownership token for a domain
+func NewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// TXTName returns the TXT record that proves ownership of a domain
+func TXTName(domain string) string {
+	return ChallengePrefix + domain
+}
+
+// TXTValue returns the expected content of the ownership TXT record
+func TXTValue(token string) string {
+	return "lrok-verify=" + token
+}
+
+// Check is the outcome of verifying one domain
+type Check struct {
+	Domain   string   `json:"domain"`
+	Target   string   `json:"target"`
+	CNAME    string   `json:"cname,omitempty"`
+	Routed   bool     `json:"routed"` // CNAME (or A records) point at the target
+	Owned    bool     `json:"owned"`  // TXT record carries the token
+	Verified bool     `json:"verified"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Verify checks that domain routes to target and carries the ownership token.
+// Apex domains that cannot use a CNAME pass if they resolve to the target's addresses.
+func Verify(ctx context.Context, r Resolver, domain, token, target string) Check {
+	check := Check{Domain: domain, Target: target}
+
+	cname, err := r.LookupCNAME(ctx, domain)
+	if err == nil {
+		check.CNAME = strings.TrimSuffix(cname, ".")
+	}
+	switch {
+	case strings.EqualFold(check.CNAME, target):
+		check.Routed = true
+	case sameAddresses(ctx, r, domain, target):
+		check.Routed = true
+	default:
+		check.Problems = append(check.Problems, fmt.Sprintf("%s should be a CNAME to %s", domain, target))
+	}
+
+	records, err := r.LookupTXT(ctx, TXTName(domain))
+	if err == nil {
+		for _, rec := range records {
+			if strings.TrimSpace(rec) == TXTValue(token) {
+				check.Owned = true
+				break
+			}
+		}
+	}
+	if !check.Owned {
+		check.Problems = append(check.Problems, fmt.Sprintf("TXT %s should be \"%s\"", TXTName(domain), TXTValue(token)))
+	}
+
+	check.Verified = check.Routed && check.Owned
+	return check
+}
+
+// sameAddresses reports whether both hosts resolve to an overlapping address set
+func sameAddresses(ctx context.Context, r Resolver, host, target string) bool {
+	got, err := r.LookupHost(ctx, host)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	want, err := r.LookupHost(ctx, target)
+	if err != nil {
+		return false
+	}
+	for _, a := range got {
+		for _, b := range want {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
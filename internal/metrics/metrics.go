@@ -0,0 +1,517 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets (in seconds) suited for HTTP requests
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	// ContentTypeText is the Prometheus text exposition format
+	ContentTypeText = "text/plain; version=0.0.4; charset=utf-8"
+	// ContentTypeOpenMetrics is the OpenMetrics text format
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// collector is a single metric family that can render itself
+type collector interface {
+	name() string
+	write(w io.Writer, openMetrics bool)
+}
+
+// Registry holds metric families and renders them in exposition format
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []collector
+	names      map[string]bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]bool),
+	}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[c.name()] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", c.name()))
+	}
+	r.names[c.name()] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Write renders all registered metrics. When openMetrics is true the output
+// follows the OpenMetrics format (counter families without _total, # EOF).
+func (r *Registry) Write(w io.Writer, openMetrics bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.collectors {
+		c.write(w, openMetrics)
+	}
+}
+
+// WriteAll renders several registries as one exposition
+func WriteAll(w io.Writer, openMetrics bool, registries ...*Registry) {
+	for _, r := range registries {
+		if r != nil {
+			r.Write(w, openMetrics)
+		}
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// desc is the metadata shared by every metric family
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d *desc) name() string {
+	return d.metricName
+}
+
+func (d *desc) header(w io.Writer, typ string, openMetrics bool) {
+	family := d.metricName
+	if openMetrics && typ == "counter" {
+		family = strings.TrimSuffix(family, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", family, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", family, typ)
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString renders {a="x",b="y"} for the given values plus optional extras
+func (d *desc) labelString(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, d.labels[i], escapeLabel(v)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a monotonically increasing value partitioned by labels
+type CounterVec struct {
+	desc
+	mu     sync.RWMutex
+	values map[string]*sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec registers a new counter family
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{metricName: name, help: help, labels: labels},
+		values: make(map[string]*sample),
+	}
+	r.register(c)
+	return c
+}
+
+// Add increments the counter for the given label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	k := c.key(values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[k]
+	if !ok {
+		s = &sample{labels: append([]string(nil), values...)}
+		c.values[k] = s
+	}
+	s.value += delta
+}
+
+// Inc increments the counter by one
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns the current value for the given label values
+func (c *CounterVec) Value(values ...string) float64 {
+	k := c.key(values)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if s, ok := c.values[k]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer, openMetrics bool) {
+	c.header(w, "counter", openMetrics)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, s := range sortedSamples(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelString(s.labels), formatFloat(s.value))
+	}
+}
+
+// GaugeVec is a value that can go up and down, partitioned by labels
+type GaugeVec struct {
+	desc
+	mu     sync.RWMutex
+	values map[string]*sample
+}
+
+// NewGaugeVec registers a new gauge family
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		desc:   desc{metricName: name, help: help, labels: labels},
+		values: make(map[string]*sample),
+	}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge for the given label values
+func (g *GaugeVec) Set(value float64, values ...string) {
+	k := g.key(values)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.values[k]
+	if !ok {
+		s = &sample{labels: append([]string(nil), values...)}
+		g.values[k] = s
+	}
+	s.value = value
+}
+
+// Add adds delta (which may be negative) to the gauge
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	k := g.key(values)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.values[k]
+	if !ok {
+		s = &sample{labels: append([]string(nil), values...)}
+		g.values[k] = s
+	}
+	s.value += delta
+}
+
+// Value returns the current value for the given label values
+func (g *GaugeVec) Value(values ...string) float64 {
+	k := g.key(values)
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if s, ok := g.values[k]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (g *GaugeVec) write(w io.Writer, openMetrics bool) {
+	g.header(w, "gauge", openMetrics)
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, s := range sortedSamples(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labelString(s.labels), formatFloat(s.value))
+	}
+}
+
+// GaugeFunc is a gauge whose value is computed at scrape time
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge that calls fn on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		desc: desc{metricName: name, help: help},
+		fn:   fn,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer, openMetrics bool) {
+	g.header(w, "gauge", openMetrics)
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
+
+// CounterFunc is a counter whose value is computed at scrape time
+type CounterFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewCounterFunc registers a counter that calls fn on every scrape
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) *CounterFunc {
+	c := &CounterFunc{
+		desc: desc{metricName: name, help: help},
+		fn:   fn,
+	}
+	r.register(c)
+	return c
+}
+
+func (c *CounterFunc) write(w io.Writer, openMetrics bool) {
+	c.header(w, "counter", openMetrics)
+	fmt.Fprintf(w, "%s %s\n", c.metricName, formatFloat(c.fn()))
+}
+
+// HistogramVec tracks value distributions partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.RWMutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a new histogram family. Nil buckets use DefaultBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &HistogramVec{
+		desc:    desc{metricName: name, help: help, labels: labels},
+		buckets: sorted,
+		values:  make(map[string]*histogram),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a single value for the given label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	k := h.key(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[k]
+	if !ok {
+		s = &histogram{
+			labels: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[k] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count returns the number of observations for the given label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	k := h.key(values)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if s, ok := h.values[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer, openMetrics bool) {
+	h.header(w, "histogram", openMetrics)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	keys := make([]string, 0, len(h.values))
+	for k := range h.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := h.values[k]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(s.labels, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelString(s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelString(s.labels), s.count)
+	}
+}
+
+func sortedSamples(values map[string]*sample) []*sample {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]*sample, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, values[k])
+	}
+	return result
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// OtherLabel replaces label values past a cardinality cap
+const OtherLabel = "other"
+
+// PathSet caps how many distinct path templates are used as label values,
+// so scanners probing random URLs can't grow the series forever
+type PathSet struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+// NewPathSet keeps up to max path templates
+func NewPathSet(max int) *PathSet {
+	return &PathSet{max: max, seen: make(map[string]struct{})}
+}
+
+// Label returns the template of path, or OtherLabel once the set is full
+func (s *PathSet) Label(path string) string {
+	template := PathTemplate(path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[template]; ok {
+		return template
+	}
+	if len(s.seen) >= s.max {
+		return OtherLabel
+	}
+	s.seen[template] = struct{}{}
+	return template
+}
+
+// knownMethods are the HTTP methods kept as label values
+var knownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+// MethodLabel returns a standard HTTP method as is and anything else as OTHER
+func MethodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return "OTHER"
+}
+
+// PathTemplate collapses variable path segments (numbers, UUIDs, long hex or
+// opaque tokens) into ":id" so paths can be used as low-cardinality labels
+func PathTemplate(path string) string {
+	if path == "" || path == "/" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if isVariableSegment(seg) {
+			segments[i] = ":id"
+		}
+	}
+
+	// Cap depth to keep label cardinality bounded
+	if len(segments) > 6 {
+		segments = append(segments[:6], "...")
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func isVariableSegment(seg string) bool {
+	if seg == "" {
+		return false
+	}
+
+	digits, hex, other := 0, 0, 0
+	for _, r := range seg {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F'):
+			hex++
+		case r == '-' || r == '_':
+		default:
+			other++
+		}
+	}
+
+	// Pure numbers: /users/42
+	if digits == len(seg) {
+		return true
+	}
+	// UUIDs and hashes: /orders/3f2a9c1e-...
+	if other == 0 && digits > 0 && len(seg) >= 16 {
+		return true
+	}
+	// Long opaque tokens with mixed digits: /files/aZ83kd92Lq0x
+	return len(seg) >= 20 && digits >= 4
+}
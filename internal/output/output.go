@@ -0,0 +1,136 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Supported output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Event names emitted in JSON mode
+const (
+	EventStarting = "starting"
+	EventReady    = "ready"
+	EventError    = "error"
+	EventShutdown = "shutdown"
+	EventInfo     = "info"
+	EventLimit    = "limit"
+)
+
+// Fields holds the payload of a structured event
+type Fields map[string]interface{}
+
+// Printer writes human-readable text and structured events.
+//
+// In text mode human output goes to stdout and events are dropped. In JSON
+// mode events are written to stdout as NDJSON and human output goes to
+// stderr, so stdout stays machine-readable.
+type Printer struct {
+	format string
+	stdout io.Writer
+	stderr io.Writer
+	tee    io.Writer
+	mu     sync.Mutex
+}
+
+// New creates a printer for the given format writing to os.Stdout/os.Stderr
+func New(format string) (*Printer, error) {
+	return NewWithWriters(format, os.Stdout, os.Stderr)
+}
+
+// NewWithWriters creates a printer with explicit writers
+func NewWithWriters(format string, stdout, stderr io.Writer) (*Printer, error) {
+	switch format {
+	case "", FormatText:
+		format = FormatText
+	case FormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid output format '%s', must be one of: text, json", format)
+	}
+
+	return &Printer{
+		format: format,
+		stdout: stdout,
+		stderr: stderr,
+	}, nil
+}
+
+// JSON reports whether structured output is enabled
+func (p *Printer) JSON() bool {
+	return p.format == FormatJSON
+}
+
+// Tee copies all human-readable text to w as well (e.g. a log buffer)
+func (p *Printer) Tee(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tee = w
+}
+
+// Human returns the writer for human-readable text
+func (p *Printer) Human() io.Writer {
+	base := p.stdout
+	if p.JSON() {
+		base = p.stderr
+	}
+	if p.tee != nil {
+		return io.MultiWriter(base, p.tee)
+	}
+	return base
+}
+
+// Println writes a line of human-readable text
+func (p *Printer) Println(a ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.Human(), a...)
+}
+
+// Printf writes formatted human-readable text
+func (p *Printer) Printf(format string, a ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.Human(), format, a...)
+}
+
+// Event writes a structured event as a single JSON line (JSON mode only)
+func (p *Printer) Event(name string, fields Fields) {
+	if !p.JSON() {
+		return
+	}
+
+	event := make(map[string]interface{}, len(fields)+2)
+	for k, v := range fields {
+		event[k] = v
+	}
+	event["event"] = name
+	event["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.stdout, "%s\n", data)
+}
+
+// Error reports an error as an event in JSON mode and as text on stderr otherwise
+func (p *Printer) Error(err error) {
+	if p.JSON() {
+		p.Event(EventError, Fields{"error": err.Error()})
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.stderr, err)
+}
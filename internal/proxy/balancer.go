@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancing strategies for routes with several upstreams
+const (
+	LBRoundRobin = "round-robin"
+	LBLeastConn  = "least-conn"
+)
+
+// ValidateLBStrategy checks a --lb value
+func ValidateLBStrategy(strategy string) error {
+	switch strategy {
+	case "", LBRoundRobin, LBLeastConn:
+		return nil
+	}
+	return fmt.Errorf("invalid load balancing strategy '%s', must be one of: %s, %s", strategy, LBRoundRobin, LBLeastConn)
+}
+
+// LBOptions configure load balancing and active health checks
+type LBOptions struct {
+	Strategy   string        // round-robin (default) or least-conn
+	HealthPath string        // HTTP GET path for health checks; empty checks TCP connect
+	Interval   time.Duration // between health checks
+	Timeout    time.Duration // per health check
+}
+
+// Upstream is one local service behind a route
+type Upstream struct {
+	URL *url.URL
+
+	active   atomic.Int64
+	requests atomic.Int64
+	failures atomic.Int64
+
+	mu        sync.RWMutex
+	healthy   bool
+	lastError string
+	lastCheck time.Time
+}
+
+// UpstreamStats is a snapshot of an upstream's health and traffic
+type UpstreamStats struct {
+	Route     string    `json:"route"`
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Active    int64     `json:"active"`
+	Requests  int64     `json:"requests"`
+	Failures  int64     `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+}
+
+func newUpstream(u *url.URL) *Upstream {
+	return &Upstream{URL: u, healthy: true}
+}
+
+// Healthy reports whether the upstream passed its last check
+func (u *Upstream) Healthy() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.healthy
+}
+
+// setHealth records the outcome of a health check or failed request
+func (u *Upstream) setHealth(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.healthy = err == nil
+	u.lastCheck = time.Now()
+	if err != nil {
+		u.lastError = err.Error()
+	}
+}
+
+func (u *Upstream) stats(route string) UpstreamStats {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return UpstreamStats{
+		Route:     route,
+		URL:       u.URL.String(),
+		Healthy:   u.healthy,
+		Active:    u.active.Load(),
+		Requests:  u.requests.Load(),
+		Failures:  u.failures.Load(),
+		LastError: u.lastError,
+		LastCheck: u.lastCheck,
+	}
+}
+
+// pool balances the requests of one route across its upstreams
+type pool struct {
+	route     string
+	upstreams []*Upstream
+	next      atomic.Uint64
+}
+
+func newPool(route Route) *pool {
+	p := &pool{route: route.Host + route.Prefix}
+	for _, target := range route.Targets {
+		p.upstreams = append(p.upstreams, newUpstream(target))
+	}
+	return p
+}
+
+// pick chooses the next upstream not yet tried, preferring healthy ones.
+// With every upstream down it still returns one so the client gets the error.
+func (p *pool) pick(strategy string, tried map[*Upstream]bool) *Upstream {
+	var candidates []*Upstream
+	for _, u := range p.upstreams {
+		if !tried[u] && u.Healthy() {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(tried) > 0 {
+			return nil
+		}
+		candidates = p.upstreams
+	}
+
+	if strategy == LBLeastConn {
+		best := candidates[0]
+		for _, u := range candidates[1:] {
+			if u.active.Load() < best.active.Load() {
+				best = u
+			}
+		}
+		return best
+	}
+	return candidates[p.next.Add(1)%uint64(len(candidates))]
+}
+
+// check probes an upstream once
+func (u *Upstream) check(ctx context.Context, opts LBOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	if opts.HealthPath == "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", u.URL.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	target := *u.URL
+	target.Path = joinPath(u.URL.Path, opts.HealthPath)
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return nil
+}
+
+// healthLoop checks every upstream of the balanced pools until ctx is done
+func (p *Proxy) healthLoop(ctx context.Context) {
+	ticker := time.NewTicker(p.lb.Interval)
+	defer ticker.Stop()
+	for {
+		for _, pl := range p.pools {
+			if len(pl.upstreams) < 2 {
+				continue
+			}
+			for _, u := range pl.upstreams {
+				u.setHealth(u.check(ctx, p.lb))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetLoadBalancing configures how routes with several upstreams are balanced.
+// Call before Start.
+func (p *Proxy) SetLoadBalancing(opts LBOptions) {
+	if opts.Strategy == "" {
+		opts.Strategy = LBRoundRobin
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	p.lb = opts
+}
+
+// UpstreamStats returns health and traffic of every upstream, in route order
+func (p *Proxy) UpstreamStats() []UpstreamStats {
+	var stats []UpstreamStats
+	for _, pl := range p.pools {
+		for _, u := range pl.upstreams {
+			stats = append(stats, u.stats(pl.route))
+		}
+	}
+	return stats
+}
+
+// CheckUpstreams probes every upstream directly, bypassing capture: a TCP
+// connect, or a GET of path when set. It returns the first failure.
+func (p *Proxy) CheckUpstreams(ctx context.Context, path string) error {
+	opts := LBOptions{HealthPath: path, Timeout: p.lb.Timeout}
+	for _, pl := range p.pools {
+		for _, u := range pl.upstreams {
+			if err := u.check(ctx, opts); err != nil {
+				return fmt.Errorf("%s: %w", u.URL.Host, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isDialError reports whether a request failed before reaching the upstream,
+// so it is safe to retry elsewhere
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// joinPath joins an upstream base path and a request path
+func joinPath(base, path string) string {
+	switch {
+	case base == "" || base == "/":
+		return path
+	case len(base) > 0 && base[len(base)-1] == '/' && len(path) > 0 && path[0] == '/':
+		return base + path[1:]
+	case len(path) > 0 && path[0] != '/':
+		return base + "/" + path
+	}
+	return base + path
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// holdRetryInterval is how often held requests retry a down upstream
+const holdRetryInterval = 250 * time.Millisecond
+
+// upstreamError is the body of the error page, also served as JSON
+type upstreamError struct {
+	Error    string `json:"error"`
+	Message  string `json:"message"`
+	Upstream string `json:"upstream"`
+	Detail   string `json:"detail"`
+	Hint     string `json:"hint"`
+	Held     string `json:"held,omitempty"`
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>lrok - {{.Message}}</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif; background: #0a0a0a; color: #f0f0f0; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; }
+        .card { background: #111; border: 1px solid #222; border-radius: 8px; padding: 32px; max-width: 560px; }
+        h1 { color: #FF8000; font-size: 22px; margin: 0 0 12px; }
+        p { color: #ccc; line-height: 1.5; }
+        code { background: #0a0a0a; padding: 2px 6px; border-radius: 4px; color: #10b981; }
+        .detail { color: #888; font-size: 13px; }
+    </style>
+</head>
+<body>
+    <div class="card">
+        <h1>🔌 {{.Message}}</h1>
+        <p>The lrok tunnel is up, but nothing answered on <code>{{.Upstream}}</code>.</p>
+        <p>{{.Hint}}</p>
+        <p class="detail">{{.Detail}}{{if .Held}} (held for {{.Held}}){{end}}</p>
+    </div>
+</body>
+</html>
+`))
+
+// upstreamErrorResponse answers a request whose upstream failed with an lrok
+// error page, as HTML for browsers and JSON otherwise
+func upstreamErrorResponse(req *http.Request, upstream *Upstream, err error, held time.Duration) *http.Response {
+	status := http.StatusBadGateway
+	page := upstreamError{
+		Error:    "upstream_unavailable",
+		Message:  "Local app is not running",
+		Upstream: upstream.URL.Host,
+		Detail:   err.Error(),
+		Hint:     fmt.Sprintf("Start your app on %s, or restart lrok with --hold-requests 30s to queue requests while it restarts.", upstream.URL.Host),
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		status = http.StatusGatewayTimeout
+		page.Error = "upstream_timeout"
+		page.Message = "Local app did not respond in time"
+		page.Hint = fmt.Sprintf("Your app on %s accepted the connection but took too long to answer.", upstream.URL.Host)
+	case !isDialError(err):
+		page.Error = "upstream_error"
+		page.Message = "Local app closed the connection"
+		page.Hint = fmt.Sprintf("Your app on %s dropped the request before sending a complete response. Check its logs.", upstream.URL.Host)
+	}
+	if held > 0 {
+		page.Held = held.Round(time.Millisecond).String()
+		if page.Error == "upstream_unavailable" {
+			page.Hint = fmt.Sprintf("lrok queued the request for %s, but %s did not start accepting connections.", page.Held, upstream.URL.Host)
+		}
+	}
+
+	var body strings.Builder
+	contentType := "application/json"
+	if strings.Contains(req.Header.Get("Accept"), "text/html") {
+		contentType = "text/html; charset=utf-8"
+		errorPage.Execute(&body, page)
+	} else {
+		json.NewEncoder(&body).Encode(page)
+	}
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type": {contentType},
+			"X-Lrok-Error": {page.Error},
+		},
+		Body:          io.NopCloser(strings.NewReader(body.String())),
+		ContentLength: int64(body.Len()),
+		Request:       req,
+	}
+}
@@ -2,14 +2,20 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/lum-tools/lrok/internal/metrics"
+	"github.com/lum-tools/lrok/internal/tracing"
 )
 
 // Request represents a captured HTTP request/response
@@ -26,11 +32,44 @@ type Request struct {
 	ResponseBody    string              `json:"response_body"`
 	BytesIn         int64               `json:"bytes_in"`
 	BytesOut        int64               `json:"bytes_out"`
+	TraceID         string              `json:"trace_id,omitempty"`
+	SpanID          string              `json:"span_id,omitempty"`
+	Upstream        string              `json:"upstream,omitempty"` // host:port that served the request
+	Webhook         *WebhookResult      `json:"webhook,omitempty"`  // signature check of a known webhook provider
+	Error           string              `json:"error,omitempty"`    // why the upstream could not answer
+	Held            time.Duration       `json:"held,omitempty"`     // time queued waiting for the upstream
+	Verification    bool                `json:"verification,omitempty"` // carried a VerifyHeader nonce, e.g. from lrok check
 }
 
+// ProbePath is answered by the proxy itself, on any host, for readiness
+// checks that must not reach the user's app or the inspector
+const ProbePath = "/__lrok_health"
+
+// Verification headers: a nonce sent in VerifyHeader is echoed back by the
+// proxy, proving the request reached it. Anyone can send one, so such
+// requests are still captured, tagged as verification traffic.
+// UpstreamTimeHeader carries how long the app took to answer.
+const (
+	VerifyHeader       = "X-Lrok-Verify"
+	UpstreamTimeHeader = "X-Lrok-Upstream-Time"
+)
+
+// writeTimeout is how long the app has to answer a request
+const writeTimeout = 30 * time.Second
+
+// MaxHold is the longest --hold-requests the tunnel server waits for: frps
+// gives up on a request whose response takes over a minute
+const MaxHold = time.Minute
+
 // Proxy captures and forwards HTTP requests
 type Proxy struct {
-	targetURL    *url.URL
+	routes       []Route
+	pools        []*pool // one per route, same order
+	lb           LBOptions
+	hold         time.Duration // how long requests wait for a down upstream
+	webhooks     []WebhookVerifier
+	rejectHooks  bool
+	stopHealth   context.CancelFunc
 	server       *http.Server
 	port         int
 	requests     []*Request
@@ -42,22 +81,121 @@ type Proxy struct {
 	totalBytesOut int64
 	totalConns    int64
 	statsMu       sync.RWMutex
+	metrics       *proxyMetrics
+	tracer        *tracing.Tracer
+}
+
+// proxyMetrics holds the Prometheus metrics recorded by the proxy
+type proxyMetrics struct {
+	registry         *metrics.Registry
+	requestsTotal    *metrics.CounterVec
+	requestDuration  *metrics.HistogramVec
+	requestBytes     *metrics.CounterVec
+	responseBytes    *metrics.CounterVec
+	upstreamErrors   *metrics.CounterVec
+	activeConns      *metrics.GaugeVec
+	connectionsTotal *metrics.CounterVec
+	paths            *metrics.PathSet
+}
+
+// maxMetricPaths caps the distinct path labels of the request metrics
+const maxMetricPaths = 100
+
+func newProxyMetrics() *proxyMetrics {
+	reg := metrics.NewRegistry()
+	return &proxyMetrics{
+		registry: reg,
+		requestsTotal: reg.NewCounterVec("lrok_http_requests_total",
+			"Total HTTP requests forwarded through the tunnel.", "method", "status", "path"),
+		requestDuration: reg.NewHistogramVec("lrok_http_request_duration_seconds",
+			"Latency of requests forwarded to the local service.", nil, "method", "path"),
+		requestBytes: reg.NewCounterVec("lrok_http_request_bytes_total",
+			"Request body bytes received from tunnel clients.", "method"),
+		responseBytes: reg.NewCounterVec("lrok_http_response_bytes_total",
+			"Response body bytes sent back to tunnel clients.", "method"),
+		upstreamErrors: reg.NewCounterVec("lrok_http_upstream_errors_total",
+			"Requests that failed to reach the local service.", "method"),
+		activeConns: reg.NewGaugeVec("lrok_proxy_active_connections",
+			"Connections currently open to the inspector proxy."),
+		connectionsTotal: reg.NewCounterVec("lrok_proxy_connections_total",
+			"Connections accepted by the inspector proxy."),
+		paths: metrics.NewPathSet(maxMetricPaths),
+	}
+}
+
+// observe records a completed request
+func (m *proxyMetrics) observe(req *Request) {
+	path := m.paths.Label(req.Path)
+	method := metrics.MethodLabel(req.Method)
+	m.requestsTotal.Inc(method, strconv.Itoa(req.StatusCode), path)
+	m.requestDuration.Observe(req.Duration.Seconds(), method, path)
+	m.requestBytes.Add(float64(req.BytesIn), method)
+	m.responseBytes.Add(float64(req.BytesOut), method)
+}
+
+// connState tracks open connections for the active connections gauge
+func (m *proxyMetrics) connState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		m.connectionsTotal.Inc()
+		m.activeConns.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		m.activeConns.Add(-1)
+	}
 }
 
 // New creates a new proxy to the target port
 func New(targetPort int, maxRequests int) *Proxy {
+	target, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", targetPort))
+	return NewWithRoutes([]Route{{Prefix: "/", Targets: []*url.URL{target}}}, maxRequests)
+}
+
+// NewWithRoutes creates a proxy that picks the upstream of each request by
+// host and path prefix, most specific route first
+func NewWithRoutes(routes []Route, maxRequests int) *Proxy {
 	if maxRequests == 0 {
 		maxRequests = 100
 	}
 	
-	target, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", targetPort))
+	routes = append([]Route(nil), routes...)
+	sortRoutes(routes)
+	pools := make([]*pool, len(routes))
+	for i, route := range routes {
+		pools[i] = newPool(route)
+	}
+	
+	// A tracer without an endpoint still propagates traceparent to the app
+	tracer, _ := tracing.New(tracing.Config{})
 	
-	return &Proxy{
-		targetURL:   target,
+	p := &Proxy{
+		routes:      routes,
+		pools:       pools,
 		requests:    make([]*Request, 0, maxRequests),
 		maxRequests: maxRequests,
 		listeners:   make([]chan *Request, 0),
+		metrics:     newProxyMetrics(),
+		tracer:      tracer,
 	}
+	p.SetLoadBalancing(LBOptions{})
+	return p
+}
+
+// SetHoldRequests makes requests wait up to d for a down upstream to start
+// accepting connections, e.g. while a dev server restarts
+func (p *Proxy) SetHoldRequests(d time.Duration) {
+	p.hold = min(d, MaxHold)
+}
+
+// SetTracer replaces the tracer used to create a server span per request
+func (p *Proxy) SetTracer(t *tracing.Tracer) {
+	if t != nil {
+		p.tracer = t
+	}
+}
+
+// Metrics returns the registry holding the proxy's Prometheus metrics
+func (p *Proxy) Metrics() *metrics.Registry {
+	return p.metrics.registry
 }
 
 // Start starts the proxy on an available port and waits for it to be ready
@@ -69,26 +207,45 @@ func (p *Proxy) Start() (int, error) {
 	
 	p.port = listener.Addr().(*net.TCPAddr).Port
 	
-	proxy := httputil.NewSingleHostReverseProxy(p.targetURL)
-	
-	// Customize the director to capture requests
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req)
-	}
-	
-	// Custom transport to capture response
-	proxy.Transport = &captureTransport{
-		base:  http.DefaultTransport,
-		proxy: p,
+	// The transport picks the upstream from the request's route pool
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			if _, ok := req.Header["User-Agent"]; !ok {
+				// Explicitly disable the default Go User-Agent
+				req.Header.Set("User-Agent", "")
+			}
+		},
+		Transport: &captureTransport{
+			base:  http.DefaultTransport,
+			proxy: p,
+		},
 	}
 	
 	// Add health check handler
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		proxy.ServeHTTP(w, r)
+		if nonce := r.Header.Get(VerifyHeader); nonce != "" {
+			w.Header().Set(VerifyHeader, nonce)
+			r.Header.Del(VerifyHeader)
+			r = r.WithContext(context.WithValue(r.Context(), verifyKey{}, true))
+		}
+		if p.hold > 0 {
+			// Held requests get the full hold plus the usual time to answer
+			http.NewResponseController(w).SetWriteDeadline(time.Now().Add(p.hold + writeTimeout))
+		}
+		i := p.match(r)
+		if i < 0 {
+			w.Header().Set("X-Lrok-Error", "no_route")
+			http.Error(w, fmt.Sprintf("lrok: no route for %s%s", r.Host, r.URL.Path), http.StatusNotFound)
+			return
+		}
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), poolKey{}, p.pools[i])))
 	})
-	mux.HandleFunc("/__lrok_health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(ProbePath, func(w http.ResponseWriter, r *http.Request) {
+		if nonce := r.Header.Get(VerifyHeader); nonce != "" {
+			w.Header().Set(VerifyHeader, nonce)
+		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
@@ -96,8 +253,9 @@ func (p *Proxy) Start() (int, error) {
 	p.server = &http.Server{
 		Handler: mux,
 		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		WriteTimeout: writeTimeout,
 		IdleTimeout:  120 * time.Second,
+		ConnState:    p.metrics.connState,
 	}
 	
 	// Start server in background
@@ -109,7 +267,10 @@ func (p *Proxy) Start() (int, error) {
 	
 	// Wait for server to be ready
 	<-ready
-	time.Sleep(200 * time.Millisecond) // Longer wait for full initialization
+	
+	healthCtx, cancel := context.WithCancel(context.Background())
+	p.stopHealth = cancel
+	go p.healthLoop(healthCtx)
 	
 	// Verify proxy is responding to health checks
 	if err := p.healthCheck(); err != nil {
@@ -117,19 +278,12 @@ func (p *Proxy) Start() (int, error) {
 		return 0, fmt.Errorf("proxy health check failed: %w", err)
 	}
 	
-	// CRITICAL: Warm up the reverse proxy by making a test request to target
-	// This initializes the connection pool and ensures proxy is fully ready
-	if err := p.warmUp(); err != nil {
-		p.server.Close()
-		return 0, fmt.Errorf("proxy warm-up failed: %w", err)
-	}
-	
 	return p.port, nil
 }
 
 // healthCheck verifies the proxy is responding
 func (p *Proxy) healthCheck() error {
-	url := fmt.Sprintf("http://127.0.0.1:%d/__lrok_health", p.port)
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", p.port, ProbePath)
 	client := &http.Client{Timeout: 2 * time.Second}
 	
 	for i := 0; i < 10; i++ {
@@ -147,45 +301,16 @@ func (p *Proxy) healthCheck() error {
 	return fmt.Errorf("proxy not responding after 10 attempts")
 }
 
-// warmUp makes test requests through the proxy to ensure it's fully ready
-func (p *Proxy) warmUp() error {
-	// Make a few test requests to warm up the reverse proxy
-	client := &http.Client{
-		Timeout: 3 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     30 * time.Second,
-			DisableKeepAlives:   false,
-			DisableCompression:  false,
-		},
-	}
-	
-	proxyURL := fmt.Sprintf("http://127.0.0.1:%d/", p.port)
-	
-	// Make 3 warm-up requests to ensure connection pool is ready
-	for i := 0; i < 3; i++ {
-		req, _ := http.NewRequest("GET", proxyURL, nil)
-		req.Header.Set("X-Lrok-Warmup", "true")
-		
-		resp, err := client.Do(req)
-		if err != nil {
-			time.Sleep(100 * time.Millisecond)
-			continue
-		}
-		io.ReadAll(resp.Body) // Consume body
-		resp.Body.Close()
-		
-		// After first successful request, proxy is warmed up
-		if i == 0 {
-			time.Sleep(100 * time.Millisecond)
-		}
-	}
-	
-	return nil
+// Routes returns the routes in match order
+func (p *Proxy) Routes() []Route {
+	return append([]Route(nil), p.routes...)
 }
 
 // Stop stops the proxy
 func (p *Proxy) Stop() error {
+	if p.stopHealth != nil {
+		p.stopHealth()
+	}
 	if p.server != nil {
 		return p.server.Close()
 	}
@@ -248,6 +373,8 @@ func (p *Proxy) addRequest(req *Request) {
 	p.totalBytesOut += req.BytesOut
 	p.totalConns++
 	p.statsMu.Unlock()
+
+	p.metrics.observe(req)
 	
 	// Notify listeners
 	p.listenersMu.RLock()
@@ -260,6 +387,12 @@ func (p *Proxy) addRequest(req *Request) {
 	p.listenersMu.RUnlock()
 }
 
+// poolKey carries the matched route's pool from the handler to the transport
+type poolKey struct{}
+
+// verifyKey marks verification requests, captured with Verification set
+type verifyKey struct{}
+
 // captureTransport wraps http.Transport to capture responses
 type captureTransport struct {
 	base  http.RoundTripper
@@ -284,12 +417,46 @@ func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error)
 		req.Body = io.NopCloser(bytes.NewBuffer(reqBody))
 	}
 	
-	// Forward request
-	resp, err := t.base.RoundTrip(req)
+	// Continue the caller's trace (or start one) and pass it on to the app
+	span := t.proxy.tracer.StartServerSpan(fmt.Sprintf("%s %s", req.Method, metrics.PathTemplate(req.URL.Path)), req.Header)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.path", req.URL.Path)
+	span.SetAttribute("server.address", req.Host)
+	if ua := req.Header.Get("User-Agent"); ua != "" {
+		span.SetAttribute("user_agent.original", ua)
+	}
+	span.Inject(req.Header)
+	defer span.End()
+	
+	// Invalid webhooks are answered here instead of forwarded when rejecting
+	webhook := t.proxy.verifyWebhook(req, reqBody)
+	var upstream *Upstream
+	var resp *http.Response
+	var held time.Duration
+	var err error
+	if webhook != nil && webhook.Rejected {
+		resp = webhookRejection(req, webhook)
+	} else {
+		upstream, resp, held, err = t.forward(req, reqBody)
+		if resp != nil {
+			defer upstream.active.Add(-1)
+		}
+		span.SetAttribute("lrok.upstream", upstream.URL.Host)
+	}
 	duration := time.Since(start)
 	
+	// Failed attempts are captured too, and answered with an lrok error page
+	upstreamErr := ""
 	if err != nil {
-		return nil, err
+		t.proxy.metrics.upstreamErrors.Inc(metrics.MethodLabel(req.Method))
+		span.SetError(err.Error())
+		upstreamErr = err.Error()
+		resp = upstreamErrorResponse(req, upstream, err, held)
+	}
+	
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 && err == nil {
+		span.SetError(http.StatusText(resp.StatusCode))
 	}
 	
 	// Capture response
@@ -320,10 +487,105 @@ func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error)
 		ResponseBody:    string(respBody),
 		BytesIn:         int64(len(reqBody)),
 		BytesOut:        int64(len(respBody)),
+		TraceID:         span.Context.TraceIDString(),
+		SpanID:          span.Context.SpanIDString(),
+		Webhook:         webhook,
+		Error:           upstreamErr,
+		Held:            held,
+	}
+	if upstream != nil {
+		captured.Upstream = upstream.URL.Host
 	}
 	
+	if req.Context().Value(verifyKey{}) != nil {
+		captured.Verification = true
+		resp.Header.Set(UpstreamTimeHeader, duration.String())
+	}
 	t.proxy.addRequest(captured)
 	
 	return resp, nil
 }
 
+// forward sends the request to the route's pool, failing over to another
+// upstream if one refuses the connection. With requests held, it keeps
+// retrying until an upstream accepts or the hold time runs out. A returned
+// response holds the upstream's active count until the caller releases it.
+func (t *captureTransport) forward(req *http.Request, body []byte) (*Upstream, *http.Response, time.Duration, error) {
+	pool := req.Context().Value(poolKey{}).(*pool)
+	tried := make(map[*Upstream]bool)
+	var upstream *Upstream
+	var resp *http.Response
+	var err error
+	var holdStart time.Time
+	for {
+		next := pool.pick(t.proxy.lb.Strategy, tried)
+		if next == nil {
+			// Every upstream refused: wait for the app to come back
+			if t.proxy.hold <= 0 || !isDialError(err) {
+				break
+			}
+			if holdStart.IsZero() {
+				holdStart = time.Now()
+			}
+			if time.Since(holdStart) >= t.proxy.hold {
+				break
+			}
+			select {
+			case <-req.Context().Done():
+				return upstream, nil, time.Since(holdStart), req.Context().Err()
+			case <-time.After(holdRetryInterval):
+			}
+			tried = make(map[*Upstream]bool)
+			continue
+		}
+		upstream = next
+		tried[upstream] = true
+		
+		out := req.Clone(req.Context())
+		out.URL.Scheme = upstream.URL.Scheme
+		out.URL.Host = upstream.URL.Host
+		out.URL.Path = joinPath(upstream.URL.Path, req.URL.Path)
+		if req.Body != nil {
+			out.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		
+		upstream.requests.Add(1)
+		upstream.active.Add(1)
+		resp, err = t.base.RoundTrip(out)
+		if err == nil {
+			if !upstream.Healthy() {
+				upstream.setHealth(nil)
+			}
+			break
+		}
+		upstream.active.Add(-1)
+		upstream.failures.Add(1)
+		if !isDialError(err) {
+			break
+		}
+		upstream.setHealth(err)
+	}
+	
+	var held time.Duration
+	if !holdStart.IsZero() {
+		held = time.Since(holdStart)
+	}
+	return upstream, resp, held, err
+}
+
+// webhookRejection is the 401 sent instead of forwarding an invalid webhook
+func webhookRejection(req *http.Request, result *WebhookResult) *http.Response {
+	body := fmt.Sprintf("lrok: invalid %s webhook signature (%s): %s\n", result.Provider, result.Reason, result.Detail)
+	return &http.Response{
+		Status:        "401 Unauthorized",
+		StatusCode:    http.StatusUnauthorized,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Route sends requests matching a host and path prefix to local upstreams
+type Route struct {
+	Host    string     // Host header to match without port; empty matches any host
+	Prefix  string     // path prefix on a segment boundary; "/" matches everything
+	Targets []*url.URL // upstream base URLs, load balanced when more than one
+}
+
+// String renders the route in --route syntax
+func (r Route) String() string {
+	return fmt.Sprintf("%s%s=%s", r.Host, r.Prefix, r.Upstreams())
+}
+
+// Upstreams lists the route's upstream hosts, comma-separated
+func (r Route) Upstreams() string {
+	hosts := make([]string, len(r.Targets))
+	for i, t := range r.Targets {
+		hosts[i] = t.Host
+	}
+	return strings.Join(hosts, ",")
+}
+
+// ParseRoute parses [host]/prefix=upstream[,upstream...], where each
+// upstream is a port, host:port or URL. "api.example.com=8080" routes a
+// whole host.
+func ParseRoute(spec string) (Route, error) {
+	match, upstream, ok := strings.Cut(spec, "=")
+	if !ok || upstream == "" {
+		return Route{}, fmt.Errorf("invalid route '%s' (expected /prefix=port)", spec)
+	}
+
+	route := Route{Prefix: "/"}
+	if i := strings.Index(match, "/"); i >= 0 {
+		route.Host, route.Prefix = match[:i], match[i:]
+	} else {
+		route.Host = match
+	}
+	if route.Host == "" && match == "" {
+		return Route{}, fmt.Errorf("invalid route '%s' (expected /prefix=port)", spec)
+	}
+	route.Host = strings.ToLower(route.Host)
+	if len(route.Prefix) > 1 {
+		route.Prefix = strings.TrimSuffix(route.Prefix, "/")
+	}
+
+	targets, err := ParseUpstreams(upstream)
+	if err != nil {
+		return Route{}, fmt.Errorf("invalid route '%s': %w", spec, err)
+	}
+	route.Targets = targets
+	return route, nil
+}
+
+// ParseRoutes parses route specs. A fallbackPort above zero serves every
+// path no route claims.
+func ParseRoutes(specs []string, fallbackPort int) ([]Route, error) {
+	routes := make([]Route, 0, len(specs)+1)
+	catchAll := false
+	for _, spec := range specs {
+		route, err := ParseRoute(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range routes {
+			if existing.Host == route.Host && existing.Prefix == route.Prefix {
+				return nil, fmt.Errorf("duplicate route for '%s%s'", route.Host, route.Prefix)
+			}
+		}
+		if route.Host == "" && route.Prefix == "/" {
+			catchAll = true
+		}
+		routes = append(routes, route)
+	}
+
+	if fallbackPort > 0 && !catchAll {
+		target, err := parseUpstream(strconv.Itoa(fallbackPort))
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, Route{Prefix: "/", Targets: []*url.URL{target}})
+	}
+	return routes, nil
+}
+
+// ParseUpstreams parses a comma-separated list of upstreams
+func ParseUpstreams(value string) ([]*url.URL, error) {
+	var targets []*url.URL
+	for _, part := range strings.Split(value, ",") {
+		target, err := parseUpstream(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// parseUpstream accepts a port, host:port or http(s) URL
+func parseUpstream(value string) (*url.URL, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 1 || n > 65535 {
+			return nil, fmt.Errorf("port must be between 1 and 65535, got %d", n)
+		}
+		return &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", value)}, nil
+	}
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream '%s'", value)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported upstream scheme '%s'", u.Scheme)
+	}
+	return u, nil
+}
+
+// sortRoutes orders routes so the first match is the most specific:
+// host routes before any-host routes, then longer prefixes first
+func sortRoutes(routes []Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		if (a.Host != "") != (b.Host != "") {
+			return a.Host != ""
+		}
+		return len(a.Prefix) > len(b.Prefix)
+	})
+}
+
+// match returns the index of the route for a request, or -1 if none applies
+func (p *Proxy) match(req *http.Request) int {
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for i := range p.routes {
+		r := &p.routes[i]
+		if r.Host != "" && r.Host != host {
+			continue
+		}
+		if hasPathPrefix(req.URL.Path, r.Prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasPathPrefix matches whole path segments: /api matches /api and /api/x, not /apix
+func hasPathPrefix(path, prefix string) bool {
+	if prefix == "/" {
+		return true
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
+}
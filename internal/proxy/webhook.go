@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook providers understood by --verify-webhook
+const (
+	WebhookStripe  = "stripe"
+	WebhookGitHub  = "github"
+	WebhookSlack   = "slack"
+	WebhookTwilio  = "twilio"
+	WebhookShopify = "shopify"
+	WebhookHMAC    = "hmac" // generic hex or base64 HMAC-SHA256 of the body
+)
+
+// Reasons a webhook signature failed verification
+const (
+	WebhookMissingSignature = "missing_signature"
+	WebhookMalformed        = "malformed_signature"
+	WebhookWrongSecret      = "wrong_secret"
+	WebhookBodyMutated      = "body_mutated"
+	WebhookTimestampSkew    = "timestamp_skew"
+)
+
+// WebhookTolerance is how far a signed timestamp may drift from now
+const WebhookTolerance = 5 * time.Minute
+
+// genericSignatureHeaders are checked in order by the hmac provider
+var genericSignatureHeaders = []string{"X-Signature-256", "X-Signature", "X-Webhook-Signature", "X-Hub-Signature-256"}
+
+// WebhookVerifier checks the signatures of one provider's webhooks
+type WebhookVerifier struct {
+	Provider string
+	Secret   string
+	Header   string // signature header for the hmac provider; empty tries common ones
+}
+
+// WebhookResult is the outcome of verifying a captured request
+type WebhookResult struct {
+	Provider string `json:"provider"`
+	Valid    bool   `json:"valid"`
+	Reason   string `json:"reason,omitempty"` // one of the Webhook* reasons when invalid
+	Detail   string `json:"detail"`
+	Rejected bool   `json:"rejected,omitempty"` // answered 401 instead of forwarding
+}
+
+// ParseWebhookVerifier parses provider:secret, or hmac[=header]:secret
+func ParseWebhookVerifier(spec string) (WebhookVerifier, error) {
+	provider, secret, ok := strings.Cut(spec, ":")
+	if !ok || secret == "" {
+		return WebhookVerifier{}, fmt.Errorf("invalid webhook verifier '%s' (expected provider:secret)", provider)
+	}
+	v := WebhookVerifier{Provider: strings.ToLower(provider), Secret: secret}
+	if name, header, ok := strings.Cut(v.Provider, "="); ok && name == WebhookHMAC {
+		v.Provider, v.Header = name, http.CanonicalHeaderKey(header)
+	}
+
+	switch v.Provider {
+	case WebhookStripe, WebhookGitHub, WebhookSlack, WebhookTwilio, WebhookShopify, WebhookHMAC:
+		return v, nil
+	}
+	return WebhookVerifier{}, fmt.Errorf("unknown webhook provider '%s', must be one of: stripe, github, slack, twilio, shopify, hmac", v.Provider)
+}
+
+// ParseWebhookVerifiers parses --verify-webhook values
+func ParseWebhookVerifiers(specs []string) ([]WebhookVerifier, error) {
+	verifiers := make([]WebhookVerifier, 0, len(specs))
+	for _, spec := range specs {
+		v, err := ParseWebhookVerifier(spec)
+		if err != nil {
+			return nil, err
+		}
+		verifiers = append(verifiers, v)
+	}
+	return verifiers, nil
+}
+
+// signatureHeader returns the header carrying the provider's signature, if present
+func (v WebhookVerifier) signatureHeader(req *http.Request) string {
+	switch v.Provider {
+	case WebhookStripe:
+		return "Stripe-Signature"
+	case WebhookGitHub:
+		if req.Header.Get("X-Hub-Signature-256") == "" && req.Header.Get("X-Hub-Signature") != "" {
+			return "X-Hub-Signature"
+		}
+		return "X-Hub-Signature-256"
+	case WebhookSlack:
+		return "X-Slack-Signature"
+	case WebhookTwilio:
+		return "X-Twilio-Signature"
+	case WebhookShopify:
+		return "X-Shopify-Hmac-Sha256"
+	}
+	if v.Header != "" {
+		return v.Header
+	}
+	for _, h := range genericSignatureHeaders {
+		if req.Header.Get(h) != "" {
+			return h
+		}
+	}
+	return genericSignatureHeaders[0]
+}
+
+// Applies reports whether the request carries this provider's signature header
+func (v WebhookVerifier) Applies(req *http.Request) bool {
+	return req.Header.Get(v.signatureHeader(req)) != ""
+}
+
+// Verify checks the request's signature against the raw body
+func (v WebhookVerifier) Verify(req *http.Request, body []byte, now time.Time) *WebhookResult {
+	result := &WebhookResult{Provider: v.Provider}
+	header := v.signatureHeader(req)
+	signature := req.Header.Get(header)
+	if signature == "" {
+		result.Reason = WebhookMissingSignature
+		result.Detail = fmt.Sprintf("no %s header", header)
+		return result
+	}
+
+	// sign computes the expected signatures for a body; timestamp is checked separately
+	var sign func(body []byte) []string
+	var timestamp string
+	given := []string{signature}
+	switch v.Provider {
+	case WebhookGitHub:
+		algo, newHash := "sha256", sha256.New
+		if header == "X-Hub-Signature" {
+			algo, newHash = "sha1", sha1.New
+		}
+		sign = func(body []byte) []string {
+			return []string{algo + "=" + hex.EncodeToString(mac(newHash, v.Secret, body))}
+		}
+		given = []string{strings.ToLower(signature)}
+
+	case WebhookStripe:
+		var sigs []string
+		for _, part := range strings.Split(signature, ",") {
+			k, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "t":
+				timestamp = val
+			case "v1":
+				sigs = append(sigs, val)
+			}
+		}
+		if timestamp == "" || len(sigs) == 0 {
+			result.Reason = WebhookMalformed
+			result.Detail = "Stripe-Signature needs t= and v1= parts"
+			return result
+		}
+		// Any v1 signature may match, e.g. during secret rotation
+		given = sigs
+		sign = func(body []byte) []string {
+			return []string{hex.EncodeToString(mac(sha256.New, v.Secret, append([]byte(timestamp+"."), body...)))}
+		}
+
+	case WebhookSlack:
+		timestamp = req.Header.Get("X-Slack-Request-Timestamp")
+		if timestamp == "" {
+			result.Reason = WebhookMalformed
+			result.Detail = "no X-Slack-Request-Timestamp header"
+			return result
+		}
+		sign = func(body []byte) []string {
+			base := append([]byte("v0:"+timestamp+":"), body...)
+			return []string{"v0=" + hex.EncodeToString(mac(sha256.New, v.Secret, base))}
+		}
+
+	case WebhookShopify:
+		sign = func(body []byte) []string {
+			return []string{base64.StdEncoding.EncodeToString(mac(sha256.New, v.Secret, body))}
+		}
+
+	case WebhookTwilio:
+		sign = func(body []byte) []string {
+			var sigs []string
+			for _, u := range twilioURLs(req) {
+				sigs = append(sigs, base64.StdEncoding.EncodeToString(mac(sha1.New, v.Secret, twilioPayload(req, u, body))))
+			}
+			return sigs
+		}
+
+	default:
+		sign = func(body []byte) []string {
+			sum := mac(sha256.New, v.Secret, body)
+			return []string{hex.EncodeToString(sum), base64.StdEncoding.EncodeToString(sum)}
+		}
+		given = []string{strings.TrimPrefix(signature, "sha256=")}
+	}
+
+	if !signatureMatches(given, sign(body)) {
+		result.Reason = WebhookWrongSecret
+		result.Detail = "signature does not match the body with this secret"
+		for _, variant := range bodyVariants(body) {
+			if signatureMatches(given, sign(variant.body)) {
+				result.Reason = WebhookBodyMutated
+				result.Detail = fmt.Sprintf("signature matches the body %s; something between sender and tunnel changed it", variant.change)
+				break
+			}
+		}
+		return result
+	}
+
+	if timestamp != "" {
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			result.Reason = WebhookMalformed
+			result.Detail = fmt.Sprintf("invalid timestamp '%s'", timestamp)
+			return result
+		}
+		skew := now.Sub(time.Unix(sec, 0)).Round(time.Second)
+		if skew > WebhookTolerance || skew < -WebhookTolerance {
+			result.Reason = WebhookTimestampSkew
+			result.Detail = fmt.Sprintf("signed %s ago, outside the %s tolerance (replayed request or clock skew)", skew, WebhookTolerance)
+			return result
+		}
+	}
+
+	result.Valid = true
+	result.Detail = "signature valid; if your app rejects it, verify against the raw body before parsing it"
+	return result
+}
+
+// SetWebhookVerifiers annotates requests carrying a known signature header
+// with the verification result, answering 401 to invalid ones when reject is set
+func (p *Proxy) SetWebhookVerifiers(verifiers []WebhookVerifier, reject bool) {
+	p.webhooks = verifiers
+	p.rejectHooks = reject
+}
+
+// verifyWebhook checks the request with the first verifier whose header it carries
+func (p *Proxy) verifyWebhook(req *http.Request, body []byte) *WebhookResult {
+	for _, v := range p.webhooks {
+		if v.Applies(req) {
+			result := v.Verify(req, body, time.Now())
+			result.Rejected = !result.Valid && p.rejectHooks
+			return result
+		}
+	}
+	return nil
+}
+
+func mac(newHash func() hash.Hash, secret string, data []byte) []byte {
+	h := hmac.New(newHash, []byte(secret))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// signatureMatches reports whether any given signature equals any expected one
+func signatureMatches(given, expected []string) bool {
+	for _, g := range given {
+		for _, e := range expected {
+			if hmac.Equal([]byte(g), []byte(e)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type bodyVariant struct {
+	change string
+	body   []byte
+}
+
+// bodyVariants are common ways a body gets altered in transit, used to tell
+// a mutated body from a wrong secret
+func bodyVariants(body []byte) []bodyVariant {
+	variants := []bodyVariant{
+		{"without its trailing newline", bytes.TrimRight(body, "\r\n")},
+		{"with a trailing newline", append(append([]byte(nil), body...), '\n')},
+		{"with CRLF line endings", bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n"))},
+		{"with LF line endings", bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))},
+	}
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		variants = append(variants, bodyVariant{"as compact JSON", compact.Bytes()})
+		var indented bytes.Buffer
+		if json.Indent(&indented, compact.Bytes(), "", "  ") == nil {
+			variants = append(variants, bodyVariant{"as indented JSON", indented.Bytes()})
+		}
+	}
+
+	unique := variants[:0]
+	for _, v := range variants {
+		if !bytes.Equal(v.body, body) {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// twilioURLs are the public URLs Twilio may have signed: the forwarded scheme
+// first, with and without an explicit port
+func twilioURLs(req *http.Request) []string {
+	scheme := "https"
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := req.Host
+	urls := []string{scheme + "://" + host + req.URL.RequestURI()}
+	if !strings.Contains(host, ":") {
+		port := "443"
+		if scheme == "http" {
+			port = "80"
+		}
+		urls = append(urls, scheme+"://"+host+":"+port+req.URL.RequestURI())
+	}
+	return urls
+}
+
+// twilioPayload is the URL followed by the sorted form parameters, each name
+// directly followed by its value
+func twilioPayload(req *http.Request, u string, body []byte) []byte {
+	payload := []byte(u)
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return payload
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return payload
+	}
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, val := range form[k] {
+			payload = append(payload, k+val...)
+		}
+	}
+	return payload
+}
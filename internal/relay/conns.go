@@ -0,0 +1,228 @@
+package relay
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/decode"
+)
+
+// firstBytes is how much of each direction a connection record keeps
+const firstBytes = 256
+
+// Conn is the record of one connection through the relay
+type Conn struct {
+	ID         string        `json:"id"`
+	RemoteAddr string        `json:"remote_addr"`
+	Start      time.Time     `json:"start"`
+	End        *time.Time    `json:"end,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	BytesIn    int64         `json:"bytes_in"`
+	BytesOut   int64         `json:"bytes_out"`
+	FirstIn    string        `json:"first_in,omitempty"`  // hexdump of the first bytes from the remote side
+	FirstOut   string        `json:"first_out,omitempty"` // hexdump of the first bytes from the target
+	Error      string        `json:"error,omitempty"`
+
+	Protocol string         `json:"protocol,omitempty"` // set when decoding
+	Events   []decode.Event `json:"events,omitempty"`
+}
+
+// session tracks a connection while it is open
+type session struct {
+	conn              Conn
+	bytesIn, bytesOut atomic.Int64
+	firstIn, firstOut []byte
+	stream            *decode.Stream
+}
+
+// recorder keeps the most recent connection records
+type recorder struct {
+	mu          sync.Mutex
+	limit       int
+	next        int64
+	decode      string // protocol to decode connections as, empty for none
+	sessions    []*session
+	subscribers map[chan Conn]struct{}
+}
+
+// SetRecording keeps records of the last n connections; call before Start
+func (r *Relay) SetRecording(n int) {
+	r.rec = &recorder{limit: n, subscribers: make(map[chan Conn]struct{})}
+}
+
+// SetDecoding decodes recorded connections as protocol, or detects it
+// with decode.Auto; call after SetRecording
+func (r *Relay) SetDecoding(protocol string) {
+	if r.rec != nil {
+		r.rec.decode = protocol
+	}
+}
+
+// Recording reports whether the relay keeps connection records
+func (r *Relay) Recording() bool {
+	return r.rec != nil
+}
+
+// Connections returns the recorded connections, newest first
+func (r *Relay) Connections() []Conn {
+	if r.rec == nil {
+		return []Conn{}
+	}
+	r.rec.mu.Lock()
+	defer r.rec.mu.Unlock()
+	conns := make([]Conn, 0, len(r.rec.sessions))
+	for i := len(r.rec.sessions) - 1; i >= 0; i-- {
+		conns = append(conns, r.rec.snapshot(r.rec.sessions[i]))
+	}
+	return conns
+}
+
+// Subscribe returns a channel receiving every connection as it opens and
+// again when it closes
+func (r *Relay) Subscribe() chan Conn {
+	ch := make(chan Conn, 100)
+	if r.rec != nil {
+		r.rec.mu.Lock()
+		r.rec.subscribers[ch] = struct{}{}
+		r.rec.mu.Unlock()
+	}
+	return ch
+}
+
+// Unsubscribe stops sending connections to ch
+func (r *Relay) Unsubscribe(ch chan Conn) {
+	if r.rec == nil {
+		return
+	}
+	r.rec.mu.Lock()
+	defer r.rec.mu.Unlock()
+	if _, ok := r.rec.subscribers[ch]; ok {
+		delete(r.rec.subscribers, ch)
+		close(ch)
+	}
+}
+
+// open starts a record for a connection from remoteAddr
+func (rec *recorder) open(remoteAddr string) *session {
+	if rec == nil {
+		return nil
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.next++
+	s := &session{conn: Conn{
+		ID:         fmt.Sprintf("conn-%d", rec.next),
+		RemoteAddr: remoteAddr,
+		Start:      time.Now(),
+	}}
+	if rec.decode != "" {
+		s.stream = decode.NewStream(rec.decode)
+	}
+	rec.sessions = append(rec.sessions, s)
+	if len(rec.sessions) > rec.limit {
+		rec.sessions = rec.sessions[1:]
+	}
+	rec.publish(s)
+	return s
+}
+
+// close ends a record, with the error that ended the connection if any
+func (rec *recorder) close(s *session, err error) {
+	if s == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	end := time.Now()
+	s.conn.End = &end
+	if err != nil {
+		s.conn.Error = err.Error()
+	}
+	rec.publish(s)
+}
+
+// setRemote replaces the remote address, e.g. with one from a PROXY header
+func (rec *recorder) setRemote(s *session, addr string) {
+	if s == nil || addr == "" {
+		return
+	}
+	rec.mu.Lock()
+	s.conn.RemoteAddr = addr
+	rec.mu.Unlock()
+}
+
+// count adds forwarded bytes to a record, keeping the first few
+func (rec *recorder) count(s *session, in bool, data []byte) {
+	if s == nil {
+		return
+	}
+	first := &s.firstOut
+	if in {
+		s.bytesIn.Add(int64(len(data)))
+		first = &s.firstIn
+	} else {
+		s.bytesOut.Add(int64(len(data)))
+	}
+	decoded := feed(s.stream, in, data)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(*first) < firstBytes {
+		*first = append(*first, data[:min(len(data), firstBytes-len(*first))]...)
+	}
+	if decoded > 0 {
+		rec.publish(s)
+	}
+}
+
+// feed decodes forwarded bytes; a decoder that panics stops decoding the
+// connection rather than taking the tunnel down with it
+func feed(stream *decode.Stream, in bool, data []byte) (decoded int) {
+	if stream == nil {
+		return 0
+	}
+	defer func() {
+		if recover() != nil {
+			stream.Stop()
+			decoded = 0
+		}
+	}()
+	return stream.Feed(in, data)
+}
+
+// snapshot copies a record; the caller holds rec.mu
+func (rec *recorder) snapshot(s *session) Conn {
+	c := s.conn
+	c.BytesIn = s.bytesIn.Load()
+	c.BytesOut = s.bytesOut.Load()
+	if c.End != nil {
+		c.Duration = c.End.Sub(c.Start)
+	} else {
+		c.Duration = time.Since(c.Start)
+	}
+	if len(s.firstIn) > 0 {
+		c.FirstIn = hex.Dump(s.firstIn)
+	}
+	if len(s.firstOut) > 0 {
+		c.FirstOut = hex.Dump(s.firstOut)
+	}
+	if s.stream != nil {
+		c.Protocol = s.stream.Protocol()
+		c.Events = s.stream.Events()
+	}
+	return c
+}
+
+// publish sends a record to subscribers without blocking; the caller
+// holds rec.mu
+func (rec *recorder) publish(s *session) {
+	c := rec.snapshot(s)
+	for ch := range rec.subscribers {
+		select {
+		case ch <- c:
+		default:
+		}
+	}
+}
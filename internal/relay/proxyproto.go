@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// readProxyHeader consumes a PROXY protocol v1 or v2 header from br and
+// returns the original client address. Without a header it returns an empty
+// address and leaves br untouched.
+func readProxyHeader(br *bufio.Reader) (string, error) {
+	if prefix, _ := br.Peek(len(proxyV2Signature)); bytes.Equal(prefix, proxyV2Signature) {
+		return readProxyV2(br)
+	}
+	if prefix, _ := br.Peek(6); string(prefix) == "PROXY " {
+		return readProxyV1(br)
+	}
+	return "", nil
+}
+
+// readProxyV1 parses "PROXY TCP4 <src> <dst> <sport> <dport>\r\n"
+func readProxyV1(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("invalid PROXY header: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return "", nil
+	}
+	if len(fields) != 6 {
+		return "", fmt.Errorf("invalid PROXY header %q", strings.TrimSpace(line))
+	}
+	return net.JoinHostPort(fields[2], fields[4]), nil
+}
+
+// readProxyV2 parses the binary header: signature, version and command,
+// address family, length, then the addresses
+func readProxyV2(br *bufio.Reader) (string, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return "", fmt.Errorf("invalid PROXY header: %w", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(br, body); err != nil {
+		return "", fmt.Errorf("invalid PROXY header: %w", err)
+	}
+	if header[12]&0x0f == 0 { // LOCAL: a health check, no client address
+		return "", nil
+	}
+	switch header[13] >> 4 {
+	case 1: // IPv4
+		if len(body) >= 12 {
+			return net.JoinHostPort(net.IP(body[0:4]).String(), fmt.Sprint(binary.BigEndian.Uint16(body[8:10]))), nil
+		}
+	case 2: // IPv6
+		if len(body) >= 36 {
+			return net.JoinHostPort(net.IP(body[0:16]).String(), fmt.Sprint(binary.BigEndian.Uint16(body[32:34]))), nil
+		}
+	}
+	return "", nil
+}
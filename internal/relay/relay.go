@@ -0,0 +1,338 @@
+// Package relay counts a tunnel's wire-level traffic in a local TCP relay
+// between frpc and the target, and enforces local traffic limits.
+package relay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Why a relay stopped the tunnel
+const (
+	ReasonMaxBytes = "max_bytes"
+	ReasonExpired  = "expired"
+)
+
+// errTooManyConns is recorded for connections refused by MaxConns
+var errTooManyConns = errors.New("refused: too many connections")
+
+// Limits bound a tunnel's traffic; zero values mean unlimited
+type Limits struct {
+	MaxBytes    int64         `json:"max_bytes,omitempty"`    // bytes in both directions, then the tunnel stops
+	MaxConns    int           `json:"max_conns,omitempty"`    // simultaneous connections, more are refused
+	ExpireAfter time.Duration `json:"expire_after,omitempty"` // then the tunnel stops
+}
+
+// Stats are a relay's counters
+type Stats struct {
+	BytesIn     int64      `json:"bytes_in"`  // from the public side to the target
+	BytesOut    int64      `json:"bytes_out"` // from the target to the public side
+	Connections int64      `json:"connections"`
+	Active      int64      `json:"active"`
+	Rejected    int64      `json:"rejected"`
+	Limits      Limits     `json:"limits"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Relay forwards connections from a local port to a target address
+type Relay struct {
+	target   string
+	limits   Limits
+	listener net.Listener
+
+	bytesIn, bytesOut atomic.Int64
+	conns, active     atomic.Int64
+	rejected          atomic.Int64
+
+	rec           *recorder
+	proxyProtocol bool
+
+	mu        sync.Mutex
+	open      map[net.Conn]struct{}
+	expiresAt time.Time
+	timer     *time.Timer
+	reason    string
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+// New creates a relay to target (host:port)
+func New(target string, limits Limits) *Relay {
+	return &Relay{
+		target: target,
+		limits: limits,
+		open:   make(map[net.Conn]struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// SetProxyProtocol strips the PROXY protocol header frpc sends ahead of
+// each connection, recording the client address it carries
+func (r *Relay) SetProxyProtocol(enable bool) {
+	r.proxyProtocol = enable
+}
+
+// Start listens on a random local port and returns it
+func (r *Relay) Start() (int, error) {
+	return r.StartOn("127.0.0.1:0")
+}
+
+// StartOn listens on addr (host:port) and returns the port
+func (r *Relay) StartOn(addr string) (int, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start relay: %w", err)
+	}
+	r.listener = listener
+
+	if r.limits.ExpireAfter > 0 {
+		r.mu.Lock()
+		r.expiresAt = time.Now().Add(r.limits.ExpireAfter)
+		r.timer = time.AfterFunc(r.limits.ExpireAfter, func() { r.stop(ReasonExpired) })
+		r.mu.Unlock()
+	}
+
+	go r.acceptLoop()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Done is closed once a limit stops the relay
+func (r *Relay) Done() <-chan struct{} {
+	return r.done
+}
+
+// Reason returns why the relay stopped, empty while it runs
+func (r *Relay) Reason() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reason
+}
+
+// Err describes the limit that stopped the relay, nil while it runs
+func (r *Relay) Err() error {
+	switch r.Reason() {
+	case ReasonExpired:
+		return fmt.Errorf("tunnel expired after %s", r.limits.ExpireAfter)
+	case ReasonMaxBytes:
+		return fmt.Errorf("traffic limit of %s reached", FormatBytes(r.limits.MaxBytes))
+	}
+	return nil
+}
+
+// Stats returns the current counters
+func (r *Relay) Stats() Stats {
+	stats := Stats{
+		BytesIn:     r.bytesIn.Load(),
+		BytesOut:    r.bytesOut.Load(),
+		Connections: r.conns.Load(),
+		Active:      r.active.Load(),
+		Rejected:    r.rejected.Load(),
+		Limits:      r.limits,
+	}
+	r.mu.Lock()
+	if !r.expiresAt.IsZero() {
+		expiresAt := r.expiresAt
+		stats.ExpiresAt = &expiresAt
+	}
+	r.mu.Unlock()
+	return stats
+}
+
+// Close stops accepting and closes every open connection
+func (r *Relay) Close() error {
+	r.mu.Lock()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	for conn := range r.open {
+		conn.Close()
+	}
+	r.mu.Unlock()
+	if r.listener != nil {
+		return r.listener.Close()
+	}
+	return nil
+}
+
+// stop ends the relay because a limit was reached
+func (r *Relay) stop(reason string) {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		r.reason = reason
+		r.mu.Unlock()
+		r.Close()
+		close(r.done)
+	})
+}
+
+func (r *Relay) acceptLoop() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		if r.limits.MaxConns > 0 && r.active.Load() >= int64(r.limits.MaxConns) {
+			r.rejected.Add(1)
+			r.rec.close(r.rec.open(conn.RemoteAddr().String()), errTooManyConns)
+			conn.Close()
+			continue
+		}
+		r.conns.Add(1)
+		r.active.Add(1)
+		go r.handle(conn)
+	}
+}
+
+func (r *Relay) handle(client net.Conn) {
+	defer r.active.Add(-1)
+	s := r.rec.open(client.RemoteAddr().String())
+
+	var src io.Reader = client
+	if r.proxyProtocol {
+		br := bufio.NewReader(client)
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		addr, err := readProxyHeader(br)
+		client.SetReadDeadline(time.Time{})
+		if err != nil {
+			client.Close()
+			r.rec.close(s, err)
+			return
+		}
+		r.rec.setRemote(s, addr)
+		src = br
+	}
+
+	upstream, err := net.DialTimeout("tcp", r.target, 10*time.Second)
+	if err != nil {
+		client.Close()
+		r.rec.close(s, err)
+		return
+	}
+	if !r.track(client, upstream) {
+		client.Close()
+		upstream.Close()
+		r.rec.close(s, nil)
+		return
+	}
+	defer r.untrack(client, upstream)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		r.copy(upstream, src, &r.bytesIn, s, true)
+	}()
+	go func() {
+		defer wg.Done()
+		r.copy(client, upstream, &r.bytesOut, s, false)
+	}()
+	wg.Wait()
+	r.rec.close(s, nil)
+}
+
+// track registers open connections, failing once the relay has stopped
+func (r *Relay) track(conns ...net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.reason != "" {
+		return false
+	}
+	for _, c := range conns {
+		r.open[c] = struct{}{}
+	}
+	return true
+}
+
+func (r *Relay) untrack(conns ...net.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+		delete(r.open, c)
+	}
+}
+
+// copy forwards src to dst, counting into n and the connection's record
+// and stopping the relay when the byte limit is used up
+func (r *Relay) copy(dst net.Conn, src io.Reader, n *atomic.Int64, s *session, in bool) {
+	defer closeWrite(dst)
+	buf := make([]byte, 32*1024)
+	for {
+		read, err := src.Read(buf)
+		if read > 0 {
+			chunk := buf[:read]
+			exhausted := false
+			if limit := r.limits.MaxBytes; limit > 0 {
+				left := limit - r.bytesIn.Load() - r.bytesOut.Load()
+				if int64(len(chunk)) >= left {
+					chunk, exhausted = chunk[:max(left, 0)], true
+				}
+			}
+			written, werr := dst.Write(chunk)
+			n.Add(int64(written))
+			r.rec.count(s, in, chunk[:written])
+			if exhausted {
+				r.stop(ReasonMaxBytes)
+				return
+			}
+			if werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// closeWrite half-closes a TCP connection so the peer sees EOF
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// byteUnits are the suffixes ParseBytes accepts, in powers of 1024
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// ParseBytes parses a size such as "500MB", "2GB" or "1048576"
+func ParseBytes(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	size := int64(1)
+	for _, unit := range byteUnits {
+		if rest, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s, size = strings.TrimSpace(rest), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size '%s' (e.g. 500MB, 2GB)", value)
+	}
+	return int64(n * float64(size)), nil
+}
+
+// FormatBytes renders a byte count for humans, e.g. "1.5 MB"
+func FormatBytes(n int64) string {
+	for _, unit := range byteUnits[:4] {
+		if n >= unit.size {
+			return fmt.Sprintf("%.1f %s", float64(n)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
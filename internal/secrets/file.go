@@ -0,0 +1,176 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PassphraseEnv holds the passphrase of the encrypted file backend
+const PassphraseEnv = "LROK_SECRETS_PASSPHRASE"
+
+// pbkdf2Iterations is the key derivation cost for the encrypted file
+const pbkdf2Iterations = 210000
+
+// fileFormat is the on-disk layout of secrets.enc
+type fileFormat struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// FileStore keeps keys in an AES-GCM encrypted file protected by a passphrase
+type FileStore struct {
+	path       string
+	passphrase func() (string, error)
+}
+
+// NewFileStore creates a store at dir/secrets.enc using LROK_SECRETS_PASSPHRASE
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{
+		path: filepath.Join(dir, "secrets.enc"),
+		passphrase: func() (string, error) {
+			if p := os.Getenv(PassphraseEnv); p != "" {
+				return p, nil
+			}
+			return "", fmt.Errorf("%s must be set to use the encrypted file backend", PassphraseEnv)
+		},
+	}
+}
+
+// NewFileStoreWithPassphrase creates a store at path with a fixed passphrase
+func NewFileStoreWithPassphrase(path, passphrase string) *FileStore {
+	return &FileStore{
+		path:       path,
+		passphrase: func() (string, error) { return passphrase, nil },
+	}
+}
+
+// Location returns the path of the encrypted file
+func (f *FileStore) Location() string {
+	return "encrypted file (" + f.path + ")"
+}
+
+// Get returns the key stored for a profile
+func (f *FileStore) Get(profile string) (string, error) {
+	entries, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := entries[profile]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set stores the key for a profile
+func (f *FileStore) Set(profile, secret string) error {
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+	entries[profile] = secret
+	return f.save(entries)
+}
+
+// Delete removes the key for a profile
+func (f *FileStore) Delete(profile string) error {
+	entries, err := f.load()
+	if err != nil {
+		return err
+	}
+	delete(entries, profile)
+	return f.save(entries)
+}
+
+func (f *FileStore) load() (map[string]string, error) {
+	entries := make(map[string]string)
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	var file fileFormat
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+
+	gcm, err := f.cipher(file.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets file (wrong passphrase?)")
+	}
+
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	return entries, nil
+}
+
+func (f *FileStore) save(entries map[string]string) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	file := fileFormat{
+		Version: 1,
+		Salt:    make([]byte, 16),
+	}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := f.cipher(file.Salt)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Data = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	if err := os.WriteFile(f.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return nil
+}
+
+// cipher derives the AES-256-GCM key for a salt
+func (f *FileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	passphrase, err := f.passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, pbkdf2Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
@@ -0,0 +1,159 @@
+// Package secrets stores API keys outside the plaintext config file
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Backend names accepted in config and by 'lrok login --store'
+const (
+	BackendPlaintext     = "plaintext"
+	BackendFile          = "file"
+	BackendSecretService = "secret-service"
+	BackendPass          = "pass"
+)
+
+// Backends lists the backends that can hold keys
+var Backends = []string{BackendPlaintext, BackendFile, BackendSecretService, BackendPass}
+
+// ErrNotFound is returned when a store has no key for a profile
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps one API key per profile
+type Store interface {
+	Get(profile string) (string, error)
+	Set(profile, secret string) error
+	Delete(profile string) error
+	// Location describes where keys live, for whoami
+	Location() string
+}
+
+// Open returns the store for a backend. dir is the lrok config directory.
+func Open(backend, dir string) (Store, error) {
+	switch backend {
+	case BackendFile:
+		return NewFileStore(dir), nil
+	case BackendSecretService:
+		return &secretServiceStore{}, nil
+	case BackendPass:
+		return &passStore{}, nil
+	case "", BackendPlaintext:
+		return nil, fmt.Errorf("the plaintext backend stores keys in config.toml")
+	default:
+		return nil, fmt.Errorf("unknown secret backend '%s', must be one of: %s", backend, strings.Join(Backends, ", "))
+	}
+}
+
+// ValidateBackend checks a backend name
+func ValidateBackend(backend string) error {
+	for _, b := range Backends {
+		if backend == b {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown secret backend '%s', must be one of: %s", backend, strings.Join(Backends, ", "))
+}
+
+// RunCommand runs an api_key_command through the shell and returns its
+// trimmed output, e.g. "op read op://dev/lrok/credential"
+func RunCommand(command string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("api_key_command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret := strings.TrimSpace(stdout.String())
+	if secret == "" {
+		return "", fmt.Errorf("api_key_command returned no output")
+	}
+	return secret, nil
+}
+
+// run executes a helper tool, feeding stdin when given
+func run(stdin string, name string, args ...string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%s not found in PATH: %w", name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// secretServiceStore uses the freedesktop Secret Service (GNOME Keyring,
+// KWallet) through libsecret's secret-tool
+type secretServiceStore struct{}
+
+func (s *secretServiceStore) Get(profile string) (string, error) {
+	out, err := run("", "secret-tool", "lookup", "service", "lrok", "profile", profile)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(out)
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+func (s *secretServiceStore) Set(profile, secret string) error {
+	_, err := run(secret, "secret-tool", "store", "--label=lrok API key ("+profile+")", "service", "lrok", "profile", profile)
+	return err
+}
+
+func (s *secretServiceStore) Delete(profile string) error {
+	_, err := run("", "secret-tool", "clear", "service", "lrok", "profile", profile)
+	return err
+}
+
+func (s *secretServiceStore) Location() string {
+	return "Secret Service keyring"
+}
+
+// passStore uses the standard unix password manager (gpg-encrypted files)
+type passStore struct{}
+
+func (s *passStore) entry(profile string) string {
+	return "lrok/" + profile
+}
+
+func (s *passStore) Get(profile string) (string, error) {
+	out, err := run("", "pass", "show", s.entry(profile))
+	if err != nil {
+		return "", err
+	}
+	// pass keeps the secret on the first line
+	secret := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+func (s *passStore) Set(profile, secret string) error {
+	_, err := run(secret+"\n", "pass", "insert", "--multiline", "--force", s.entry(profile))
+	return err
+}
+
+func (s *passStore) Delete(profile string) error {
+	_, err := run("", "pass", "rm", "--force", s.entry(profile))
+	return err
+}
+
+func (s *passStore) Location() string {
+	return "pass (lrok/<profile>)"
+}
@@ -0,0 +1,236 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scopeName is the instrumentation scope spans are reported under
+const scopeName = "github.com/lum-tools/lrok/internal/proxy"
+
+// grpcExportPath is the gRPC method collectors receive spans on
+const grpcExportPath = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+
+// otlpExporter sends spans to an OTLP collector over HTTP (JSON or
+// protobuf) or gRPC
+type otlpExporter struct {
+	endpoint    string
+	protocol    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+func newOTLPExporter(endpoint, protocol string, headers map[string]string, serviceName string) *otlpExporter {
+	if protocol == ProtocolGRPC {
+		endpoint = strings.TrimSuffix(strings.TrimRight(endpoint, "/"), "/v1/traces") + grpcExportPath
+	}
+	return &otlpExporter{
+		endpoint:    endpoint,
+		protocol:    protocol,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// OTLP/JSON payload types (see opentelemetry-proto trace/v1)
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func toValue(v interface{}) otlpValue {
+	switch val := v.(type) {
+	case string:
+		return otlpValue{StringValue: &val}
+	case int:
+		s := strconv.Itoa(val)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &val}
+	case bool:
+		return otlpValue{BoolValue: &val}
+	default:
+		s := fmt.Sprint(val)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func toKeyValues(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, otlpKeyValue{Key: k, Value: toValue(attrs[k])})
+	}
+	return result
+}
+
+func toOTLPSpan(s *Span) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           s.Context.TraceIDString(),
+		SpanID:            s.Context.SpanIDString(),
+		TraceState:        s.TraceState,
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		Attributes:        toKeyValues(s.Attributes),
+	}
+	if s.ParentSpanID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.ParentSpanID[:])
+	}
+	if s.Error {
+		span.Status = otlpStatus{Code: 2, Message: s.ErrorMessage}
+	}
+	return span
+}
+
+// export sends one batch of spans to the collector
+func (e *otlpExporter) export(ctx context.Context, spans []*Span) error {
+	body, contentType, err := e.encode(spans)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.protocol == ProtocolGRPC {
+		req.Header.Set("TE", "trailers")
+	}
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %d", resp.StatusCode)
+	}
+	if e.protocol == ProtocolGRPC {
+		// gRPC reports failures in trailers, or in headers for an
+		// immediate error
+		status := resp.Trailer.Get("Grpc-Status")
+		message := resp.Trailer.Get("Grpc-Message")
+		if status == "" {
+			status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+		}
+		if status != "0" {
+			return fmt.Errorf("collector returned gRPC status %s: %s", status, message)
+		}
+	}
+	return nil
+}
+
+// encode renders a batch in the exporter's protocol
+func (e *otlpExporter) encode(spans []*Span) ([]byte, string, error) {
+	switch e.protocol {
+	case ProtocolHTTPProtobuf:
+		return encodeProtobuf(e.serviceName, spans), "application/x-protobuf", nil
+	case ProtocolGRPC:
+		// Length-prefixed message, uncompressed
+		msg := encodeProtobuf(e.serviceName, spans)
+		frame := make([]byte, 5, 5+len(msg))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+		return append(frame, msg...), "application/grpc", nil
+	}
+
+	payload := otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: toKeyValues(map[string]interface{}{
+					"service.name": e.serviceName,
+				}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: scopeName},
+			}},
+		}},
+	}
+	for _, s := range spans {
+		scope := &payload.ResourceSpans[0].ScopeSpans[0]
+		scope.Spans = append(scope.Spans, toOTLPSpan(s))
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode spans: %w", err)
+	}
+	return body, "application/json", nil
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// pbWriter appends protobuf fields; enough of the encoding for OTLP spans
+type pbWriter []byte
+
+func (w *pbWriter) tag(field, wire int) {
+	*w = binary.AppendUvarint(*w, uint64(field)<<3|uint64(wire))
+}
+
+func (w *pbWriter) varint(field int, v uint64) {
+	w.tag(field, wireVarint)
+	*w = binary.AppendUvarint(*w, v)
+}
+
+func (w *pbWriter) fixed64(field int, v uint64) {
+	w.tag(field, wireFixed64)
+	*w = binary.LittleEndian.AppendUint64(*w, v)
+}
+
+func (w *pbWriter) bytes(field int, b []byte) {
+	w.tag(field, wireBytes)
+	*w = binary.AppendUvarint(*w, uint64(len(b)))
+	*w = append(*w, b...)
+}
+
+func (w *pbWriter) string(field int, s string) {
+	if s != "" {
+		w.bytes(field, []byte(s))
+	}
+}
+
+// message writes a nested message built by fill
+func (w *pbWriter) message(field int, fill func(*pbWriter)) {
+	var m pbWriter
+	fill(&m)
+	w.bytes(field, m)
+}
+
+// keyValues writes attributes as repeated KeyValue messages, sorted by key
+func (w *pbWriter) keyValues(field int, attrs map[string]interface{}) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		w.message(field, func(kv *pbWriter) {
+			kv.string(1, k)
+			kv.message(2, func(v *pbWriter) { v.anyValue(attrs[k]) })
+		})
+	}
+}
+
+// anyValue writes the fields of an AnyValue
+func (w *pbWriter) anyValue(value interface{}) {
+	switch v := value.(type) {
+	case string:
+		w.bytes(1, []byte(v))
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		w.varint(2, b)
+	case int:
+		w.varint(3, uint64(v))
+	case int64:
+		w.varint(3, uint64(v))
+	case float64:
+		w.fixed64(4, math.Float64bits(v))
+	default:
+		w.bytes(1, []byte(fmt.Sprint(v)))
+	}
+}
+
+// encodeProtobuf encodes spans as an OTLP ExportTraceServiceRequest
+func encodeProtobuf(serviceName string, spans []*Span) []byte {
+	var w pbWriter
+	w.message(1, func(rs *pbWriter) { // resource_spans
+		rs.message(1, func(r *pbWriter) { // resource
+			r.keyValues(1, map[string]interface{}{"service.name": serviceName})
+		})
+		rs.message(2, func(ss *pbWriter) { // scope_spans
+			ss.message(1, func(scope *pbWriter) { scope.string(1, scopeName) })
+			for _, s := range spans {
+				ss.message(2, func(span *pbWriter) { span.span(s) })
+			}
+		})
+	})
+	return w
+}
+
+// span writes the fields of a Span
+func (w *pbWriter) span(s *Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.bytes(1, s.Context.TraceID[:])
+	w.bytes(2, s.Context.SpanID[:])
+	w.string(3, s.TraceState)
+	if s.ParentSpanID != [8]byte{} {
+		w.bytes(4, s.ParentSpanID[:])
+	}
+	w.string(5, s.Name)
+	w.varint(6, uint64(s.Kind))
+	w.fixed64(7, uint64(s.StartTime.UnixNano()))
+	w.fixed64(8, uint64(s.EndTime.UnixNano()))
+	w.keyValues(9, s.Attributes)
+	if s.Error {
+		w.message(15, func(status *pbWriter) {
+			status.string(2, s.ErrorMessage)
+			status.varint(3, 2)
+		})
+	}
+}
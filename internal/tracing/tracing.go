@@ -0,0 +1,378 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TraceparentHeader is the W3C trace context header
+	TraceparentHeader = "Traceparent"
+	// TracestateHeader carries vendor-specific trace state
+	TracestateHeader = "Tracestate"
+
+	// OTLP protocols; gRPC needs an https:// collector, since HTTP/2
+	// without TLS is not available in the standard library
+	ProtocolHTTPJSON     = "http/json"
+	ProtocolHTTPProtobuf = "http/protobuf"
+	ProtocolGRPC         = "grpc"
+
+	defaultServiceName = "lrok"
+	batchSize          = 64
+	flushInterval      = 2 * time.Second
+)
+
+// SpanKind values follow the OTLP enum
+const (
+	SpanKindServer = 2
+	SpanKindClient = 3
+)
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// TraceIDString returns the trace ID as lowercase hex
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// SpanIDString returns the span ID as lowercase hex
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// IsValid reports whether both IDs are non-zero
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent renders the context as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceIDString(), sc.SpanIDString(), flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	// Version 00 must have exactly four fields; future versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != 8 {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Config configures span export
+type Config struct {
+	Endpoint    string            // Full OTLP traces URL, e.g. http://localhost:4318/v1/traces
+	Protocol    string            // http/json (default), http/protobuf or grpc
+	Headers     map[string]string // Extra headers sent to the collector
+	ServiceName string
+}
+
+// ConfigFromEnv reads the standard OTEL_* environment variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Protocol:    os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"),
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		Headers:     ParseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+	}
+
+	if cfg.Protocol == "" {
+		cfg.Protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		cfg.Endpoint = endpoint
+	} else if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		cfg.Endpoint = TracesURL(endpoint)
+	}
+
+	return cfg
+}
+
+// TracesURL appends the OTLP traces path to a collector base URL if missing
+func TracesURL(endpoint string) string {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+// ParseHeaders parses "key1=value1,key2=value2" into a map
+func ParseHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers
+}
+
+// Span is a single unit of work recorded by the tracer
+type Span struct {
+	Name         string
+	Kind         int
+	Context      SpanContext
+	ParentSpanID [8]byte
+	TraceState   string
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	Error        bool
+	ErrorMessage string
+
+	tracer      *Tracer
+	traceparent string // forwarded unchanged when the span is not exported
+	mu          sync.Mutex
+	ended       bool
+}
+
+// SetAttribute records a string, int, int64, float64 or bool attribute
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = true
+	s.ErrorMessage = message
+}
+
+// Inject writes the span's context into outgoing request headers
+func (s *Span) Inject(h http.Header) {
+	if s.traceparent != "" {
+		h.Set(TraceparentHeader, s.traceparent)
+	} else {
+		h.Set(TraceparentHeader, s.Context.Traceparent())
+	}
+	if s.TraceState != "" {
+		h.Set(TracestateHeader, s.TraceState)
+	}
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	if s.tracer != nil && s.Context.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// Tracer creates spans and exports them in batches to an OTLP collector.
+// Without an endpoint spans are still created and propagated, just not exported.
+type Tracer struct {
+	serviceName string
+	exporter    *otlpExporter
+	queue       chan *Span
+	done        chan struct{}
+	wg          sync.WaitGroup
+	closeOnce   sync.Once
+}
+
+// New creates a tracer for the given configuration. A configuration it
+// can't export with still yields a tracer that propagates trace context,
+// alongside the error.
+func New(cfg Config) (*Tracer, error) {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = defaultServiceName
+	}
+
+	t := &Tracer{
+		serviceName: cfg.ServiceName,
+	}
+
+	if cfg.Endpoint == "" {
+		return t, nil
+	}
+
+	switch cfg.Protocol {
+	case "":
+		cfg.Protocol = ProtocolHTTPJSON
+	case ProtocolHTTPJSON, ProtocolHTTPProtobuf:
+	case ProtocolGRPC:
+		if !strings.HasPrefix(cfg.Endpoint, "https://") {
+			return t, fmt.Errorf("OTLP over gRPC needs an https:// endpoint; use http/protobuf with the collector's HTTP port (usually 4318) instead")
+		}
+	default:
+		return t, fmt.Errorf("unsupported OTLP protocol %q, must be one of: %s, %s, %s", cfg.Protocol, ProtocolHTTPJSON, ProtocolHTTPProtobuf, ProtocolGRPC)
+	}
+
+	t.exporter = newOTLPExporter(cfg.Endpoint, cfg.Protocol, cfg.Headers, cfg.ServiceName)
+	t.queue = make(chan *Span, batchSize*4)
+	t.done = make(chan struct{})
+
+	t.wg.Add(1)
+	go t.run()
+
+	return t, nil
+}
+
+// Exporting reports whether spans are sent to a collector
+func (t *Tracer) Exporting() bool {
+	return t != nil && t.exporter != nil
+}
+
+// StartServerSpan starts a server span continuing the trace from incoming
+// headers. A span that is never exported can't be anyone's parent, so
+// without a collector the incoming context is passed on as it arrived.
+func (t *Tracer) StartServerSpan(name string, incoming http.Header) *Span {
+	span := &Span{
+		Name:       name,
+		Kind:       SpanKindServer,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+		tracer:     t,
+	}
+
+	parent, ok := ParseTraceparent(incoming.Get(TraceparentHeader))
+	switch {
+	case ok && !t.Exporting():
+		span.Context = parent
+		span.TraceState = incoming.Get(TracestateHeader)
+		span.traceparent = incoming.Get(TraceparentHeader)
+		return span
+	case ok:
+		span.Context.TraceID = parent.TraceID
+		span.Context.Sampled = parent.Sampled
+		span.ParentSpanID = parent.SpanID
+		span.TraceState = incoming.Get(TracestateHeader)
+	default:
+		rand.Read(span.Context.TraceID[:])
+		span.Context.Sampled = true
+	}
+	rand.Read(span.Context.SpanID[:])
+
+	return span
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	if t.exporter == nil {
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		// Drop spans rather than block requests when the collector is slow
+	}
+}
+
+// run batches queued spans and exports them periodically
+func (t *Tracer) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_ = t.exporter.export(ctx, batch) // Export failures must never affect the tunnel
+		cancel()
+		batch = make([]*Span, 0, batchSize)
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown flushes pending spans and stops the exporter
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil || t.exporter == nil {
+		return nil
+	}
+
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
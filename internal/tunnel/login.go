@@ -0,0 +1,111 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/names"
+)
+
+// LoginVerifier checks an API key by registering a throwaway HTTP tunnel:
+// the server authenticates the key when frpc starts the proxy, exactly as
+// it does for 'lrok <port>'. The tunnel is closed before it carries traffic.
+type LoginVerifier struct {
+	Server *config.Server
+
+	// Run starts frpc with a config and environment, writing its log to out
+	// until ctx is done. Replaced in tests.
+	Run func(ctx context.Context, configPath string, env []string, out io.Writer) error
+}
+
+// NewLoginVerifier returns a verifier that runs the embedded frpc
+func NewLoginVerifier(server *config.Server) *LoginVerifier {
+	return &LoginVerifier{Server: server, Run: runFrpc}
+}
+
+func runFrpc(ctx context.Context, configPath string, env []string, out io.Writer) error {
+	m := New(configPath)
+	m.SetEnv(env...)
+	m.SetOutput(out, out)
+	return m.Start(ctx)
+}
+
+// Verify returns config.ErrInvalidAPIKey if the server refuses the tunnel
+func (v *LoginVerifier) Verify(ctx context.Context, apiKey string) error {
+	cfg := &config.TunnelConfig{
+		APIKey:         apiKey,
+		LocalIP:        "127.0.0.1",
+		LocalPort:      80, // Never dialled: no request reaches the tunnel
+		Subdomain:      names.Generate(),
+		ProxyType:      "http",
+		SecretsFromEnv: true,
+	}
+	v.Server.Apply(cfg)
+
+	configPath, err := config.GenerateTOML(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to generate config: %w", err)
+	}
+	defer os.Remove(configPath)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	verdict := &verdictWriter{result: make(chan error, 1)}
+	done := make(chan error, 1)
+	go func() {
+		done <- v.Run(ctx, configPath, cfg.Env(), verdict)
+	}()
+
+	select {
+	case err := <-verdict.result:
+		return err
+	case err := <-done:
+		// frpc exits on its own after a failed login
+		select {
+		case err := <-verdict.result:
+			return err
+		default:
+		}
+		if err == nil {
+			err = fmt.Errorf("exited")
+		}
+		return fmt.Errorf("frpc stopped before the server answered: %w", err)
+	case <-ctx.Done():
+		return fmt.Errorf("no answer from the server: %w", ctx.Err())
+	}
+}
+
+// verdictWriter watches frpc's log for the server's answer to the proxy
+type verdictWriter struct {
+	once   sync.Once
+	result chan error
+}
+
+func (w *verdictWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(string(p), "\n") {
+		if settled, err := loginVerdict(line); settled {
+			w.once.Do(func() { w.result <- err })
+		}
+	}
+	return len(p), nil
+}
+
+// loginVerdict reports whether a frpc log line settles the check and how
+func loginVerdict(line string) (bool, error) {
+	switch {
+	case strings.Contains(line, "start proxy success"):
+		return true, nil
+	case strings.Contains(line, "start error: "):
+		_, reason, _ := strings.Cut(line, "start error: ")
+		return true, fmt.Errorf("%w: %s", config.ErrInvalidAPIKey, strings.TrimSpace(reason))
+	case strings.Contains(line, "login to the server failed"):
+		return true, fmt.Errorf("failed to log in to the server: %s", strings.TrimSpace(line))
+	}
+	return false, nil
+}
@@ -1,27 +1,146 @@
 package tunnel
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/lum-tools/lrok/internal/embed"
 )
 
+// Tunnel connection states reported by Manager.State
+const (
+	StateStarting     = "starting"
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateStopped      = "stopped"
+)
+
+// States lists every state a tunnel can report
+var States = []string{StateStarting, StateConnected, StateReconnecting, StateStopped}
+
 // Manager handles tunnel lifecycle
 type Manager struct {
 	configPath string
 	cmd        *exec.Cmd
+	state      string
+	starts     int64
+	logins     int64
+	stateMu    sync.RWMutex
+	stdout     io.Writer
+	stderr     io.Writer
+	shutdown   chan struct{}
+	once       sync.Once
+	env        []string
 }
 
 // New creates a new tunnel manager
 func New(configPath string) *Manager {
 	return &Manager{
 		configPath: configPath,
+		state:      StateStopped,
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		shutdown:   make(chan struct{}),
+	}
+}
+
+// RequestShutdown asks StartWithGracefulShutdown to stop the tunnel as if
+// Ctrl+C had been pressed
+func (m *Manager) RequestShutdown() {
+	m.once.Do(func() {
+		close(m.shutdown)
+	})
+}
+
+// SetOutput sets where frpc output and status messages are written
+func (m *Manager) SetOutput(stdout, stderr io.Writer) {
+	m.stdout = stdout
+	m.stderr = stderr
+}
+
+// SetEnv adds KEY=value entries to frpc's environment
+func (m *Manager) SetEnv(env ...string) {
+	m.env = append(m.env, env...)
+}
+
+// State returns the current connection state of frpc
+func (m *Manager) State() string {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+	return m.state
+}
+
+// WaitConnected blocks until frpc reports the proxy as started or ctx is done
+func (m *Manager) WaitConnected(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for m.State() != StateConnected {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Restarts returns how many times frpc had to re-establish its session,
+// either by being started again or by logging in to the server again
+func (m *Manager) Restarts() int64 {
+	m.stateMu.RLock()
+	defer m.stateMu.RUnlock()
+
+	restarts := int64(0)
+	if m.starts > 1 {
+		restarts += m.starts - 1
+	}
+	if m.logins > 1 {
+		restarts += m.logins - 1
+	}
+	return restarts
+}
+
+func (m *Manager) setState(state string) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+	m.state = state
+}
+
+// trackLine updates the connection state from a single frpc log line
+func (m *Manager) trackLine(line string) {
+	switch {
+	case strings.Contains(line, "login to server success"),
+		strings.Contains(line, "login to the server success"):
+		m.stateMu.Lock()
+		m.logins++
+		m.stateMu.Unlock()
+	case strings.Contains(line, "start proxy success"),
+		strings.Contains(line, "start visitor success"):
+		m.setState(StateConnected)
+	case strings.Contains(line, "try to reconnect"),
+		strings.Contains(line, "connect to server error"),
+		strings.Contains(line, "login to the server failed"),
+		strings.Contains(line, "work connection closed"):
+		m.setState(StateReconnecting)
+	}
+}
+
+// watchOutput copies frpc output to dst while tracking connection state
+func (m *Manager) watchOutput(src io.Reader, dst io.Writer) {
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		line := scanner.Text()
+		m.trackLine(line)
+		fmt.Fprintln(dst, line)
 	}
 }
 
@@ -33,6 +152,9 @@ func (m *Manager) Start(ctx context.Context) error {
 	}
 
 	m.cmd = exec.CommandContext(ctx, frpcPath, "-c", m.configPath)
+	if len(m.env) > 0 {
+		m.cmd.Env = append(os.Environ(), m.env...)
+	}
 	
 	// Stream stdout and stderr
 	stdout, err := m.cmd.StdoutPipe()
@@ -50,9 +172,24 @@ func (m *Manager) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to start frpc: %w", err)
 	}
 
-	// Stream output
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stderr, stderr)
+	m.stateMu.Lock()
+	m.starts++
+	m.state = StateStarting
+	m.stateMu.Unlock()
+	defer m.setState(StateStopped)
+
+	// Stream output (all reads must finish before Wait closes the pipes)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		m.watchOutput(stdout, m.stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		m.watchOutput(stderr, m.stderr)
+	}()
+	wg.Wait()
 
 	// Wait for completion
 	return m.cmd.Wait()
@@ -66,6 +203,7 @@ func (m *Manager) StartWithGracefulShutdown() error {
 	// Handle interrupt signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	// Start tunnel (only once!)
 	errChan := make(chan error, 1)
@@ -75,15 +213,17 @@ func (m *Manager) StartWithGracefulShutdown() error {
 
 	select {
 	case <-sigChan:
-		fmt.Println("\n\n🛑 Shutting down tunnel gracefully...")
-		cancel()
-		if m.cmd != nil && m.cmd.Process != nil {
-			m.cmd.Process.Signal(os.Interrupt)
-		}
-		return nil
+	case <-m.shutdown:
 	case err := <-errChan:
 		return err
 	}
+
+	fmt.Fprintln(m.stdout, "\n\n🛑 Shutting down tunnel gracefully...")
+	cancel()
+	if m.cmd != nil && m.cmd.Process != nil {
+		m.cmd.Process.Signal(os.Interrupt)
+	}
+	return nil
 }
 
 // Stop stops the tunnel
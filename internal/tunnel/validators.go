@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/lum-tools/lrok/internal/config"
 )
 
 // ReservedPorts contains commonly reserved ports that should be avoided
@@ -176,3 +178,79 @@ func ValidateTunnelName(name string) error {
 	
 	return nil
 }
+
+// ValidateDomain validates a custom domain name for HTTP tunnels
+func ValidateDomain(domain string) error {
+	if len(domain) > 253 {
+		return fmt.Errorf("domain must be no more than 253 characters long")
+	}
+	
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("domain '%s' must be a fully qualified name like app.example.com", domain)
+	}
+	
+	pattern := regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	for _, label := range labels {
+		if !pattern.MatchString(label) {
+			return fmt.Errorf("invalid domain '%s': use lowercase letters, numbers and hyphens", domain)
+		}
+	}
+	
+	return nil
+}
+
+// ValidateTransportProtocol validates the protocol frpc connects to the server with
+func ValidateTransportProtocol(protocol string) error {
+	switch protocol {
+	case "", config.TransportTCP, config.TransportWebSocket, config.TransportWSS, config.TransportQUIC, config.TransportKCP:
+		return nil
+	}
+	return fmt.Errorf("invalid transport '%s', must be one of: tcp, websocket, wss, quic, kcp", protocol)
+}
+
+// ValidatePoolCount validates how many connections frpc opens in advance
+func ValidatePoolCount(count int) error {
+	if count < 0 || count > 50 {
+		return fmt.Errorf("pool count must be between 0 and 50, got %d", count)
+	}
+	return nil
+}
+
+// ValidateHeartbeat validates heartbeat settings in seconds; an interval of
+// -1 disables heartbeats and 0 keeps frpc's default
+func ValidateHeartbeat(interval, timeout int) error {
+	if interval < -1 {
+		return fmt.Errorf("heartbeat interval must be -1 (disabled) or at least 0 seconds, got %d", interval)
+	}
+	if timeout < 0 {
+		return fmt.Errorf("heartbeat timeout must not be negative, got %d", timeout)
+	}
+	if interval > 0 && timeout > 0 && timeout <= interval {
+		return fmt.Errorf("heartbeat timeout (%ds) must be longer than the interval (%ds)", timeout, interval)
+	}
+	return nil
+}
+
+// ValidateTransport validates the transport settings and how they combine
+func ValidateTransport(t config.TransportConfig) error {
+	if err := ValidateTransportProtocol(t.Protocol); err != nil {
+		return err
+	}
+	if err := ValidatePoolCount(t.PoolCount); err != nil {
+		return err
+	}
+	if err := ValidateHeartbeat(t.HeartbeatInterval, t.HeartbeatTimeout); err != nil {
+		return err
+	}
+	if t.TCPMuxKeepalive < 0 {
+		return fmt.Errorf("TCP mux keepalive interval must not be negative, got %d", t.TCPMuxKeepalive)
+	}
+	if t.Protocol == config.TransportQUIC && (t.DisableTCPMux || t.TCPMuxKeepalive > 0) {
+		return fmt.Errorf("quic multiplexes streams itself, TCP mux settings do not apply")
+	}
+	if t.DisableTCPMux && t.TCPMuxKeepalive > 0 {
+		return fmt.Errorf("TCP mux keepalive interval needs TCP mux enabled")
+	}
+	return nil
+}
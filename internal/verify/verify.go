@@ -0,0 +1,141 @@
+// Package verify checks that requests to a public tunnel URL reach the lrok
+// inspector proxy, independently of what status the app answers with.
+package verify
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+)
+
+// Result is the outcome of one verification request
+type Result struct {
+	URL          string        `json:"url"`
+	Reached      bool          `json:"reached"` // the lrok proxy echoed our nonce
+	Status       int           `json:"status,omitempty"`
+	Latency      time.Duration `json:"latency"`                 // total round trip
+	UpstreamTime time.Duration `json:"upstream_time,omitempty"` // time the local app took
+	EdgeLatency  time.Duration `json:"edge_latency,omitempty"`  // latency minus app time
+	LrokError    string        `json:"lrok_error,omitempty"`    // X-Lrok-Error set by the proxy
+	Error        string        `json:"error,omitempty"`
+	Diagnosis    string        `json:"diagnosis"`
+}
+
+// OK reports whether the request made it through the tunnel to lrok
+func (r Result) OK() bool {
+	return r.Reached
+}
+
+// NewNonce returns a random verification nonce
+func NewNonce() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Check sends one GET carrying a nonce to rawURL and diagnoses the answer
+func Check(ctx context.Context, client *http.Client, rawURL string) Result {
+	result := Result{URL: rawURL}
+	nonce := NewNonce()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		result.Error = err.Error()
+		result.Diagnosis = "invalid URL"
+		return result
+	}
+	req.Header.Set(proxy.VerifyHeader, nonce)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Latency = time.Since(start)
+		result.Error = err.Error()
+		result.Diagnosis = diagnoseError(req.URL, err)
+		return result
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	result.Latency = time.Since(start)
+	result.Status = resp.StatusCode
+
+	result.Reached = resp.Header.Get(proxy.VerifyHeader) == nonce
+	result.LrokError = resp.Header.Get("X-Lrok-Error")
+	if d, err := time.ParseDuration(resp.Header.Get(proxy.UpstreamTimeHeader)); err == nil {
+		result.UpstreamTime = d
+		result.EdgeLatency = result.Latency - d
+	}
+	result.Diagnosis = diagnoseResponse(result)
+	return result
+}
+
+// Wait repeats Check until the request reaches lrok or ctx is done, returning
+// the last result
+func Wait(ctx context.Context, client *http.Client, rawURL string, interval time.Duration) Result {
+	for {
+		result := Check(ctx, client, rawURL)
+		if result.OK() {
+			return result
+		}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(interval):
+		}
+	}
+}
+
+func diagnoseResponse(r Result) string {
+	status := fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+	if !r.Reached {
+		switch {
+		case r.Status == http.StatusNotFound:
+			return fmt.Sprintf("the server answered %s without reaching lrok: no tunnel is registered for this host (not started, still connecting, or a different name)", status)
+		case r.Status == http.StatusBadGateway || r.Status == http.StatusServiceUnavailable || r.Status == http.StatusGatewayTimeout:
+			return fmt.Sprintf("the server answered %s without reaching lrok: the tunnel is registered but its client could not be reached", status)
+		}
+		return fmt.Sprintf("got %s, but not from an lrok tunnel (no nonce echoed); is this URL served by lrok?", status)
+	}
+
+	switch r.LrokError {
+	case "":
+	case "no_route":
+		return fmt.Sprintf("reached lrok, but no --route matches this path (%s)", status)
+	case "upstream_unavailable":
+		return fmt.Sprintf("reached lrok, but the local app is not running (%s)", status)
+	default:
+		return fmt.Sprintf("reached lrok, but the local app failed: %s (%s)", r.LrokError, status)
+	}
+	if r.UpstreamTime == 0 {
+		return "reached lrok (answered by the proxy itself)"
+	}
+	return fmt.Sprintf("reached lrok, app answered %s", status)
+}
+
+func diagnoseError(u *url.URL, err error) string {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Sprintf("DNS lookup of %s failed: the name is not registered yet, or DNS has not propagated", u.Hostname())
+	case errors.As(err, &certErr):
+		return fmt.Sprintf("TLS certificate for %s is not valid: %v", u.Hostname(), certErr.Err)
+	case errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "Client.Timeout"):
+		return "timed out waiting for an answer"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return fmt.Sprintf("could not connect to %s: the tunnel server is unreachable", u.Host)
+	}
+	return "request failed"
+}
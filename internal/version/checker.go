@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -73,9 +74,30 @@ func CheckForUpdate(currentVersion string) (bool, string, InstallMethod, error)
 	return hasUpdate, latestVersion, method, nil
 }
 
+var (
+	egressProxy    *url.URL
+	egressProxySet bool
+)
+
+// SetProxy routes version checks through the same egress proxy as tunnels;
+// nil connects directly. Until it is called, HTTPS_PROXY applies.
+func SetProxy(u *url.URL) {
+	egressProxy, egressProxySet = u, true
+}
+
+// HTTPClient returns the client used for version checks. Go can't speak
+// NTLM, so an ntlm:// proxy falls back to the environment's settings.
+func HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if egressProxySet && (egressProxy == nil || egressProxy.Scheme != "ntlm") {
+		transport.Proxy = http.ProxyURL(egressProxy)
+	}
+	return &http.Client{Timeout: 3 * time.Second, Transport: transport}
+}
+
 // fetchLatestVersion fetches the latest version from GitHub API
 func fetchLatestVersion() (string, error) {
-	client := &http.Client{Timeout: 3 * time.Second}
+	client := HTTPClient()
 	
 	resp, err := client.Get(githubAPI)
 	if err != nil {
@@ -188,16 +210,16 @@ func saveCache(path string, cache VersionCache) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-// ShowUpdateWarning displays a formatted update warning
-func ShowUpdateWarning(currentVersion, latestVersion string, method InstallMethod) {
+// ShowUpdateWarning writes a formatted update warning to w
+func ShowUpdateWarning(w io.Writer, currentVersion, latestVersion string, method InstallMethod) {
 	updateCmd := GetUpdateCommand(method)
 	
-	fmt.Println()
-	fmt.Println("╭─────────────────────────────────────────────────────────────╮")
-	fmt.Printf("│ ⚠️  Update available: %s → %s%-20s│\n", currentVersion, latestVersion, "")
-	fmt.Println("│                                                             │")
-	fmt.Printf("│ Run: %-54s │\n", updateCmd)
-	fmt.Println("╰─────────────────────────────────────────────────────────────╯")
-	fmt.Println()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "╭─────────────────────────────────────────────────────────────╮")
+	fmt.Fprintf(w, "│ ⚠️  Update available: %s → %s%-20s│\n", currentVersion, latestVersion, "")
+	fmt.Fprintln(w, "│                                                             │")
+	fmt.Fprintf(w, "│ Run: %-54s │\n", updateCmd)
+	fmt.Fprintln(w, "╰─────────────────────────────────────────────────────────────╯")
+	fmt.Fprintln(w)
 }
 
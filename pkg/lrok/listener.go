@@ -0,0 +1,81 @@
+package lrok
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Listener is a tunnel that can be served directly:
+//
+//	ln, err := lrok.ListenHTTP(ctx, lrok.WithName("hooks"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	fmt.Println("serving on", ln.URL())
+//	http.Serve(ln, handler)
+//
+// Connections arrive on a loopback listener on an ephemeral port, so the
+// program never has to pick a port. Accept fails once the tunnel stops.
+type Listener struct {
+	*Tunnel
+	loopback  net.Listener
+	closeOnce sync.Once
+}
+
+var _ net.Listener = (*Listener)(nil)
+
+// ListenHTTP starts an HTTP tunnel whose traffic is accepted from the returned listener
+func ListenHTTP(ctx context.Context, opts ...Option) (*Listener, error) {
+	return listen(ctx, HTTP, opts...)
+}
+
+// ListenTCP starts a TCP tunnel on remotePort whose connections are accepted
+// from the returned listener
+func ListenTCP(ctx context.Context, remotePort int, opts ...Option) (*Listener, error) {
+	return listen(ctx, func(port int) Target { return TCP(port, remotePort) }, opts...)
+}
+
+func listen(ctx context.Context, target func(port int) Target, opts ...Option) (*Listener, error) {
+	loopback, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	port := loopback.Addr().(*net.TCPAddr).Port
+	tun, err := Listen(ctx, target(port), append(opts, WithLocalIP("127.0.0.1"))...)
+	if err != nil {
+		loopback.Close()
+		return nil, err
+	}
+
+	l := &Listener{Tunnel: tun, loopback: loopback}
+
+	// Unblock Accept when the tunnel stops on its own
+	go func() {
+		<-tun.Done()
+		loopback.Close()
+	}()
+
+	return l, nil
+}
+
+// Accept waits for the next connection through the tunnel
+func (l *Listener) Accept() (net.Conn, error) {
+	return l.loopback.Accept()
+}
+
+// Addr returns the local loopback address connections arrive on
+func (l *Listener) Addr() net.Addr {
+	return l.loopback.Addr()
+}
+
+// Close stops accepting connections and closes the tunnel
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		err = l.loopback.Close()
+		l.Tunnel.Close()
+	})
+	return err
+}
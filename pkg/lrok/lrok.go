@@ -0,0 +1,487 @@
+// Package lrok starts lum.tools tunnels from Go programs and tests.
+//
+//	tun, err := lrok.Listen(ctx, lrok.HTTP(8000), lrok.WithName("my-webhooks"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer tun.Close()
+//
+//	fmt.Println("public URL:", tun.URL())
+//	for req := range tun.Requests() {
+//		fmt.Println(req.Method, req.Path, req.StatusCode)
+//	}
+package lrok
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/names"
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/lum-tools/lrok/internal/tunnel"
+)
+
+// Request is an HTTP request captured by the tunnel's inspector
+type Request = proxy.Request
+
+// Stats are a tunnel's wire-level traffic counters
+type Stats = relay.Stats
+
+// ErrNoAPIKey is returned when no API key was given or configured
+var ErrNoAPIKey = errors.New("lrok: no API key (use WithAPIKey, set LUM_API_KEY or run 'lrok login')")
+
+// Target is the local service a tunnel forwards to
+type Target struct {
+	proxyType  string
+	port       int
+	remotePort int
+	secretKey  string
+}
+
+// HTTP exposes a local HTTP service at https://<name>.<server domain>
+func HTTP(port int) Target {
+	return Target{proxyType: "http", port: port}
+}
+
+// TCP exposes a local TCP service on remotePort of the lum.tools server
+func TCP(port, remotePort int) Target {
+	return Target{proxyType: "tcp", port: port, remotePort: remotePort}
+}
+
+// STCP exposes a local service to visitors that know secretKey
+func STCP(port int, secretKey string) Target {
+	return Target{proxyType: "stcp", port: port, secretKey: secretKey}
+}
+
+// XTCP exposes a local service peer-to-peer to visitors that know secretKey
+func XTCP(port int, secretKey string) Target {
+	return Target{proxyType: "xtcp", port: port, secretKey: secretKey}
+}
+
+// options mirrors config.TunnelConfig plus SDK-only settings
+type options struct {
+	name            string
+	apiKey          string
+	localIP         string
+	server          config.ServerOptions
+	domains         []string
+	bandwidthLimit  string
+	useEncryption   bool
+	useCompression  bool
+	healthCheckType string
+	maxRequests     int
+	readyTimeout    time.Duration
+	logOutput       io.Writer
+	limits          relay.Limits
+}
+
+// Option configures a tunnel
+type Option func(*options)
+
+// WithName sets the tunnel name (a random readable name is used otherwise)
+func WithName(name string) Option {
+	return func(o *options) { o.name = name }
+}
+
+// WithAPIKey sets the lum.tools API key (defaults to LUM_API_KEY or the config file)
+func WithAPIKey(key string) Option {
+	return func(o *options) { o.apiKey = key }
+}
+
+// WithLocalIP sets the address of the local service (default 127.0.0.1)
+func WithLocalIP(ip string) Option {
+	return func(o *options) { o.localIP = ip }
+}
+
+// WithServer overrides the tunnel server address and port
+func WithServer(addr string, port int) Option {
+	return func(o *options) {
+		o.server.Server = net.JoinHostPort(addr, strconv.Itoa(port))
+	}
+}
+
+// WithRegion selects a server region, or "auto" for the closest
+func WithRegion(region string) Option {
+	return func(o *options) { o.server.Region = region }
+}
+
+// WithDomain serves an HTTP tunnel on verified custom domains ('lrok domains');
+// the first becomes the tunnel URL
+func WithDomain(domains ...string) Option {
+	return func(o *options) { o.domains = append(o.domains, domains...) }
+}
+
+// WithSubdomainHost sets the public domain of HTTP tunnels on a custom server
+func WithSubdomainHost(domain string) Option {
+	return func(o *options) { o.server.SubdomainHost = domain }
+}
+
+// WithEgressProxy connects to the tunnel server through an http://, socks5://
+// or ntlm:// proxy ("none" ignores HTTPS_PROXY and ALL_PROXY)
+func WithEgressProxy(proxyURL string) Option {
+	return func(o *options) { o.server.EgressProxy = proxyURL }
+}
+
+// WithTransport selects how frpc reaches the server: "tcp" (default),
+// "websocket", "wss", "quic" or "kcp"
+func WithTransport(protocol string) Option {
+	return func(o *options) { o.server.Transport.Protocol = protocol }
+}
+
+// WithMaxBytes stops the tunnel after n bytes of traffic in both directions
+func WithMaxBytes(n int64) Option {
+	return func(o *options) { o.limits.MaxBytes = n }
+}
+
+// WithMaxConns refuses connections beyond n open at once
+func WithMaxConns(n int) Option {
+	return func(o *options) { o.limits.MaxConns = n }
+}
+
+// WithExpireAfter stops the tunnel after d
+func WithExpireAfter(d time.Duration) Option {
+	return func(o *options) { o.limits.ExpireAfter = d }
+}
+
+// WithBandwidthLimit limits tunnel bandwidth, e.g. "1MB" or "500KB"
+func WithBandwidthLimit(limit string) Option {
+	return func(o *options) { o.bandwidthLimit = limit }
+}
+
+// WithEncryption encrypts traffic between frpc and the server
+func WithEncryption() Option {
+	return func(o *options) { o.useEncryption = true }
+}
+
+// WithCompression compresses traffic between frpc and the server
+func WithCompression() Option {
+	return func(o *options) { o.useCompression = true }
+}
+
+// WithHealthCheck enables server-side health checks ("tcp" or "http")
+func WithHealthCheck(checkType string) Option {
+	return func(o *options) { o.healthCheckType = checkType }
+}
+
+// WithMaxRequests sets how many captured requests are kept (default 100)
+func WithMaxRequests(n int) Option {
+	return func(o *options) { o.maxRequests = n }
+}
+
+// WithReadyTimeout bounds how long Listen waits for the tunnel (default 30s)
+func WithReadyTimeout(d time.Duration) Option {
+	return func(o *options) { o.readyTimeout = d }
+}
+
+// WithLogOutput receives frpc's log output (discarded by default)
+func WithLogOutput(w io.Writer) Option {
+	return func(o *options) { o.logOutput = w }
+}
+
+// Tunnel is a running tunnel
+type Tunnel struct {
+	name     string
+	url      string
+	target   Target
+	proxy    *proxy.Proxy
+	relay    *relay.Relay
+	manager  *tunnel.Manager
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+	requests chan *Request
+	closeMu  sync.Once
+}
+
+// Listen starts a tunnel and returns once it is connected to the server.
+// Cancelling ctx closes the tunnel.
+func Listen(ctx context.Context, target Target, opts ...Option) (*Tunnel, error) {
+	o := &options{
+		localIP:      "127.0.0.1",
+		maxRequests:  100,
+		readyTimeout: 30 * time.Second,
+		logOutput:    io.Discard,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if err := validate(target, o); err != nil {
+		return nil, err
+	}
+
+	server, err := config.ResolveServer(ctx, o.server)
+	if err != nil {
+		return nil, fmt.Errorf("lrok: %w", err)
+	}
+	if err := tunnel.ValidateTransport(server.Transport); err != nil {
+		return nil, fmt.Errorf("lrok: %w", err)
+	}
+	if err := config.CheckDomains(server, o.domains); err != nil {
+		return nil, fmt.Errorf("lrok: %w", err)
+	}
+
+	// Self-hosted servers authenticate with their own token or OIDC
+	apiKey := o.apiKey
+	if !server.SelfHosted {
+		if apiKey, err = resolveAPIKey(o.apiKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.name == "" {
+		o.name = names.Generate()
+	}
+
+	cfg := &config.TunnelConfig{
+		APIKey:          apiKey,
+		LocalPort:       target.port,
+		LocalIP:         o.localIP,
+		Subdomain:       o.name,
+		ProxyType:       target.proxyType,
+		RemotePort:      target.remotePort,
+		SecretKey:       target.secretKey,
+		BandwidthLimit:  o.bandwidthLimit,
+		UseEncryption:   o.useEncryption,
+		UseCompression:  o.useCompression,
+		HealthCheckType: o.healthCheckType,
+		CustomDomains:   o.domains,
+	}
+	server.Apply(cfg)
+
+	t := &Tunnel{
+		name:   o.name,
+		target: target,
+		done:   make(chan struct{}),
+	}
+
+	switch target.proxyType {
+	case "http":
+		t.url = server.HTTPURL(o.name)
+		if len(o.domains) > 0 {
+			t.url = server.CustomURL(o.domains[0])
+		}
+
+		// frpc forwards to the inspector proxy, which forwards to the app
+		t.proxy = proxy.New(target.port, o.maxRequests)
+		proxyPort, err := t.proxy.Start()
+		if err != nil {
+			return nil, fmt.Errorf("lrok: failed to start proxy: %w", err)
+		}
+		cfg.LocalPort = proxyPort
+		cfg.LocalIP = "127.0.0.1"
+		t.requests = t.proxy.Subscribe()
+	case "tcp":
+		t.url = "tcp://" + server.TCPAddress(target.remotePort)
+	}
+
+	// frpc forwards to the relay, which counts traffic and enforces limits
+	t.relay = relay.New(fmt.Sprintf("%s:%d", cfg.LocalIP, cfg.LocalPort), o.limits)
+	relayPort, err := t.relay.Start()
+	if err != nil {
+		t.stopProxy()
+		return nil, fmt.Errorf("lrok: %w", err)
+	}
+	cfg.LocalPort = relayPort
+	cfg.LocalIP = "127.0.0.1"
+
+	cfg.SecretsFromEnv = true
+	configPath, err := config.GenerateTOML(cfg)
+	if err != nil {
+		t.stopProxy()
+		return nil, fmt.Errorf("lrok: failed to generate config: %w", err)
+	}
+
+	t.manager = tunnel.New(configPath)
+	t.manager.SetEnv(cfg.Env()...)
+	t.manager.SetOutput(o.logOutput, o.logOutput)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	t.cancel = cancel
+
+	go func() {
+		select {
+		case <-runCtx.Done():
+		case <-t.relay.Done():
+			cancel()
+		}
+	}()
+
+	go func() {
+		defer close(t.done)
+		err := t.manager.Start(runCtx)
+		if runCtx.Err() == nil {
+			if err == nil {
+				err = errors.New("frpc exited")
+			}
+			t.err = err
+		}
+		if err := t.relay.Err(); err != nil {
+			t.err = fmt.Errorf("lrok: %w", err)
+		}
+		t.manager.Cleanup()
+		t.stopProxy()
+	}()
+
+	if err := t.waitReady(ctx, o.readyTimeout); err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// waitReady blocks until frpc reports the proxy as started
+func (t *Tunnel) waitReady(ctx context.Context, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("lrok: tunnel not ready after %v", timeout)
+		case <-t.done:
+			return fmt.Errorf("lrok: tunnel failed to start: %w", t.err)
+		case <-ticker.C:
+			if t.manager.State() == tunnel.StateConnected {
+				return nil
+			}
+		}
+	}
+}
+
+func validate(target Target, o *options) error {
+	if err := tunnel.ValidateProxyType(target.proxyType); err != nil {
+		return fmt.Errorf("lrok: %w", err)
+	}
+	if target.port < 1 || target.port > 65535 {
+		return fmt.Errorf("lrok: invalid local port %d", target.port)
+	}
+	if o.name != "" {
+		if err := tunnel.ValidateTunnelName(o.name); err != nil {
+			return fmt.Errorf("lrok: %w", err)
+		}
+	}
+	if target.proxyType == "tcp" {
+		if err := tunnel.ValidatePort(target.remotePort); err != nil {
+			return fmt.Errorf("lrok: invalid remote port: %w", err)
+		}
+	}
+	if target.proxyType == "stcp" || target.proxyType == "xtcp" {
+		if err := tunnel.ValidateSecretKey(target.secretKey); err != nil {
+			return fmt.Errorf("lrok: %w", err)
+		}
+	}
+	if err := tunnel.ValidateBandwidthLimit(o.bandwidthLimit); err != nil {
+		return fmt.Errorf("lrok: %w", err)
+	}
+	if err := tunnel.ValidateHealthCheckType(o.healthCheckType); err != nil {
+		return fmt.Errorf("lrok: %w", err)
+	}
+	if o.limits.MaxBytes < 0 || o.limits.MaxConns < 0 || o.limits.ExpireAfter < 0 {
+		return fmt.Errorf("lrok: limits must not be negative")
+	}
+	for _, domain := range o.domains {
+		if target.proxyType != "http" {
+			return fmt.Errorf("lrok: custom domains require an HTTP target")
+		}
+		if err := tunnel.ValidateDomain(domain); err != nil {
+			return fmt.Errorf("lrok: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveAPIKey applies option > LUM_API_KEY > FRP_API_KEY > config profile
+func resolveAPIKey(key string) (string, error) {
+	cred, err := config.ResolveAPIKey(key)
+	if errors.Is(err, config.ErrNoAPIKey) {
+		return "", ErrNoAPIKey
+	}
+	if err != nil {
+		return "", fmt.Errorf("lrok: %w", err)
+	}
+	return cred.APIKey, nil
+}
+
+// Name returns the tunnel name
+func (t *Tunnel) Name() string {
+	return t.name
+}
+
+// URL returns the public URL (https://... for HTTP, tcp://host:port for TCP,
+// empty for STCP/XTCP which are reached through a visitor)
+func (t *Tunnel) URL() string {
+	return t.url
+}
+
+// Requests streams requests captured by the inspector (HTTP tunnels only;
+// nil otherwise). The channel is closed when the tunnel closes. Slow
+// readers miss requests rather than blocking traffic.
+func (t *Tunnel) Requests() <-chan *Request {
+	return t.requests
+}
+
+// CapturedRequests returns the most recent captured requests
+func (t *Tunnel) CapturedRequests() []*Request {
+	if t.proxy == nil {
+		return nil
+	}
+	return t.proxy.GetRequests()
+}
+
+// Stats returns the tunnel's traffic counters
+func (t *Tunnel) Stats() Stats {
+	return t.relay.Stats()
+}
+
+// Done is closed when the tunnel has stopped
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns why the tunnel stopped unexpectedly, or nil
+func (t *Tunnel) Err() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Close stops the tunnel and waits for frpc to exit
+func (t *Tunnel) Close() error {
+	t.closeMu.Do(func() {
+		if t.cancel != nil {
+			t.cancel()
+		}
+	})
+	<-t.done
+	return nil
+}
+
+func (t *Tunnel) stopProxy() {
+	if t.relay != nil {
+		t.relay.Close()
+	}
+	if t.proxy == nil {
+		return
+	}
+	if t.requests != nil {
+		t.proxy.Unsubscribe(t.requests)
+	}
+	t.proxy.Stop()
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startBalancedProxy(t *testing.T, opts proxy.LBOptions, ports ...int) (*proxy.Proxy, int) {
+	upstreams := make([]string, len(ports))
+	for i, port := range ports {
+		upstreams[i] = strconv.Itoa(port)
+	}
+	routes, err := proxy.ParseRoutes([]string{"/=" + strings.Join(upstreams, ",")}, 0)
+	require.NoError(t, err)
+
+	prox := proxy.NewWithRoutes(routes, 100)
+	prox.SetLoadBalancing(opts)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { prox.Stop() })
+	return prox, proxyPort
+}
+
+func getBody(t *testing.T, port int, path string) string {
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, path))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestValidateLBStrategy(t *testing.T) {
+	assert.NoError(t, proxy.ValidateLBStrategy(""))
+	assert.NoError(t, proxy.ValidateLBStrategy(proxy.LBRoundRobin))
+	assert.NoError(t, proxy.ValidateLBStrategy(proxy.LBLeastConn))
+	assert.Error(t, proxy.ValidateLBStrategy("random"))
+}
+
+func TestRoundRobin(t *testing.T) {
+	a := startNamedApp(t, "a")
+	b := startNamedApp(t, "b")
+	prox, port := startBalancedProxy(t, proxy.LBOptions{}, a, b)
+
+	seen := map[string]int{}
+	for i := 0; i < 10; i++ {
+		name, _, _ := strings.Cut(getBody(t, port, "/"), " ")
+		seen[name]++
+	}
+	assert.Equal(t, 5, seen["a"])
+	assert.Equal(t, 5, seen["b"])
+
+	stats := prox.UpstreamStats()
+	require.Len(t, stats, 2)
+	for _, s := range stats {
+		assert.True(t, s.Healthy)
+		assert.Equal(t, int64(5), s.Requests)
+		assert.Equal(t, int64(0), s.Active)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	a := startNamedApp(t, "a")
+
+	// A port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	down := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	prox, port := startBalancedProxy(t, proxy.LBOptions{Interval: 50 * time.Millisecond}, down, a)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "a /", getBody(t, port, "/"))
+	}
+
+	require.Eventually(t, func() bool {
+		for _, s := range prox.UpstreamStats() {
+			if s.URL == fmt.Sprintf("http://127.0.0.1:%d", down) {
+				return !s.Healthy && s.LastError != ""
+			}
+		}
+		return false
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestHealthPathMarksUnhealthy(t *testing.T) {
+	a := startNamedApp(t, "a")
+	sick := startStatusApp(t, http.StatusServiceUnavailable)
+	prox, port := startBalancedProxy(t, proxy.LBOptions{HealthPath: "/healthz", Interval: 50 * time.Millisecond}, a, sick)
+
+	require.Eventually(t, func() bool {
+		stats := prox.UpstreamStats()
+		return stats[0].Healthy && !stats[1].Healthy
+	}, 2*time.Second, 20*time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "a /", getBody(t, port, "/"))
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	release := make(chan struct{})
+	slow := startHandlerApp(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "slow")
+	})
+	fast := startNamedApp(t, "fast")
+	prox, port := startBalancedProxy(t, proxy.LBOptions{Strategy: proxy.LBLeastConn}, slow, fast)
+
+	// Hold one request open on the first upstream
+	done := make(chan string)
+	go func() { done <- getBody(t, port, "/") }()
+	require.Eventually(t, func() bool {
+		return prox.UpstreamStats()[0].Active == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "fast /", getBody(t, port, "/"))
+	}
+	close(release)
+	assert.Equal(t, "slow", <-done)
+}
+
+func startStatusApp(t *testing.T, status int) int {
+	return startHandlerApp(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+}
+
+func startHandlerApp(t *testing.T, handler http.HandlerFunc) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+	return l.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/control"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlSocket(t *testing.T) {
+	// Keep the socket path short; unix socket paths are limited to ~100 bytes
+	runDir, err := os.MkdirTemp("", "lrok-run")
+	require.NoError(t, err)
+	defer os.RemoveAll(runDir)
+
+	logs := control.NewLogBuffer(10)
+	fmt.Fprintln(logs, "🚀 Starting lrok tunnel...")
+	fmt.Fprint(logs, "✅ Tunnel is ready")
+	fmt.Fprint(logs, "\n")
+
+	stopped := make(chan struct{})
+	srv := control.NewServer(runDir, control.Info{
+		Name:  "happy-dolphin",
+		Type:  "http",
+		URL:   "https://happy-dolphin.t.lum.tools",
+		Local: "127.0.0.1:8000",
+	}, func() control.Status {
+		return control.Status{State: "connected", BytesIn: 10, BytesOut: 20, Connections: 3}
+	}, func() { close(stopped) }, logs)
+	require.NoError(t, srv.Start())
+	defer srv.Stop()
+
+	// A second instance with the same name is refused
+	dup := control.NewServer(runDir, control.Info{Name: "happy-dolphin"}, nil, nil, nil)
+	assert.Error(t, dup.Start())
+
+	// Stale registrations are cleaned up by List
+	stale := filepath.Join(runDir, "gone-tunnel.json")
+	require.NoError(t, os.WriteFile(stale, []byte(`{"name":"gone-tunnel"}`), 0600))
+
+	tunnels, err := control.List(runDir)
+	require.NoError(t, err)
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, "happy-dolphin", tunnels[0].Name)
+	assert.Equal(t, "connected", tunnels[0].State)
+	assert.Equal(t, int64(20), tunnels[0].BytesOut)
+	assert.Equal(t, os.Getpid(), tunnels[0].PID)
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err))
+
+	client, err := control.Find(runDir, "happy-dolphin")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, client.Logs(context.Background(), &buf, false))
+	assert.Equal(t, "🚀 Starting lrok tunnel...\n✅ Tunnel is ready\n", buf.String())
+
+	require.NoError(t, client.Stop())
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stop callback was not invoked")
+	}
+
+	_, err = control.Find(runDir, "unknown")
+	assert.Error(t, err)
+}
+
+func TestControlRejectsPathNames(t *testing.T) {
+	runDir, err := os.MkdirTemp("", "lrok-run")
+	require.NoError(t, err)
+	defer os.RemoveAll(runDir)
+
+	outside := filepath.Base(runDir) + "-escaped"
+	for _, name := range []string{"../" + outside, "a/b", "..", ""} {
+		srv := control.NewServer(runDir, control.Info{Name: name}, nil, nil, nil)
+		assert.Error(t, srv.Start(), name)
+
+		_, err := control.Find(runDir, name)
+		assert.Error(t, err, name)
+	}
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(runDir), outside+".sock"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/decode"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pgMessage frames a typed Postgres message
+func pgMessage(typ byte, body string) []byte {
+	msg := []byte{typ, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(msg[1:], uint32(4+len(body)))
+	return append(msg, body...)
+}
+
+// pgUntyped frames a startup-phase message with a request code
+func pgUntyped(code uint32, body string) []byte {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint32(msg, uint32(8+len(body)))
+	binary.BigEndian.PutUint32(msg[4:], code)
+	return append(msg, body...)
+}
+
+// mysqlPacket frames a MySQL packet
+func mysqlPacket(seq byte, payload []byte) []byte {
+	n := len(payload)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+}
+
+// feedSlowly feeds data a few bytes at a time, as a slow network would
+func feedSlowly(s *decode.Stream, client bool, data []byte) {
+	for len(data) > 0 {
+		n := min(3, len(data))
+		s.Feed(client, data[:n])
+		data = data[n:]
+	}
+}
+
+// eventTexts lists events as "kind: text"
+func eventTexts(s *decode.Stream) []string {
+	var texts []string
+	for _, e := range s.Events() {
+		texts = append(texts, e.Kind+": "+e.Text)
+	}
+	return texts
+}
+
+// clientHelloBytes captures the ClientHello crypto/tls sends
+func clientHelloBytes(t *testing.T, serverName string, alpn ...string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go tls.Client(client, &tls.Config{ServerName: serverName, NextProtos: alpn}).Handshake()
+	defer client.Close()
+
+	buf := make([]byte, 64*1024)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func TestDecodePostgres(t *testing.T) {
+	s := decode.NewStream(decode.Auto)
+
+	feedSlowly(s, true, pgUntyped(196608, "user\x00alice\x00database\x00shop\x00\x00"))
+	auth := make([]byte, 4)
+	feedSlowly(s, false, append(pgMessage('R', string(auth)), pgMessage('S', "server_version\x0016.2\x00")...))
+	feedSlowly(s, true, pgMessage('Q', "SELECT *\n  FROM orders\x00"))
+	feedSlowly(s, false, pgMessage('C', "SELECT 3\x00"))
+	feedSlowly(s, true, pgMessage('p', "secret\x00"))
+	feedSlowly(s, false, pgMessage('E', "SFATAL\x00VFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00"))
+
+	assert.Equal(t, decode.Postgres, s.Protocol())
+	assert.Equal(t, []string{
+		"startup: user=alice database=shop",
+		"auth: authentication ok",
+		"server: PostgreSQL 16.2",
+		"query: SELECT * FROM orders",
+		"complete: SELECT 3",
+		"auth: password or SASL response",
+		"error: FATAL 28P01: password authentication failed",
+	}, eventTexts(s))
+	assert.True(t, s.Events()[0].Client)
+	assert.False(t, s.Events()[1].Client)
+}
+
+func TestDecodePostgresSSL(t *testing.T) {
+	s := decode.NewStream(decode.Auto)
+	s.Feed(true, pgUntyped(80877103, ""))
+	s.Feed(false, []byte("S"))
+	s.Feed(true, clientHelloBytes(t, "db.example.com", "postgresql"))
+
+	assert.Equal(t, []string{
+		"ssl_request: client requested SSL",
+		"ssl: server accepted encryption",
+		"client_hello: sni=db.example.com alpn=postgresql",
+	}, eventTexts(s))
+}
+
+func TestDecodeMySQL(t *testing.T) {
+	s := decode.NewStream(decode.Auto)
+
+	greeting := append([]byte{10}, "8.0.36\x00"...)
+	greeting = append(greeting, make([]byte, 40)...)
+	feedSlowly(s, false, mysqlPacket(0, greeting))
+
+	login := make([]byte, 32)
+	binary.LittleEndian.PutUint32(login, 0x00000008|0x00008000|0x00000200)
+	login = append(login, "bob\x00"...)
+	login = append(login, 3, 'x', 'y', 'z')
+	login = append(login, "inventory\x00"...)
+	feedSlowly(s, true, mysqlPacket(1, login))
+	feedSlowly(s, false, mysqlPacket(2, []byte{0, 0, 0, 2, 0, 0, 0}))
+
+	feedSlowly(s, true, mysqlPacket(0, append([]byte{3}, "SHOW TABLES"...)))
+	feedSlowly(s, false, mysqlPacket(1, []byte{1}))
+	feedSlowly(s, true, mysqlPacket(0, append([]byte{3}, "SELECT nope"...)))
+	feedSlowly(s, false, mysqlPacket(1, append([]byte{0xff, 0x7a, 0x04}, "#42S22Unknown column 'nope'"...)))
+
+	assert.Equal(t, decode.MySQL, s.Protocol())
+	assert.Equal(t, []string{
+		"server: MySQL 8.0.36",
+		"login: user=bob database=inventory",
+		"auth: authentication ok",
+		"query: SHOW TABLES",
+		"query: SELECT nope",
+		"error: ERROR 1146 (42S22): Unknown column 'nope'",
+	}, eventTexts(s))
+}
+
+func TestDecodeRedis(t *testing.T) {
+	s := decode.NewStream(decode.Auto)
+
+	feedSlowly(s, true, []byte("*2\r\n$4\r\nAUTH\r\n$6\r\nhunter\r\n"))
+	feedSlowly(s, false, []byte("+OK\r\n"))
+	feedSlowly(s, true, []byte("*3\r\n$3\r\nSET\r\n$4\r\ncart\r\n$8\r\nan apple\r\n"))
+	feedSlowly(s, true, []byte("PING\r\n"))
+	feedSlowly(s, false, []byte("*2\r\n$1\r\na\r\n:5\r\n-WRONGTYPE Operation against a key\r\n"))
+
+	assert.Equal(t, decode.Redis, s.Protocol())
+	assert.Equal(t, []string{
+		"command: AUTH ***",
+		`command: SET cart "an apple"`,
+		"command: PING",
+		"error: WRONGTYPE Operation against a key",
+	}, eventTexts(s))
+}
+
+func TestDecodeTLSAndSSH(t *testing.T) {
+	s := decode.NewStream(decode.Auto)
+	s.Feed(true, clientHelloBytes(t, "api.example.com", "h2", "http/1.1"))
+	assert.Equal(t, decode.TLS, s.Protocol())
+	assert.Equal(t, []string{"client_hello: sni=api.example.com alpn=h2,http/1.1"}, eventTexts(s))
+
+	s = decode.NewStream(decode.Auto)
+	s.Feed(false, []byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	s.Feed(true, []byte("SSH-2.0-Go\r\n\x00\x00\x01"))
+	assert.Equal(t, decode.SSH, s.Protocol())
+	assert.Equal(t, []string{"banner: SSH-2.0-OpenSSH_9.6", "banner: SSH-2.0-Go"}, eventTexts(s))
+
+	s = decode.NewStream(decode.Auto)
+	s.Feed(true, []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	assert.Equal(t, decode.Unknown, s.Protocol())
+	assert.Empty(t, s.Events())
+
+	assert.NoError(t, decode.Validate("postgres"))
+	assert.Error(t, decode.Validate("mongodb"))
+}
+
+func TestRelayDecodes(t *testing.T) {
+	rel := relay.New(startEcho(t), relay.Limits{})
+	rel.SetRecording(10)
+	rel.SetDecoding(decode.Auto)
+	port, err := rel.Start()
+	require.NoError(t, err)
+	defer rel.Close()
+
+	cmd := "*2\r\n$3\r\nGET\r\n$4\r\ncart\r\n"
+	assert.Equal(t, cmd, roundTrip(t, fmt.Sprintf("127.0.0.1:%d", port), cmd))
+
+	assert.Eventually(t, func() bool { return rel.Stats().Active == 0 }, 2*time.Second, 10*time.Millisecond)
+	conns := rel.Connections()
+	require.Len(t, conns, 1)
+	assert.Equal(t, decode.Redis, conns[0].Protocol)
+	require.NotEmpty(t, conns[0].Events)
+	assert.Equal(t, "GET cart", conns[0].Events[0].Text)
+}
+
+func TestDecodeRedisHugeLength(t *testing.T) {
+	s := decode.NewStream(decode.Auto)
+	assert.NotPanics(t, func() {
+		s.Feed(true, []byte("*1\r\n$9223372036854775807\r\nabc\r\n"))
+		s.Feed(true, []byte("*9223372036854775807\r\n$3\r\nGET\r\n"))
+	})
+	assert.Equal(t, decode.Redis, s.Protocol())
+	assert.Empty(t, s.Events())
+}
+
+func TestDecodeKeepsOtherSide(t *testing.T) {
+	s := decode.NewStream(decode.Auto)
+	s.Feed(true, []byte("SS"))
+	s.Feed(false, []byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	s.Feed(true, []byte("H-2.0-Go\r\n"))
+
+	assert.Equal(t, []string{"banner: SSH-2.0-OpenSSH_9.6", "banner: SSH-2.0-Go"}, eventTexts(s))
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/domains"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResolver answers DNS lookups from maps
+type fakeResolver struct {
+	cname map[string]string
+	txt   map[string][]string
+	hosts map[string][]string
+}
+
+var errNoRecord = errors.New("no such host")
+
+func (f fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if c, ok := f.cname[host]; ok {
+		return c, nil
+	}
+	return "", errNoRecord
+}
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if t, ok := f.txt[name]; ok {
+		return t, nil
+	}
+	return nil, errNoRecord
+}
+
+func (f fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if h, ok := f.hosts[host]; ok {
+		return h, nil
+	}
+	return nil, errNoRecord
+}
+
+func TestVerifyDomain(t *testing.T) {
+	ctx := context.Background()
+	r := fakeResolver{
+		cname: map[string]string{"app.example.com": "frp.lum.tools."},
+		txt: map[string][]string{
+			"_lrok-challenge.app.example.com": {"lrok-verify=tok123"},
+			"_lrok-challenge.example.com":     {"lrok-verify=apex"},
+		},
+		hosts: map[string][]string{
+			"example.com":   {"142.132.245.5"},
+			"frp.lum.tools": {"142.132.245.5"},
+		},
+	}
+
+	check := domains.Verify(ctx, r, "app.example.com", "tok123", "frp.lum.tools")
+	assert.True(t, check.Verified)
+	assert.Equal(t, "frp.lum.tools", check.CNAME)
+	assert.Empty(t, check.Problems)
+
+	// Apex domains route through A records instead of a CNAME
+	check = domains.Verify(ctx, r, "example.com", "apex", "frp.lum.tools")
+	assert.True(t, check.Routed)
+	assert.True(t, check.Verified)
+
+	check = domains.Verify(ctx, r, "app.example.com", "wrong-token", "frp.lum.tools")
+	assert.True(t, check.Routed)
+	assert.False(t, check.Owned)
+	assert.False(t, check.Verified)
+	assert.Len(t, check.Problems, 1)
+
+	check = domains.Verify(ctx, r, "other.example.com", "tok123", "frp.lum.tools")
+	assert.False(t, check.Routed)
+	assert.False(t, check.Verified)
+	assert.Len(t, check.Problems, 2)
+}
+
+func TestValidateDomain(t *testing.T) {
+	assert.NoError(t, tunnel.ValidateDomain("app.example.com"))
+	assert.NoError(t, tunnel.ValidateDomain("a-b.example.co.uk"))
+	assert.Error(t, tunnel.ValidateDomain("localhost"))
+	assert.Error(t, tunnel.ValidateDomain("-bad.example.com"))
+	assert.Error(t, tunnel.ValidateDomain("under_score.example.com"))
+	assert.Error(t, tunnel.ValidateDomain("app..example.com"))
+}
+
+func TestDomainsConfig(t *testing.T) {
+	withConfigFile(t, "")
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	cfg.AddDomain("app.example.com", "tok1", "frp.lum.tools")
+	cfg.AddDomain("api.example.com", "tok2", "frp.lum.tools").Verified = true
+	require.NoError(t, config.SaveConfig(cfg))
+
+	cfg, err = config.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api.example.com", "app.example.com"}, cfg.DomainNames())
+	assert.NoError(t, cfg.RequireVerifiedDomains([]string{"api.example.com"}))
+	assert.Error(t, cfg.RequireVerifiedDomains([]string{"app.example.com"}))
+	assert.Error(t, cfg.RequireVerifiedDomains([]string{"unknown.example.com"}))
+
+	// Re-adding keeps the token; a new target needs verifying again
+	d := cfg.AddDomain("api.example.com", "other", "frp.example.org")
+	assert.Equal(t, "tok2", d.Token)
+	assert.False(t, d.Verified)
+
+	delete(cfg.Domains, "app.example.com")
+	require.NoError(t, config.SaveConfig(cfg))
+	cfg, err = config.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api.example.com"}, cfg.DomainNames())
+
+	// Self-hosted servers don't need verification
+	assert.NoError(t, config.CheckDomains(&config.Server{SelfHosted: true}, []string{"unknown.example.com"}))
+	assert.Error(t, config.CheckDomains(&config.Server{}, []string{"unknown.example.com"}))
+}
+
+func TestCustomDomainsTOMLAndURL(t *testing.T) {
+	cfg := &config.TunnelConfig{
+		APIKey:        "lum_test",
+		LocalPort:     8080,
+		Subdomain:     "custom-domains",
+		CustomDomains: []string{"app.example.com", "www.example.com"},
+	}
+	path, err := config.GenerateTOML(cfg)
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `customDomains = ["app.example.com", "www.example.com"]`)
+	assert.Contains(t, string(data), `metadatas.custom_domains = "app.example.com,www.example.com"`)
+
+	server := config.DefaultServer()
+	assert.Equal(t, "https://app.example.com", server.CustomURL("app.example.com"))
+	assert.Equal(t, "frp.lum.tools", server.CNAMETarget())
+
+	server.URLTemplate = "http://{name}.{domain}:8080"
+	assert.Equal(t, "http://app.example.com:8080", server.CustomURL("app.example.com"))
+}
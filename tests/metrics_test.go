@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/dashboard"
+	"github.com/lum-tools/lrok/internal/metrics"
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathTemplate(t *testing.T) {
+	cases := map[string]string{
+		"":                   "/",
+		"/":                  "/",
+		"/health":            "/health",
+		"/users/42":          "/users/:id",
+		"/users/42/orders/7": "/users/:id/orders/:id",
+		"/orders/3f2a9c1e-7b4d-4c1a-9e2f-0a1b2c3d4e5f": "/orders/:id",
+		"/api/v1/webhook": "/api/v1/webhook",
+	}
+
+	for path, expected := range cases {
+		assert.Equal(t, expected, metrics.PathTemplate(path), "path %q", path)
+	}
+}
+
+func TestMetricLabelsAreCapped(t *testing.T) {
+	paths := metrics.NewPathSet(2)
+	assert.Equal(t, "/users/:id", paths.Label("/users/1"))
+	assert.Equal(t, "/health", paths.Label("/health"))
+	assert.Equal(t, metrics.OtherLabel, paths.Label("/wp-login.php"))
+	assert.Equal(t, metrics.OtherLabel, paths.Label("/.env"))
+	assert.Equal(t, "/users/:id", paths.Label("/users/2"))
+
+	assert.Equal(t, "PATCH", metrics.MethodLabel("PATCH"))
+	assert.Equal(t, "OTHER", metrics.MethodLabel("FOOBAR"))
+	assert.Equal(t, "OTHER", metrics.MethodLabel("get"))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "ok")
+	}))
+	defer app.Close()
+
+	appPort := app.Listener.Addr().(*net.TCPAddr).Port
+
+	prox := proxy.New(appPort, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	resp, err := http.Post(fmt.Sprintf("http://127.0.0.1:%d/users/42", proxyPort), "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	stats := &dashboard.Stats{TunnelName: "metrics-test", StartTime: time.Now()}
+	dash := dashboard.New(stats, prox)
+	require.NoError(t, dash.Start(0))
+	defer dash.Stop()
+
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", dash.Port()))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Equal(t, metrics.ContentTypeText, resp.Header.Get("Content-Type"))
+	text := string(body)
+	assert.Contains(t, text, `lrok_http_requests_total{method="POST",status="201",path="/users/:id"} 1`)
+	assert.Contains(t, text, `lrok_http_request_duration_seconds_count{method="POST",path="/users/:id"} 1`)
+	assert.Contains(t, text, `lrok_http_request_bytes_total{method="POST"} 5`)
+	assert.Contains(t, text, `lrok_tunnel_up 0`)
+	assert.Contains(t, text, `lrok_tunnel_state{state="stopped"} 0`)
+
+	// OpenMetrics negotiation
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/metrics", dash.Port()), nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, metrics.ContentTypeOpenMetrics, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "# TYPE lrok_http_requests counter")
+	assert.True(t, strings.HasSuffix(string(body), "# EOF\n"))
+}
@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/output"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputJSONMode(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	printer, err := output.NewWithWriters(output.FormatJSON, &stdout, &stderr)
+	require.NoError(t, err)
+
+	printer.Println("🚀 Starting lrok tunnel...")
+	printer.Event(output.EventReady, output.Fields{"url": "https://happy-dolphin.t.lum.tools"})
+	printer.Error(errors.New("boom"))
+
+	// Human text never pollutes stdout
+	assert.Equal(t, "🚀 Starting lrok tunnel...\n", stderr.String())
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var ready map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &ready))
+	assert.Equal(t, "ready", ready["event"])
+	assert.Equal(t, "https://happy-dolphin.t.lum.tools", ready["url"])
+	assert.NotEmpty(t, ready["time"])
+
+	var failed map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &failed))
+	assert.Equal(t, "error", failed["event"])
+	assert.Equal(t, "boom", failed["error"])
+}
+
+func TestOutputTextMode(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	printer, err := output.NewWithWriters(output.FormatText, &stdout, &stderr)
+	require.NoError(t, err)
+
+	printer.Printf("Public URL: %s\n", "https://x.t.lum.tools")
+	printer.Event(output.EventReady, output.Fields{"url": "https://x.t.lum.tools"})
+
+	assert.Equal(t, "Public URL: https://x.t.lum.tools\n", stdout.String())
+	assert.Empty(t, stderr.String())
+
+	_, err = output.New("xml")
+	assert.Error(t, err)
+}
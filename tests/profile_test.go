@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withConfigFile points HOME at a temp dir holding the given config.toml
+func withConfigFile(t *testing.T, content string) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("LROK_PROFILE", "")
+	config.SetProfile("")
+	t.Cleanup(func() { config.SetProfile("") })
+
+	path := filepath.Join(home, ".lrok", "config.toml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	if content != "" {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return path
+}
+
+func TestProfilesLegacyConfig(t *testing.T) {
+	withConfigFile(t, "[auth]\napi_key = \"lum_legacy\"\n")
+
+	key, err := config.GetAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_legacy", key)
+}
+
+func TestProfilesSelection(t *testing.T) {
+	withConfigFile(t, "")
+
+	require.NoError(t, config.SaveAPIKey("lum_personal"))
+	config.SetProfile("work")
+	require.NoError(t, config.SaveAPIKey("lum_work"))
+	config.SetProfile("")
+
+	key, err := config.GetAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_personal", key)
+
+	t.Setenv("LROK_PROFILE", "work")
+	key, err = config.GetAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_work", key)
+
+	// --profile wins over LROK_PROFILE
+	config.SetProfile("missing")
+	_, err = config.GetAPIKey()
+	assert.Error(t, err)
+	config.SetProfile("")
+
+	t.Setenv("LROK_PROFILE", "")
+	require.NoError(t, config.UseProfile("work"))
+	key, err = config.GetAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_work", key)
+
+	require.NoError(t, config.RemoveProfile("work"))
+	key, err = config.GetAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_personal", key)
+	assert.Error(t, config.UseProfile("work"))
+}
+
+func TestProfilesPreserveUnknownSettings(t *testing.T) {
+	path := withConfigFile(t, "[auth]\napi_key = \"lum_old\"\n\n[ui]\ntheme = \"dark\"\n")
+
+	require.NoError(t, config.SaveAPIKey("lum_new"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "theme = 'dark'")
+
+	cfg, err := config.LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_new", cfg.Auth.APIKey)
+	assert.Equal(t, []string{"default"}, cfg.ProfileNames())
+}
+
+func TestProfileApplyDefaults(t *testing.T) {
+	p := &config.Profile{
+		Defaults: config.TunnelDefaults{
+			BandwidthLimit: "1MB",
+			UseCompression: true,
+			HealthCheck:    "tcp",
+		},
+	}
+
+	cfg := &config.TunnelConfig{BandwidthLimit: "500KB"}
+	require.NoError(t, p.ApplyDefaults(cfg))
+	assert.Equal(t, "500KB", cfg.BandwidthLimit, "explicit settings win")
+	assert.True(t, cfg.UseCompression)
+	assert.Equal(t, "tcp", cfg.HealthCheckType)
+}
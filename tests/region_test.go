@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseServer(t *testing.T) {
+	s, err := config.ParseServer("frp.example.com:7100")
+	require.NoError(t, err)
+	assert.Equal(t, "frp.example.com", s.Addr)
+	assert.Equal(t, 7100, s.Port)
+	assert.Equal(t, "https://app.t.example.com", s.HTTPURL("app"))
+	assert.Equal(t, "frp.example.com:10022", s.TCPAddress(10022))
+
+	s, err = config.ParseServer("127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultServerPort, s.Port)
+	assert.Equal(t, "127.0.0.1", s.Domain)
+
+	// The lum.tools server keeps its public names
+	s, err = config.ParseServer("frp.lum.tools:7000")
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultServer(), s)
+
+	_, err = config.ParseServer("host:notaport")
+	assert.Error(t, err)
+}
+
+func TestResolveServerPrecedence(t *testing.T) {
+	withConfigFile(t, `
+[profiles.default]
+region = "lab"
+
+[regions.lab]
+addr = "frp.lab.internal"
+`)
+	t.Setenv("LROK_SERVER", "")
+	t.Setenv("LROK_REGION", "")
+	t.Setenv("LROK_SUBDOMAIN_HOST", "")
+	ctx := context.Background()
+
+	s, err := config.ResolveServer(ctx, config.ServerOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "lab", s.Region)
+	assert.Equal(t, "frp.lab.internal:7000", s.Address())
+	assert.Equal(t, "t.lab.internal", s.Domain)
+
+	t.Setenv("LROK_REGION", "eu")
+	s, err = config.ResolveServer(ctx, config.ServerOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultServer(), *s)
+
+	t.Setenv("LROK_SERVER", "127.0.0.1:7001")
+	s, err = config.ResolveServer(ctx, config.ServerOptions{SubdomainHost: "localtest.me"})
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:7001", s.Address())
+	assert.Equal(t, "https://x.localtest.me", s.HTTPURL("x"))
+
+	_, err = config.ResolveServer(ctx, config.ServerOptions{Region: "mars"})
+	assert.Error(t, err)
+}
+
+func TestProbeRegions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	up := listener.Addr().(*net.TCPAddr).Port
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	down := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	regions := map[string]config.Server{
+		"down": {Addr: "127.0.0.1", Port: down},
+		"up":   {Addr: "127.0.0.1", Port: up},
+	}
+
+	results := config.ProbeRegions(context.Background(), regions, time.Second)
+	require.Len(t, results, 2)
+	assert.Equal(t, "up", results[0].Region)
+	assert.Empty(t, results[0].Error)
+	assert.NotEmpty(t, results[1].Error)
+
+	best, err := config.ClosestRegion(context.Background(), regions, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, up, best.Port)
+}
+
+func TestResolveServerAutoWithoutRegions(t *testing.T) {
+	// Only the built-in region: no probe, just the default
+	withConfigFile(t, "")
+	t.Setenv("LROK_SERVER", "")
+	t.Setenv("LROK_REGION", "")
+
+	s, err := config.ResolveServer(context.Background(), config.ServerOptions{Region: config.RegionAuto})
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultRegion, s.Region)
+}
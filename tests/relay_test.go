@@ -0,0 +1,283 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/dashboard"
+	"github.com/lum-tools/lrok/internal/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startEcho runs a TCP server echoing every connection back
+func startEcho(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// startRelay starts a relay to target and returns its address
+func startRelay(t *testing.T, target string, limits relay.Limits) (*relay.Relay, string) {
+	rel := relay.New(target, limits)
+	port, err := rel.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() { rel.Close() })
+	return rel, fmt.Sprintf("127.0.0.1:%d", port)
+}
+
+// roundTrip sends msg through addr and reads the echo
+func roundTrip(t *testing.T, addr, msg string) string {
+	return exchange(t, addr, msg, len(msg))
+}
+
+// exchange sends msg through addr and reads n bytes back
+func exchange(t *testing.T, addr, msg string, n int) string {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte(msg))
+	require.NoError(t, err)
+	buf := make([]byte, n)
+	read, _ := io.ReadFull(conn, buf)
+	return string(buf[:read])
+}
+
+func TestRelayCounts(t *testing.T) {
+	rel, addr := startRelay(t, startEcho(t), relay.Limits{})
+
+	assert.Equal(t, "hello", roundTrip(t, addr, "hello"))
+	assert.Equal(t, "relay!", roundTrip(t, addr, "relay!"))
+
+	assert.Eventually(t, func() bool { return rel.Stats().Active == 0 }, 2*time.Second, 10*time.Millisecond)
+	stats := rel.Stats()
+	assert.Equal(t, int64(11), stats.BytesIn)
+	assert.Equal(t, int64(11), stats.BytesOut)
+	assert.Equal(t, int64(2), stats.Connections)
+	assert.Nil(t, stats.ExpiresAt)
+	assert.NoError(t, rel.Err())
+}
+
+func TestRelayMaxConns(t *testing.T) {
+	rel, addr := startRelay(t, startEcho(t), relay.Limits{MaxConns: 1})
+
+	first, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer first.Close()
+	assert.Eventually(t, func() bool { return rel.Stats().Active == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	// A second connection is refused while the first is open
+	second, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = second.Read(make([]byte, 1))
+	assert.Error(t, err)
+	second.Close()
+	assert.Equal(t, int64(1), rel.Stats().Rejected)
+
+	first.Close()
+	assert.Eventually(t, func() bool { return rel.Stats().Active == 0 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "again", roundTrip(t, addr, "again"))
+}
+
+func TestRelayMaxBytes(t *testing.T) {
+	rel, addr := startRelay(t, startEcho(t), relay.Limits{MaxBytes: 16})
+
+	assert.Equal(t, "12345", roundTrip(t, addr, "12345"))
+	roundTrip(t, addr, strings.Repeat("x", 32))
+
+	select {
+	case <-rel.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("relay did not stop at the byte limit")
+	}
+	assert.Equal(t, relay.ReasonMaxBytes, rel.Reason())
+	assert.ErrorContains(t, rel.Err(), "traffic limit")
+	stats := rel.Stats()
+	assert.Equal(t, int64(16), stats.BytesIn+stats.BytesOut)
+
+	_, err := net.DialTimeout("tcp", addr, time.Second)
+	assert.Error(t, err, "relay keeps listening after the limit")
+}
+
+func TestRelayExpire(t *testing.T) {
+	rel, _ := startRelay(t, startEcho(t), relay.Limits{ExpireAfter: 100 * time.Millisecond})
+	require.NotNil(t, rel.Stats().ExpiresAt)
+
+	select {
+	case <-rel.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("relay did not expire")
+	}
+	assert.Equal(t, relay.ReasonExpired, rel.Reason())
+	assert.EqualError(t, rel.Err(), "tunnel expired after 100ms")
+}
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]int64{
+		"1048576": 1 << 20,
+		"500MB":   500 << 20,
+		"2gb":     2 << 30,
+		"1.5 KB":  1536,
+		"10B":     10,
+	}
+	for input, expected := range cases {
+		n, err := relay.ParseBytes(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, n, input)
+	}
+	for _, input := range []string{"", "MB", "-5MB", "lots"} {
+		_, err := relay.ParseBytes(input)
+		assert.Error(t, err, input)
+	}
+	assert.Equal(t, "500.0 MB", relay.FormatBytes(500<<20))
+	assert.Equal(t, "12 B", relay.FormatBytes(12))
+}
+
+func TestDashboardRelayStats(t *testing.T) {
+	rel, addr := startRelay(t, startEcho(t), relay.Limits{MaxConns: 5})
+	roundTrip(t, addr, "ping")
+
+	stats := &dashboard.Stats{TunnelName: "relay-test", StartTime: time.Now()}
+	dash := dashboard.New(stats, nil)
+	require.NoError(t, dash.Start(0))
+	defer dash.Stop()
+	dash.SetRelay(rel)
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/api/stats", dash.Port()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var got dashboard.Stats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	assert.Equal(t, int64(4), got.BytesIn)
+	assert.Equal(t, int64(1), got.Connections)
+	assert.Equal(t, 5, got.Limits.MaxConns)
+
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", dash.Port()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "lrok_tunnel_received_bytes_total 4")
+	assert.Contains(t, string(body), "lrok_tunnel_connections_total 1")
+}
+
+func TestRelayRecordsConnections(t *testing.T) {
+	rel := relay.New(startEcho(t), relay.Limits{})
+	rel.SetRecording(2)
+	port, err := rel.Start()
+	require.NoError(t, err)
+	defer rel.Close()
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	ch := rel.Subscribe()
+	defer rel.Unsubscribe(ch)
+
+	assert.Equal(t, "SELECT 1", roundTrip(t, addr, "SELECT 1"))
+	opened := <-ch
+	assert.Nil(t, opened.End)
+	closed := <-ch
+	require.NotNil(t, closed.End)
+	assert.Equal(t, opened.ID, closed.ID)
+	assert.Equal(t, int64(8), closed.BytesIn)
+	assert.Equal(t, int64(8), closed.BytesOut)
+	assert.Contains(t, closed.FirstIn, "SELECT 1")
+	assert.Contains(t, closed.RemoteAddr, "127.0.0.1:")
+
+	roundTrip(t, addr, "two")
+	roundTrip(t, addr, "three")
+	assert.Eventually(t, func() bool { return rel.Stats().Active == 0 }, 2*time.Second, 10*time.Millisecond)
+	conns := rel.Connections()
+	require.Len(t, conns, 2, "only the last two are kept")
+	assert.Equal(t, int64(5), conns[0].BytesIn, "newest first")
+}
+
+func TestRelayProxyProtocol(t *testing.T) {
+	rel := relay.New(startEcho(t), relay.Limits{})
+	rel.SetRecording(10)
+	rel.SetProxyProtocol(true)
+	port, err := rel.Start()
+	require.NoError(t, err)
+	defer rel.Close()
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	// The header is stripped before the target sees the stream
+	assert.Equal(t, "hi", exchange(t, addr, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 5432\r\nhi", 2))
+
+	v2 := []byte("\r\n\r\n\x00\r\nQUIT\n\x21\x11\x00\x0c")
+	v2 = append(v2, 198, 51, 100, 9, 10, 0, 0, 1, 0xc8, 0x4b, 0x15, 0x38)
+	assert.Equal(t, "v2", exchange(t, addr, string(v2)+"v2", 2))
+
+	assert.Eventually(t, func() bool { return rel.Stats().Active == 0 }, 2*time.Second, 10*time.Millisecond)
+	conns := rel.Connections()
+	require.Len(t, conns, 2)
+	assert.Equal(t, "198.51.100.9:51275", conns[0].RemoteAddr)
+	assert.Equal(t, "203.0.113.7:51234", conns[1].RemoteAddr)
+	assert.Equal(t, int64(2), conns[1].BytesIn, "header bytes are not traffic")
+
+	cfg := &config.TunnelConfig{APIKey: "lum_test", LocalPort: 5432, Subdomain: "pp-test", ProxyType: "tcp", RemotePort: 10001, ProxyProtocol: "v2"}
+	path, err := config.GenerateTOML(cfg)
+	require.NoError(t, err)
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `proxyProtocolVersion = "v2"`)
+}
+
+func TestDashboardConnections(t *testing.T) {
+	rel := relay.New(startEcho(t), relay.Limits{})
+	rel.SetRecording(10)
+	port, err := rel.Start()
+	require.NoError(t, err)
+	defer rel.Close()
+	roundTrip(t, fmt.Sprintf("127.0.0.1:%d", port), "ping")
+
+	stats := &dashboard.Stats{TunnelName: "tcp-test", StartTime: time.Now()}
+	dash := dashboard.New(stats, nil)
+	require.NoError(t, dash.Start(0))
+	defer dash.Stop()
+	dash.SetRelay(rel)
+	base := fmt.Sprintf("http://127.0.0.1:%d", dash.Port())
+
+	resp, err := http.Get(base + "/api/connections")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var conns []relay.Conn
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&conns))
+	require.Len(t, conns, 1)
+	assert.Equal(t, int64(4), conns[0].BytesIn)
+
+	// Raw TCP tunnels show connections instead of the HTTP inspector
+	resp, err = http.Get(base + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	page, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(page), `id="connections-card" style="display: block;"`)
+	assert.Contains(t, string(page), `id="requests-card" style="display: none;"`)
+
+	resp, err = http.Get(base + "/api/requests")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveAPIKeyPrecedence(t *testing.T) {
+	withConfigFile(t, "[auth]\napi_key = \"lum_config\"\n")
+	t.Setenv("LUM_API_KEY", "")
+	t.Setenv("FRP_API_KEY", "")
+
+	cred, err := config.ResolveAPIKey("")
+	require.NoError(t, err)
+	assert.Equal(t, "lum_config", cred.APIKey)
+	assert.Equal(t, "profile 'default'", cred.Source)
+
+	t.Setenv("FRP_API_KEY", "lum_legacy")
+	cred, err = config.ResolveAPIKey("")
+	require.NoError(t, err)
+	assert.Equal(t, "lum_legacy", cred.APIKey)
+	assert.Equal(t, "FRP_API_KEY", cred.Source)
+
+	t.Setenv("LUM_API_KEY", "lum_env")
+	cred, err = config.ResolveAPIKey("")
+	require.NoError(t, err)
+	assert.Equal(t, "LUM_API_KEY", cred.Source)
+
+	cred, err = config.ResolveAPIKey("lum_flag")
+	require.NoError(t, err)
+	assert.Equal(t, "lum_flag", cred.APIKey)
+	assert.Equal(t, "--api-key flag", cred.Source)
+
+	// Inspect reports every source, exactly one used
+	cred, err = config.InspectAPIKey("lum_flag")
+	require.NoError(t, err)
+	require.Len(t, cred.Chain, 4)
+	used := 0
+	for _, src := range cred.Chain {
+		assert.True(t, src.Present, src.Name)
+		if src.Used {
+			used++
+		}
+	}
+	assert.Equal(t, 1, used)
+}
+
+func TestResolveAPIKeyMissing(t *testing.T) {
+	withConfigFile(t, "")
+	t.Setenv("LUM_API_KEY", "")
+	t.Setenv("FRP_API_KEY", "")
+
+	_, err := config.ResolveAPIKey("")
+	assert.ErrorIs(t, err, config.ErrNoAPIKey)
+}
+
+func TestValidateAPIKeyFormat(t *testing.T) {
+	assert.NoError(t, config.ValidateAPIKeyFormat("lum_abc"))
+	assert.Error(t, config.ValidateAPIKeyFormat("sk_abc"))
+	assert.Error(t, config.ValidateAPIKeyFormat("lum_"))
+}
+
+func TestLoginVerifier(t *testing.T) {
+	server := &config.Server{Addr: "frp.example.com", Port: 7000}
+	fakeFrpc := func(lines ...string) func(context.Context, string, []string, io.Writer) error {
+		return func(ctx context.Context, configPath string, env []string, out io.Writer) error {
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				return err
+			}
+			// The key travels in frpc's environment, never in the config file
+			assert.NotContains(t, string(data), "lum_checked")
+			assert.Contains(t, string(data), `serverAddr = "frp.example.com"`)
+			assert.Contains(t, env, config.APIKeyEnvVar+"=lum_checked")
+			for _, line := range lines {
+				fmt.Fprintln(out, line)
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	}
+
+	verifier := tunnel.NewLoginVerifier(server)
+	verifier.Run = fakeFrpc("[I] login to server success, get run id [abc]", "[I] [happy-dolphin] start proxy success")
+	assert.NoError(t, verifier.Verify(context.Background(), "lum_checked"))
+
+	verifier.Run = fakeFrpc("[I] login to server success, get run id [abc]", "[W] [happy-dolphin] start error: invalid api key")
+	err := verifier.Verify(context.Background(), "lum_checked")
+	assert.ErrorIs(t, err, config.ErrInvalidAPIKey)
+	assert.ErrorContains(t, err, "invalid api key")
+
+	verifier.Run = fakeFrpc("[W] login to the server failed: dial tcp: i/o timeout")
+	err = verifier.Verify(context.Background(), "lum_checked")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, config.ErrInvalidAPIKey)
+
+	verifier.Run = func(context.Context, string, []string, io.Writer) error {
+		return fmt.Errorf("exec format error")
+	}
+	assert.ErrorContains(t, verifier.Verify(context.Background(), "lum_checked"), "exec format error")
+}
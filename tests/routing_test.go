@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoute(t *testing.T) {
+	r, err := proxy.ParseRoute("/api/=8080")
+	require.NoError(t, err)
+	assert.Equal(t, "", r.Host)
+	assert.Equal(t, "/api", r.Prefix)
+	assert.Equal(t, "http://127.0.0.1:8080", r.Targets[0].String())
+
+	r, err = proxy.ParseRoute("Admin.Example.com=9000")
+	require.NoError(t, err)
+	assert.Equal(t, "admin.example.com", r.Host)
+	assert.Equal(t, "/", r.Prefix)
+
+	r, err = proxy.ParseRoute("api.example.com/v2=https://10.0.0.5:8443")
+	require.NoError(t, err)
+	assert.Equal(t, "api.example.com", r.Host)
+	assert.Equal(t, "/v2", r.Prefix)
+	assert.Equal(t, "https://10.0.0.5:8443", r.Targets[0].String())
+
+	for _, spec := range []string{"/api", "=8080", "/api=", "/api=70000", "/api=ftp://host"} {
+		_, err := proxy.ParseRoute(spec)
+		assert.Error(t, err, spec)
+	}
+
+	_, err = proxy.ParseRoutes([]string{"/api=1", "/api/=2"}, 0)
+	assert.Error(t, err)
+
+	routes, err := proxy.ParseRoutes([]string{"/api=8080"}, 3000)
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	assert.Equal(t, "/", routes[1].Prefix)
+}
+
+func startNamedApp(t *testing.T, name string) int {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+	}))
+	t.Cleanup(app.Close)
+	return app.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestProxyPathRouting(t *testing.T) {
+	apiPort := startNamedApp(t, "api")
+	webPort := startNamedApp(t, "web")
+	adminPort := startNamedApp(t, "admin")
+
+	routes, err := proxy.ParseRoutes([]string{
+		"/api=" + strconv.Itoa(apiPort),
+		"admin.local/=" + strconv.Itoa(adminPort),
+		"/=" + strconv.Itoa(webPort),
+	}, 0)
+	require.NoError(t, err)
+
+	prox := proxy.NewWithRoutes(routes, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	get := func(host, path string) string {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d%s", proxyPort, path), nil)
+		require.NoError(t, err)
+		if host != "" {
+			req.Host = host
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	assert.Equal(t, "api /api/users", get("", "/api/users"))
+	assert.Equal(t, "api /api", get("", "/api"))
+	assert.Equal(t, "web /apix", get("", "/apix"))
+	assert.Equal(t, "web /callback", get("", "/callback"))
+	assert.Equal(t, "admin /settings", get("admin.local:8080", "/settings"))
+
+	upstreams := map[string]string{}
+	for _, req := range prox.GetRequests() {
+		upstreams[req.Path] = req.Upstream
+	}
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", apiPort), upstreams["/api/users"])
+	assert.Equal(t, fmt.Sprintf("127.0.0.1:%d", webPort), upstreams["/callback"])
+}
+
+func TestProxyNoRoute(t *testing.T) {
+	apiPort := startNamedApp(t, "api")
+	routes, err := proxy.ParseRoutes([]string{"/api=" + strconv.Itoa(apiPort)}, 0)
+	require.NoError(t, err)
+
+	prox := proxy.NewWithRoutes(routes, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/other", proxyPort))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lum-tools/lrok/pkg/lrok"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSDKListenValidation(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		target lrok.Target
+		opts   []lrok.Option
+	}{
+		{"zero target", lrok.Target{}, nil},
+		{"invalid local port", lrok.HTTP(0), nil},
+		{"invalid name", lrok.HTTP(8000), []lrok.Option{lrok.WithName("Bad_Name!")}},
+		{"missing remote port", lrok.TCP(22, 0), nil},
+		{"short secret", lrok.STCP(22, "abc"), nil},
+		{"invalid bandwidth", lrok.HTTP(8000), []lrok.Option{lrok.WithBandwidthLimit("fast")}},
+		{"invalid health check", lrok.HTTP(8000), []lrok.Option{lrok.WithHealthCheck("udp")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append(tt.opts, lrok.WithAPIKey("lum_test"))
+			tun, err := lrok.Listen(ctx, tt.target, opts...)
+			assert.Error(t, err)
+			assert.Nil(t, tun)
+		})
+	}
+}
+
+func TestSDKListenRequiresAPIKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LUM_API_KEY", "")
+	t.Setenv("FRP_API_KEY", "")
+
+	tun, err := lrok.Listen(context.Background(), lrok.HTTP(8000))
+	assert.True(t, errors.Is(err, lrok.ErrNoAPIKey))
+	assert.Nil(t, tun)
+}
+
+func TestSDKListenHTTPRequiresAPIKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LUM_API_KEY", "")
+	t.Setenv("FRP_API_KEY", "")
+
+	ln, err := lrok.ListenHTTP(context.Background(), lrok.WithName("sdk-listener"))
+	assert.True(t, errors.Is(err, lrok.ErrNoAPIKey))
+	assert.Nil(t, ln)
+
+	ln, err = lrok.ListenTCP(context.Background(), 0, lrok.WithAPIKey("lum_test"))
+	assert.Error(t, err)
+	assert.Nil(t, ln)
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/secrets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	store := secrets.NewFileStoreWithPassphrase(path, "correct horse")
+
+	_, err := store.Get("default")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	require.NoError(t, store.Set("default", "lum_one"))
+	require.NoError(t, store.Set("work", "lum_two"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "lum_one")
+
+	key, err := store.Get("work")
+	require.NoError(t, err)
+	assert.Equal(t, "lum_two", key)
+
+	_, err = secrets.NewFileStoreWithPassphrase(path, "wrong").Get("work")
+	assert.Error(t, err)
+
+	require.NoError(t, store.Delete("work"))
+	_, err = store.Get("work")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+}
+
+func TestFileStoreReadsExistingFile(t *testing.T) {
+	// Written by an earlier release: changing the key derivation breaks it
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":1,"salt":"jnK5I4vSasnekjyE4kVxcw==","nonce":"EacR+WCjOKhJjz4+","data":"TnVQBvHiEjmgULiXfUX6zRxgLgJtvG2rJm4axLW4J7qEymYjsC2eufsF"}`), 0600))
+
+	key, err := secrets.NewFileStoreWithPassphrase(path, "correct horse").Get("work")
+	require.NoError(t, err)
+	assert.Equal(t, "lum_fixture_key", key)
+}
+
+func TestLoginWithFileBackend(t *testing.T) {
+	path := withConfigFile(t, "")
+	t.Setenv(secrets.PassphraseEnv, "test-passphrase")
+
+	require.NoError(t, config.SaveAPIKeyTo("lum_secret", secrets.BackendFile))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "lum_secret")
+
+	key, err := config.GetAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_secret", key)
+
+	// Switching back to plaintext removes the encrypted copy
+	require.NoError(t, config.SaveAPIKeyTo("lum_plain", secrets.BackendPlaintext))
+	_, err = secrets.NewFileStore(filepath.Dir(path)).Get("default")
+	assert.ErrorIs(t, err, secrets.ErrNotFound)
+
+	require.NoError(t, config.ClearAPIKey())
+	_, err = config.GetAPIKey()
+	assert.Error(t, err)
+}
+
+func TestAPIKeyCommand(t *testing.T) {
+	withConfigFile(t, "[profiles.default]\napi_key_command = \"echo lum_from_command\"\n")
+
+	key, err := config.GetAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, "lum_from_command", key)
+
+	_, err = secrets.RunCommand("exit 3")
+	assert.Error(t, err)
+}
+
+func TestTunnelConfigAPIKeyFromEnv(t *testing.T) {
+	cfg := &config.TunnelConfig{
+		APIKey:         "lum_do_not_write",
+		SecretsFromEnv: true,
+		LocalPort:      8080,
+		Subdomain:      "env-key-test",
+	}
+
+	path, err := config.GenerateTOML(cfg)
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "lum_do_not_write")
+	assert.Contains(t, string(data), `metadatas.api_key = "{{ .Envs.LROK_FRPC_API_KEY }}"`)
+	assert.Equal(t, []string{"LROK_FRPC_API_KEY=lum_do_not_write"}, cfg.Env())
+}
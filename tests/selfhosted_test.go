@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/pkg/lrok"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateSelfHostedTOML(t *testing.T, cfg *config.TunnelConfig) string {
+	path, err := config.GenerateTOML(cfg)
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSelfHostedTokenAuthTOML(t *testing.T) {
+	cfg := &config.TunnelConfig{
+		ServerAddr:     "frps.corp.example",
+		ServerPort:     7000,
+		LocalPort:      8080,
+		Subdomain:      "self-hosted-token",
+		SelfHosted:     true,
+		Auth:           config.AuthConfig{Token: "s3cret-token"},
+		SecretsFromEnv: true,
+	}
+
+	content := generateSelfHostedTOML(t, cfg)
+	assert.Contains(t, content, `auth.method = "token"`)
+	assert.Contains(t, content, `auth.token = "{{ .Envs.LROK_FRPC_AUTH_TOKEN }}"`)
+	assert.NotContains(t, content, "s3cret-token")
+	assert.NotContains(t, content, "metadatas.")
+	assert.Equal(t, []string{"LROK_FRPC_AUTH_TOKEN=s3cret-token"}, cfg.Env())
+}
+
+func TestSelfHostedOIDCAndTLSTOML(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, []byte("test"), 0600))
+
+	cfg := &config.TunnelConfig{
+		LocalPort:  8080,
+		Subdomain:  "self-hosted-oidc",
+		SelfHosted: true,
+		Auth: config.AuthConfig{
+			Method:           config.AuthMethodOIDC,
+			OIDCClientID:     "lrok",
+			OIDCClientSecret: "oidc-secret",
+			OIDCAudience:     "frps",
+			OIDCTokenURL:     "https://sso.example/token",
+		},
+		TLS: config.TLSConfig{CAFile: ca, ServerName: "frps.corp.example"},
+	}
+
+	content := generateSelfHostedTOML(t, cfg)
+	assert.Contains(t, content, `auth.method = "oidc"`)
+	assert.Contains(t, content, `auth.oidc.clientID = "lrok"`)
+	assert.Contains(t, content, `auth.oidc.clientSecret = "oidc-secret"`)
+	assert.Contains(t, content, `auth.oidc.audience = "frps"`)
+	assert.Contains(t, content, `auth.oidc.tokenEndpointURL = "https://sso.example/token"`)
+	assert.Contains(t, content, "transport.tls.enable = true")
+	assert.Contains(t, content, fmt.Sprintf(`transport.tls.trustedCaFile = "%s"`, ca))
+	assert.Contains(t, content, `transport.tls.serverName = "frps.corp.example"`)
+}
+
+func TestSelfHostedValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.TunnelConfig
+	}{
+		{"missing token", config.TunnelConfig{SelfHosted: true}},
+		{"unknown method", config.TunnelConfig{SelfHosted: true, Auth: config.AuthConfig{Method: "ldap", Token: "x"}}},
+		{"oidc without endpoint", config.TunnelConfig{SelfHosted: true, Auth: config.AuthConfig{Method: "oidc", OIDCClientID: "lrok"}}},
+		{"missing CA file", config.TunnelConfig{TLS: config.TLSConfig{CAFile: "/nonexistent/ca.pem"}}},
+		{"cert without key", config.TunnelConfig{TLS: config.TLSConfig{CertFile: "/etc/hostname"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.LocalPort = 8080
+			cfg.Subdomain = "self-hosted-invalid"
+			_, err := config.GenerateTOML(&cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestResolveServerSelfHostedProfile(t *testing.T) {
+	withConfigFile(t, `
+[profiles.default]
+server = "frps.corp.example:7100"
+subdomain_host = "tunnels.corp.example"
+
+[profiles.default.self_hosted]
+enabled = true
+url_template = "http://{name}.{domain}:8080"
+
+[profiles.default.self_hosted.auth]
+token = "from-profile"
+`)
+	t.Setenv("LROK_AUTH_TOKEN", "")
+
+	server, err := config.ResolveServer(context.Background(), config.ServerOptions{})
+	require.NoError(t, err)
+	assert.True(t, server.SelfHosted)
+	assert.Equal(t, "frps.corp.example:7100", server.Address())
+	assert.Equal(t, "from-profile", server.Auth.Token)
+	assert.Equal(t, "http://app.tunnels.corp.example:8080", server.HTTPURL("app"))
+	assert.True(t, config.SelfHostedActive())
+
+	t.Setenv("LROK_AUTH_TOKEN", "from-env")
+	server, err = config.ResolveServer(context.Background(), config.ServerOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", server.Auth.Token)
+
+	cfg := &config.TunnelConfig{}
+	server.Apply(cfg)
+	assert.True(t, cfg.SelfHosted)
+	assert.Equal(t, "from-env", cfg.Auth.Token)
+}
+
+func TestResolveServerSelfHostedNeedsServer(t *testing.T) {
+	withConfigFile(t, `
+[profiles.default.self_hosted]
+enabled = true
+auth = { token = "x" }
+`)
+
+	_, err := config.ResolveServer(context.Background(), config.ServerOptions{})
+	assert.Error(t, err)
+}
+
+// TestSelfHostedFrps tunnels through a locally started frps. Set
+// LROK_TEST_FRPS to the path of an frps binary to run it.
+func TestSelfHostedFrps(t *testing.T) {
+	frps := os.Getenv("LROK_TEST_FRPS")
+	if frps == "" {
+		t.Skip("Set LROK_TEST_FRPS to an frps binary to run")
+	}
+
+	bindPort, vhostPort := getRandomPort(), getRandomPort()
+	dir := t.TempDir()
+	frpsConfig := filepath.Join(dir, "frps.toml")
+	require.NoError(t, os.WriteFile(frpsConfig, []byte(fmt.Sprintf(`bindPort = %d
+vhostHTTPPort = %d
+subDomainHost = "lrok.test"
+auth.method = "token"
+auth.token = "frps-test-token"
+`, bindPort, vhostPort)), 0600))
+
+	cmd := exec.Command(frps, "-c", frpsConfig)
+	require.NoError(t, cmd.Start())
+	defer cleanupTunnel(cmd)
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", bindPort))
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 10*time.Second, 100*time.Millisecond)
+
+	withConfigFile(t, fmt.Sprintf(`
+[profiles.default]
+server = "127.0.0.1:%d"
+subdomain_host = "lrok.test"
+
+[profiles.default.self_hosted]
+enabled = true
+url_template = "http://{name}.{domain}:%d"
+
+[profiles.default.self_hosted.auth]
+token = "frps-test-token"
+`, bindPort, vhostPort))
+	t.Setenv("LUM_API_KEY", "")
+	t.Setenv("FRP_API_KEY", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ln, err := lrok.ListenHTTP(ctx, lrok.WithName("self-hosted"))
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.Equal(t, fmt.Sprintf("http://self-hosted.lrok.test:%d", vhostPort), ln.URL())
+
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from self-hosted")
+	}))
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/", vhostPort), nil)
+	require.NoError(t, err)
+	req.Host = fmt.Sprintf("self-hosted.lrok.test:%d", vhostPort)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello from self-hosted", string(body))
+}
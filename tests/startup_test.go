@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyStartDoesNotTouchApp(t *testing.T) {
+	var hits atomic.Int32
+	app := startHandlerApp(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	prox := proxy.New(app, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	// The probe path is answered by the proxy on any host, uncaptured
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d%s", proxyPort, proxy.ProbePath), nil)
+	require.NoError(t, err)
+	req.Host = "my-app.t.lum.tools"
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, int32(0), hits.Load())
+	assert.Empty(t, prox.GetRequests())
+
+	// Readiness checks go to the app directly, not through the inspector
+	ctx := context.Background()
+	assert.NoError(t, prox.CheckUpstreams(ctx, ""))
+	assert.Equal(t, int32(0), hits.Load())
+	assert.Error(t, prox.CheckUpstreams(ctx, "/healthz"))
+	assert.NoError(t, prox.CheckUpstreams(ctx, "/ready"))
+	assert.Empty(t, prox.GetRequests())
+
+	down := proxy.New(closedPort(t), 100)
+	assert.Error(t, down.CheckUpstreams(ctx, ""))
+}
@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/lum-tools/lrok/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceIDString())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanIDString())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	invalid := []string{
+		"",
+		"garbage",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, value := range invalid {
+		_, ok := tracing.ParseTraceparent(value)
+		assert.False(t, ok, "traceparent %q should be rejected", value)
+	}
+}
+
+func TestProxyTracePropagation(t *testing.T) {
+	// Fake OTLP collector
+	var mu sync.Mutex
+	var exported []map[string]interface{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		exported = append(exported, payload)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	// Local app records the traceparent it receives
+	seen := make(chan string, 10)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/traced" {
+			seen <- r.Header.Get("Traceparent")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer app.Close()
+
+	prox := proxy.New(app.Listener.Addr().(*net.TCPAddr).Port, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	tracer, err := tracing.New(tracing.Config{Endpoint: tracing.TracesURL(collector.URL), ServiceName: "lrok-test"})
+	require.NoError(t, err)
+	prox.SetTracer(tracer)
+
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/traced", proxyPort), nil)
+	req.Header.Set("Traceparent", incoming)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// The app sees the same trace with the proxy's span as parent
+	propagated := <-seen
+	sc, ok := tracing.ParseTraceparent(propagated)
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceIDString())
+	assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanIDString())
+
+	// The captured request carries the trace ID for the dashboard
+	var captured *proxy.Request
+	for _, r := range prox.GetRequests() {
+		if r.Path == "/traced" {
+			captured = r
+		}
+	}
+	require.NotNil(t, captured)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", captured.TraceID)
+	assert.Equal(t, incoming, captured.RequestHeaders["Traceparent"])
+
+	// Shutdown flushes the span to the collector
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tracer.Shutdown(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, exported, 1)
+	data, _ := json.Marshal(exported[0])
+	assert.Contains(t, string(data), `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, string(data), `"parentSpanId":"00f067aa0ba902b7"`)
+	assert.Contains(t, string(data), `"name":"GET /traced"`)
+	assert.Contains(t, string(data), `"stringValue":"lrok-test"`)
+}
+
+func TestTracerUnsupportedProtocolStillPropagates(t *testing.T) {
+	// Plain-text gRPC can't be exported, but tracing must not stop the tunnel
+	tracer, err := tracing.New(tracing.Config{Endpoint: "http://localhost:4317", Protocol: "grpc"})
+	assert.Error(t, err)
+	require.NotNil(t, tracer)
+	assert.False(t, tracer.Exporting())
+
+	_, err = tracing.New(tracing.Config{Endpoint: "http://localhost:4318/v1/traces", Protocol: "thrift"})
+	assert.Error(t, err)
+
+	tracer, err = tracing.New(tracing.Config{Endpoint: "https://collector.example.com:4317", Protocol: "grpc"})
+	assert.NoError(t, err)
+	assert.True(t, tracer.Exporting())
+}
+
+func TestTracerExportsProtobuf(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer collector.Close()
+
+	tracer, err := tracing.New(tracing.Config{Endpoint: tracing.TracesURL(collector.URL), Protocol: "http/protobuf", ServiceName: "lrok-test"})
+	require.NoError(t, err)
+
+	incoming := http.Header{}
+	incoming.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := tracer.StartServerSpan("GET /orders", incoming)
+	span.SetAttribute("http.response.status_code", 200)
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tracer.Shutdown(ctx))
+
+	r := <-received
+	body := <-bodies
+	assert.Equal(t, "/v1/traces", r.URL.Path)
+	assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+	traceID, _ := hex.DecodeString("4bf92f3577b34da6a3ce929d0e0e4736")
+	assert.True(t, bytes.Contains(body, append([]byte{0x0a, 16}, traceID...)), "trace_id field")
+	assert.True(t, bytes.Contains(body, []byte("\x2a\x0bGET /orders")), "name field")
+	assert.True(t, bytes.Contains(body, []byte("lrok-test")))
+}
+
+func TestProxyForwardsTraceparentWithoutCollector(t *testing.T) {
+	seen := make(chan http.Header, 10)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Clone()
+	}))
+	defer app.Close()
+
+	prox := proxy.New(app.Listener.Addr().(*net.TCPAddr).Port, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	// Spans that are never exported must not become the app's parent
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/traced", proxyPort), nil)
+	req.Header.Set("Traceparent", incoming)
+	req.Header.Set("Tracestate", "vendor=value")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	h := <-seen
+	assert.Equal(t, incoming, h.Get("Traceparent"))
+	assert.Equal(t, "vendor=value", h.Get("Tracestate"))
+
+	// Without one, a new trace is still started for the app
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/untraced", proxyPort))
+	require.NoError(t, err)
+	resp.Body.Close()
+	_, ok := tracing.ParseTraceparent((<-seen).Get("Traceparent"))
+	assert.True(t, ok)
+}
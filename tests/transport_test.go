@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/lum-tools/lrok/internal/config"
+	"github.com/lum-tools/lrok/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportTOML(t *testing.T) {
+	cfg := &config.TunnelConfig{
+		APIKey:    "lum_test",
+		LocalPort: 8080,
+		Subdomain: "transport-test",
+		Transport: config.TransportConfig{
+			Protocol:          config.TransportWSS,
+			DisableTLS:        true,
+			PoolCount:         5,
+			HeartbeatInterval: 30,
+			HeartbeatTimeout:  90,
+			TCPMuxKeepalive:   20,
+		},
+	}
+	path, err := config.GenerateTOML(cfg)
+	require.NoError(t, err)
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for _, line := range []string{
+		`transport.protocol = "wss"`,
+		"transport.tls.enable = false",
+		"transport.poolCount = 5",
+		"transport.heartbeatInterval = 30",
+		"transport.heartbeatTimeout = 90",
+		"transport.tcpMuxKeepaliveInterval = 20",
+	} {
+		assert.Contains(t, string(data), line)
+	}
+	assert.Equal(t, "wss, no TLS, pool 5", cfg.Transport.String())
+
+	// Defaults stay out of the config
+	cfg.Transport = config.TransportConfig{}
+	path, err = config.GenerateTOML(cfg)
+	require.NoError(t, err)
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "transport.")
+
+	// Disabling TLS contradicts TLS settings
+	cfg.Transport.DisableTLS = true
+	cfg.TLS = config.TLSConfig{Enable: true}
+	_, err = config.GenerateTOML(cfg)
+	assert.ErrorContains(t, err, "TLS is disabled")
+}
+
+func TestValidateTransport(t *testing.T) {
+	valid := []config.TransportConfig{
+		{},
+		{Protocol: "websocket"},
+		{Protocol: "kcp", DisableTCPMux: true},
+		{Protocol: "quic", PoolCount: 10},
+		{HeartbeatInterval: -1},
+		{HeartbeatInterval: 30, HeartbeatTimeout: 90},
+	}
+	for _, tc := range valid {
+		assert.NoError(t, tunnel.ValidateTransport(tc), "%+v", tc)
+	}
+
+	invalid := []config.TransportConfig{
+		{Protocol: "udp"},
+		{PoolCount: 51},
+		{PoolCount: -1},
+		{HeartbeatInterval: -2},
+		{HeartbeatInterval: 30, HeartbeatTimeout: 10},
+		{Protocol: "quic", DisableTCPMux: true},
+		{DisableTCPMux: true, TCPMuxKeepalive: 30},
+	}
+	for _, tc := range invalid {
+		assert.Error(t, tunnel.ValidateTransport(tc), "%+v", tc)
+	}
+}
+
+func TestResolveServerTransport(t *testing.T) {
+	withConfigFile(t, `
+[profiles.default]
+region = "edge"
+
+[profiles.default.transport]
+pool_count = 3
+disable_tcp_mux = true
+
+[regions.edge]
+addr = "frp.edge.example"
+port = 443
+
+[regions.edge.transport]
+protocol = "websocket"
+heartbeat_interval = 20
+`)
+	t.Setenv("LROK_SERVER", "")
+	t.Setenv("LROK_REGION", "")
+	t.Setenv("LROK_TRANSPORT", "")
+	ctx := context.Background()
+
+	s, err := config.ResolveServer(ctx, config.ServerOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "websocket", s.Transport.Protocol)
+	assert.Equal(t, 20, s.Transport.HeartbeatInterval)
+	assert.Equal(t, 3, s.Transport.PoolCount)
+	assert.True(t, s.Transport.DisableTCPMux)
+
+	t.Setenv("LROK_TRANSPORT", "wss")
+	s, err = config.ResolveServer(ctx, config.ServerOptions{Transport: config.TransportConfig{PoolCount: 7}})
+	require.NoError(t, err)
+	assert.Equal(t, "wss", s.Transport.Protocol)
+	assert.Equal(t, 7, s.Transport.PoolCount)
+
+	s, err = config.ResolveServer(ctx, config.ServerOptions{Transport: config.TransportConfig{Protocol: "kcp"}})
+	require.NoError(t, err)
+	assert.Equal(t, "kcp", s.Transport.Protocol)
+
+	// An explicit --tcp-mux=true overrides the profile's disable_tcp_mux
+	s, err = config.ResolveServer(ctx, config.ServerOptions{Transport: config.TransportConfig{EnableTCPMux: true}})
+	require.NoError(t, err)
+	assert.False(t, s.Transport.DisableTCPMux)
+
+	cfg := &config.TunnelConfig{}
+	s.Apply(cfg)
+	assert.Equal(t, s.Transport, cfg.Transport)
+}
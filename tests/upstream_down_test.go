@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closedPort returns a local port nothing listens on
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func findRequest(prox *proxy.Proxy, path string) *proxy.Request {
+	for _, r := range prox.GetRequests() {
+		if r.Path == path {
+			return r
+		}
+	}
+	return nil
+}
+
+func TestUpstreamDownErrorPage(t *testing.T) {
+	down := closedPort(t)
+	prox := proxy.New(down, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/page", proxyPort), nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "upstream_unavailable", resp.Header.Get("X-Lrok-Error"))
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, string(body), "Local app is not running")
+	assert.Contains(t, string(body), "127.0.0.1:"+strconv.Itoa(down))
+
+	resp, err = http.Post(fmt.Sprintf("http://127.0.0.1:%d/webhook", proxyPort), "application/json", nil)
+	require.NoError(t, err)
+	var page map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "upstream_unavailable", page["error"])
+
+	// Failed attempts are captured with their error
+	captured := findRequest(prox, "/webhook")
+	require.NotNil(t, captured)
+	assert.Equal(t, http.StatusBadGateway, captured.StatusCode)
+	assert.Contains(t, captured.Error, "connection refused")
+	assert.Equal(t, "127.0.0.1:"+strconv.Itoa(down), captured.Upstream)
+}
+
+func TestHoldRequestsUntilAppStarts(t *testing.T) {
+	port := closedPort(t)
+	prox := proxy.New(port, 100)
+	prox.SetHoldRequests(5 * time.Second)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	// The app comes back while the request waits
+	time.AfterFunc(500*time.Millisecond, func() {
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return
+		}
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "back")
+		})}
+		t.Cleanup(func() { srv.Close() })
+		go srv.Serve(l)
+	})
+
+	assert.Equal(t, "back", getBody(t, proxyPort, "/held"))
+	captured := findRequest(prox, "/held")
+	require.NotNil(t, captured)
+	assert.Equal(t, http.StatusOK, captured.StatusCode)
+	assert.Empty(t, captured.Error)
+	assert.Greater(t, captured.Held, 200*time.Millisecond)
+}
+
+func TestHoldRequestsTimeout(t *testing.T) {
+	prox := proxy.New(closedPort(t), 100)
+	prox.SetHoldRequests(300 * time.Millisecond)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/late", proxyPort))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	captured := findRequest(prox, "/late")
+	require.NotNil(t, captured)
+	assert.GreaterOrEqual(t, captured.Held, 300*time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/lum-tools/lrok/internal/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noRedirectClient() *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func TestVerifyReachesProxy(t *testing.T) {
+	var sawNonce atomic.Bool
+	app := startHandlerApp(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(proxy.VerifyHeader) != "" {
+			sawNonce.Store(true)
+		}
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	prox := proxy.New(app, 100)
+	proxyPort, err := prox.Start()
+	require.NoError(t, err)
+	defer prox.Stop()
+
+	ctx := context.Background()
+	base := fmt.Sprintf("http://127.0.0.1:%d", proxyPort)
+
+	// A redirecting app still verifies: the proxy echoed the nonce
+	result := verify.Check(ctx, noRedirectClient(), base+"/")
+	assert.True(t, result.OK(), result.Diagnosis)
+	assert.Equal(t, http.StatusFound, result.Status)
+	assert.Greater(t, result.UpstreamTime, time.Duration(0))
+	assert.Contains(t, result.Diagnosis, "app answered 302")
+	assert.False(t, sawNonce.Load())
+
+	// Anyone can send a nonce, so check requests stay visible, only tagged
+	captured := prox.GetRequests()
+	require.Len(t, captured, 1)
+	assert.True(t, captured[0].Verification)
+	assert.NotContains(t, captured[0].RequestHeaders, proxy.VerifyHeader)
+
+	result = verify.Check(ctx, noRedirectClient(), base+proxy.ProbePath)
+	assert.True(t, result.OK())
+	assert.Equal(t, time.Duration(0), result.UpstreamTime)
+}
+
+func TestVerifyDiagnostics(t *testing.T) {
+	ctx := context.Background()
+
+	down := proxy.New(closedPort(t), 100)
+	proxyPort, err := down.Start()
+	require.NoError(t, err)
+	defer down.Stop()
+	result := verify.Check(ctx, noRedirectClient(), fmt.Sprintf("http://127.0.0.1:%d/", proxyPort))
+	assert.True(t, result.OK())
+	assert.Equal(t, "upstream_unavailable", result.LrokError)
+	assert.Contains(t, result.Diagnosis, "not running")
+
+	// A server that isn't lrok, like frps without a matching tunnel
+	frps := httptest.NewServer(http.NotFoundHandler())
+	defer frps.Close()
+	result = verify.Check(ctx, noRedirectClient(), frps.URL)
+	assert.False(t, result.OK())
+	assert.Contains(t, result.Diagnosis, "no tunnel is registered")
+
+	result = verify.Check(ctx, noRedirectClient(), fmt.Sprintf("http://127.0.0.1:%d/", closedPort(t)))
+	assert.False(t, result.OK())
+	assert.Contains(t, result.Diagnosis, "could not connect")
+}
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lum-tools/lrok/internal/proxy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hmacHex(secret, data string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hmacBase64(secret, data string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func verifyWebhook(t *testing.T, spec string, req *http.Request, body string, now time.Time) *proxy.WebhookResult {
+	v, err := proxy.ParseWebhookVerifier(spec)
+	require.NoError(t, err)
+	require.True(t, v.Applies(req))
+	return v.Verify(req, []byte(body), now)
+}
+
+func TestParseWebhookVerifier(t *testing.T) {
+	v, err := proxy.ParseWebhookVerifier("GitHub:s3cr:et")
+	require.NoError(t, err)
+	assert.Equal(t, proxy.WebhookGitHub, v.Provider)
+	assert.Equal(t, "s3cr:et", v.Secret)
+
+	v, err = proxy.ParseWebhookVerifier("hmac=x-my-signature:secret")
+	require.NoError(t, err)
+	assert.Equal(t, proxy.WebhookHMAC, v.Provider)
+	assert.Equal(t, "X-My-Signature", v.Header)
+
+	for _, spec := range []string{"github", "github:", "paypal:secret"} {
+		_, err := proxy.ParseWebhookVerifier(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestVerifyGitHubWebhook(t *testing.T) {
+	body := `{"action":"opened","number":1}`
+	req := httptest.NewRequest("POST", "/hooks/github", nil)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hmacHex("gh-secret", body))
+
+	result := verifyWebhook(t, "github:gh-secret", req, body, time.Now())
+	assert.True(t, result.Valid, result.Detail)
+
+	result = verifyWebhook(t, "github:other", req, body, time.Now())
+	assert.False(t, result.Valid)
+	assert.Equal(t, proxy.WebhookWrongSecret, result.Reason)
+
+	// The sender signed indented JSON, but a compacted body arrived
+	indented := "{\n  \"action\": \"opened\",\n  \"number\": 1\n}"
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hmacHex("gh-secret", indented))
+	result = verifyWebhook(t, "github:gh-secret", req, body, time.Now())
+	assert.Equal(t, proxy.WebhookBodyMutated, result.Reason)
+	assert.Contains(t, result.Detail, "indented JSON")
+}
+
+func TestVerifyStripeWebhook(t *testing.T) {
+	body := `{"id":"evt_1","type":"charge.succeeded"}`
+	signed := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(signed.Unix(), 10)
+	req := httptest.NewRequest("POST", "/hooks/stripe", nil)
+	req.Header.Set("Stripe-Signature", fmt.Sprintf("t=%s,v1=%s,v1=%s", ts, hmacHex("whsec_old", ts+"."+body), hmacHex("whsec_new", ts+"."+body)))
+
+	result := verifyWebhook(t, "stripe:whsec_new", req, body, signed.Add(time.Minute))
+	assert.True(t, result.Valid, result.Detail)
+
+	result = verifyWebhook(t, "stripe:whsec_new", req, body, signed.Add(time.Hour))
+	assert.Equal(t, proxy.WebhookTimestampSkew, result.Reason)
+
+	result = verifyWebhook(t, "stripe:whsec_new", req, body+"\n", signed)
+	assert.Equal(t, proxy.WebhookBodyMutated, result.Reason)
+
+	req.Header.Set("Stripe-Signature", "v1=abc")
+	result = verifyWebhook(t, "stripe:whsec_new", req, body, signed)
+	assert.Equal(t, proxy.WebhookMalformed, result.Reason)
+}
+
+func TestVerifySlackShopifyTwilioWebhooks(t *testing.T) {
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := "token=abc&team_id=T1"
+	req := httptest.NewRequest("POST", "/slack", nil)
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hmacHex("slack-secret", "v0:"+ts+":"+body))
+	assert.True(t, verifyWebhook(t, "slack:slack-secret", req, body, now).Valid)
+
+	req = httptest.NewRequest("POST", "/shopify", nil)
+	req.Header.Set("X-Shopify-Hmac-Sha256", hmacBase64("shop-secret", `{"id":1}`))
+	assert.True(t, verifyWebhook(t, "shopify:shop-secret", req, `{"id":1}`, now).Valid)
+
+	// Twilio signs the public URL followed by the sorted form parameters
+	req = httptest.NewRequest("POST", "/twilio?x=1", nil)
+	req.Host = "my-app.t.lum.tools"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h := hmac.New(sha1.New, []byte("auth-token"))
+	h.Write([]byte("https://my-app.t.lum.tools/twilio?x=1" + "Body" + "hi" + "From" + "+15551234"))
+	req.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	assert.True(t, verifyWebhook(t, "twilio:auth-token", req, "From=%2B15551234&Body=hi", now).Valid)
+
+	req = httptest.NewRequest("POST", "/generic", nil)
+	req.Header.Set("X-Signature", "sha256="+hmacHex("generic", "payload"))
+	assert.True(t, verifyWebhook(t, "hmac:generic", req, "payload", now).Valid)
+}
+
+func TestProxyWebhookVerification(t *testing.T) {
+	var hits atomic.Int32
+	app := startHandlerApp(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			hits.Add(1)
+		}
+		io.WriteString(w, "ok")
+	})
+
+	for _, reject := range []bool{false, true} {
+		hits.Store(0)
+		prox := proxy.New(app, 100)
+		verifiers, err := proxy.ParseWebhookVerifiers([]string{"github:gh-secret"})
+		require.NoError(t, err)
+		prox.SetWebhookVerifiers(verifiers, reject)
+		proxyPort, err := prox.Start()
+		require.NoError(t, err)
+
+		post := func(path, body, signature string) int {
+			req, err := http.NewRequest("POST", fmt.Sprintf("http://127.0.0.1:%d%s", proxyPort, path), strings.NewReader(body))
+			require.NoError(t, err)
+			if signature != "" {
+				req.Header.Set("X-Hub-Signature-256", signature)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		assert.Equal(t, http.StatusOK, post("/valid", "{}", "sha256="+hmacHex("gh-secret", "{}")))
+		assert.Equal(t, http.StatusOK, post("/unsigned", "{}", ""))
+		status := post("/invalid", "{}", "sha256="+hmacHex("wrong", "{}"))
+
+		results := map[string]*proxy.WebhookResult{}
+		for _, r := range prox.GetRequests() {
+			results[r.Path] = r.Webhook
+		}
+		assert.True(t, results["/valid"].Valid)
+		assert.Nil(t, results["/unsigned"])
+		require.NotNil(t, results["/invalid"])
+		assert.Equal(t, proxy.WebhookWrongSecret, results["/invalid"].Reason)
+		assert.Equal(t, reject, results["/invalid"].Rejected)
+		if reject {
+			assert.Equal(t, http.StatusUnauthorized, status)
+			assert.Equal(t, int32(2), hits.Load())
+		} else {
+			assert.Equal(t, http.StatusOK, status)
+			assert.Equal(t, int32(3), hits.Load())
+		}
+		prox.Stop()
+	}
+}